@@ -3,6 +3,7 @@ package apidef
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
@@ -23,6 +24,14 @@ const (
 	AuthMulti  AuthenticationType = "multi"
 )
 
+// MultiAuthMode defines how the nested configs of a multi auth combine
+type MultiAuthMode string
+
+const (
+	MultiAuthAny MultiAuthMode = "any" // the first method that succeeds authenticates the caller
+	MultiAuthAll MultiAuthMode = "all" // every method must succeed
+)
+
 // ProtocolType represents the protocol used
 type ProtocolType string
 
@@ -70,6 +79,9 @@ type APIDefinition struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 	CreatedBy string    `json:"created_by" db:"created_by"`
 	UpdatedBy string    `json:"updated_by" db:"updated_by"`
+	// Revision is incremented by every stored change; updates must carry
+	// the revision they were based on
+	Revision int64 `json:"revision" db:"revision"`
 
 	// Network Configuration
 	Proxy           ProxyConfig  `json:"proxy"`
@@ -131,6 +143,9 @@ type ProxyConfig struct {
 	RetryAttempts int           `json:"retry_attempts"`
 	RetryBackoff  time.Duration `json:"retry_backoff"`
 
+	// Passive Health Checking
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+
 	// TLS Configuration
 	TLSConfig *TLSConfig `json:"tls_config,omitempty"`
 
@@ -160,6 +175,14 @@ type HealthCheck struct {
 	ExpectedBody       string        `json:"expected_body,omitempty"`
 }
 
+// CircuitBreakerConfig defines passive health checking for upstream targets
+type CircuitBreakerConfig struct {
+	Enabled             bool          `json:"enabled"`
+	ConsecutiveFailures int           `json:"consecutive_failures"` // 5xx/timeouts before the circuit opens
+	CoolDown            time.Duration `json:"cool_down"`            // time a target stays ejected
+	HalfOpenRequests    int           `json:"half_open_requests"`   // trial requests needed to close the circuit
+}
+
 // TLSConfig for upstream connections
 type TLSConfig struct {
 	Enabled            bool   `json:"enabled"`
@@ -182,6 +205,7 @@ type AuthConfig struct {
 	HMACConfig   *HMACConfig            `json:"hmac_config,omitempty"`
 	CustomConfig map[string]interface{} `json:"custom_config,omitempty"`
 	MultiConfig  []AuthConfig           `json:"multi_config,omitempty"` // For multi-auth
+	MultiMode    MultiAuthMode          `json:"multi_mode,omitempty"`   // any (default) or all
 }
 
 // APIKeyConfig for API key authentication
@@ -202,7 +226,7 @@ type JWTConfig struct {
 	RequiredClaims  []string          `json:"required_claims,omitempty"`
 	Issuer          string            `json:"issuer,omitempty"`
 	Audience        []string          `json:"audience,omitempty"`
-	SkipValidation  []string          `json:"skip_validation,omitempty"`
+	SkipValidation  []string          `json:"skip_validation,omitempty"` // registered claim checks to skip: exp, nbf, iat, iss, aud
 }
 
 // OAuth2Config for OAuth2 authentication
@@ -247,7 +271,7 @@ type CORSConfig struct {
 type SecurityPolicy struct {
 	ID       string                 `json:"id"`
 	Name     string                 `json:"name"`
-	Type     string                 `json:"type"` // ip_whitelist, ip_blacklist, geo_restriction, etc.
+	Type     string                 `json:"type"` // ip_whitelist, ip_blacklist, geo_restriction
 	Config   map[string]interface{} `json:"config"`
 	Enabled  bool                   `json:"enabled"`
 	Priority int                    `json:"priority"`
@@ -258,9 +282,9 @@ type RateLimit struct {
 	Rate     int           `json:"rate"`              // requests per period
 	Period   time.Duration `json:"period"`            // time period
 	Burst    int           `json:"burst"`             // burst size
-	Strategy string        `json:"strategy"`          // local, distributed
+	Strategy string        `json:"strategy"`          // local, distributed (gcra), sliding_window
 	Headers  []string      `json:"headers,omitempty"` // rate limit headers to return
-	Per      string        `json:"per"`               // ip, key, user, etc.
+	Per      string        `json:"per"`               // global, ip, key, user, header:<name>
 }
 
 // Quota defines quota configuration
@@ -268,7 +292,7 @@ type Quota struct {
 	Max                int           `json:"max"`    // maximum requests
 	Period             time.Duration `json:"period"` // quota period
 	RenewOnPeriodStart bool          `json:"renew_on_period_start"`
-	Per                string        `json:"per"` // ip, key, user, etc.
+	Per                string        `json:"per"` // global, ip, key, user, header:<name>
 }
 
 // MiddlewareConfig defines middleware chain configuration
@@ -301,7 +325,7 @@ type MiddlewareSpec struct {
 type Transform struct {
 	Type      string                 `json:"type"`   // header, body, url, method
 	Action    string                 `json:"action"` // set, add, remove, replace
-	Target    string                 `json:"target"` // field/header name, path
+	Target    string                 `json:"target"` // header name; path, query or query:<name>; JSON path or $
 	Value     string                 `json:"value,omitempty"`
 	Template  string                 `json:"template,omitempty"`
 	Condition *TransformCondition    `json:"condition,omitempty"`
@@ -310,7 +334,7 @@ type Transform struct {
 
 // TransformCondition defines when a transform should be applied
 type TransformCondition struct {
-	Field    string         `json:"field"`    // header, query, body
+	Field    string         `json:"field"`    // header:<name>, query:<name>, body:<json path>
 	Operator string         `json:"operator"` // equals, contains, regex, exists
 	Value    string         `json:"value"`
 	Regex    *regexp.Regexp `json:"-"` // Compiled regex, not serialized
@@ -439,6 +463,11 @@ func (a *AuthConfig) Validate() error {
 		if len(a.MultiConfig) == 0 {
 			return fmt.Errorf("multi_config is required for multi authentication")
 		}
+		switch a.MultiMode {
+		case "", MultiAuthAny, MultiAuthAll:
+		default:
+			return fmt.Errorf("unsupported multi_mode: %s", a.MultiMode)
+		}
 		for i, config := range a.MultiConfig {
 			if err := config.Validate(); err != nil {
 				return fmt.Errorf("multi auth config %d validation failed: %w", i, err)
@@ -587,6 +616,11 @@ func (a *APIDefinition) Clone() *APIDefinition {
 
 // MatchesRequest checks if this API definition matches the given request
 func (a *APIDefinition) MatchesRequest(r *http.Request) bool {
+	// Check domain if specified
+	if a.Domain != "" && NormalizeHost(r.Host) != NormalizeHost(a.Domain) {
+		return false
+	}
+
 	// Check if the request path matches the listen path
 	listenPath := a.GetListenPath()
 	requestPath := r.URL.Path
@@ -600,16 +634,17 @@ func (a *APIDefinition) MatchesRequest(r *http.Request) bool {
 		return true
 	}
 
-	if strings.HasPrefix(requestPath, listenPath+"/") {
-		return true
-	}
+	return strings.HasPrefix(requestPath, listenPath+"/")
+}
 
-	// Check domain if specified
-	if a.Domain != "" && r.Host != a.Domain {
-		return false
+// NormalizeHost lowercases a request host or definition domain and removes
+// any port and trailing dot, the form in which domains are compared
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
 	}
-
-	return false
+	return strings.TrimSuffix(host, ".")
 }
 
 // GetEffectiveTargetURL returns the target URL to use for this request
@@ -618,9 +653,9 @@ func (a *APIDefinition) GetEffectiveTargetURL() string {
 		return a.Proxy.TargetURL
 	}
 
-	// For multiple targets, this would implement load balancing logic
+	// Per-request selection across multiple targets is done by the balancer
+	// package; without a request the first target is the best answer
 	if len(a.Proxy.Targets) > 0 {
-		// Simple round-robin for now
 		return a.Proxy.Targets[0].URL
 	}
 
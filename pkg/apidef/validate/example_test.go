@@ -0,0 +1,83 @@
+package validate_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/apidef/validate"
+)
+
+// ExampleValidator_Validate reports every problem of a definition at once
+func ExampleValidator_Validate() {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Hour)
+	v := validate.New(validate.WithClock(func() time.Time { return now }))
+
+	err := v.Validate(&apidef.APIDefinition{
+		Name:       "Orders",
+		APIID:      "orders",
+		ListenPath: "/orders",
+		ExpireDate: &expired,
+		Proxy: apidef.ProxyConfig{
+			LoadBalancing: apidef.LoadBalanceWeighted,
+			Targets: []apidef.UpstreamTarget{
+				{ID: "a", URL: "http://orders-a:8080", Weight: 3},
+				{ID: "b", URL: "orders-b:8080"},
+				{ID: "a", URL: "http://orders-c:8080", Weight: 1},
+			},
+		},
+		AuthConfig: apidef.AuthConfig{Type: apidef.AuthNone},
+		CORSConfig: &apidef.CORSConfig{
+			AllowedOrigins: []string{"https://app.example.com", "https://app.example.com/path"},
+		},
+		GlobalRateLimit: &apidef.RateLimit{Rate: 100},
+		VersioningConfig: &apidef.VersioningConfig{
+			DefaultVersion: "v3",
+			Versions:       map[string]apidef.VersionSpec{"v1": {Name: "v1"}, "v2": {Name: "v2"}},
+		},
+	})
+
+	var errs validate.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			fmt.Println(e.Path)
+		}
+	}
+
+	// Output:
+	// /expire_date
+	// /proxy/targets/1/url
+	// /proxy/targets/1/weight
+	// /proxy/targets/2/id
+	// /cors_config/allowed_origins/1
+	// /global_rate_limit/period
+	// /versioning_config/default_version
+}
+
+// ExampleValidateAll detects definitions sharing an API ID or claiming the
+// same route
+func ExampleValidateAll() {
+	target := apidef.ProxyConfig{TargetURL: "http://orders:8080"}
+	keyless := apidef.AuthConfig{Type: apidef.AuthNone}
+
+	err := validate.ValidateAll([]*apidef.APIDefinition{
+		{Name: "Orders", APIID: "orders", ListenPath: "/orders", Proxy: target, AuthConfig: keyless},
+		{Name: "Orders EU", APIID: "orders-eu", Domain: "eu.example.com", ListenPath: "/orders", Proxy: target, AuthConfig: keyless},
+		{Name: "Orders v2", APIID: "orders-v2", ListenPath: "orders/", Proxy: target, AuthConfig: keyless},
+		{Name: "Orders EU copy", APIID: "orders-eu", Domain: "EU.example.com:443", ListenPath: "/orders", Proxy: target, AuthConfig: keyless},
+	})
+
+	var errs validate.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+	}
+
+	// Output:
+	// /2/listen_path: */orders is already claimed by api orders at /0
+	// /3/api_id: orders-eu is already used at /1
+	// /3/listen_path: eu.example.com/orders is already claimed by api orders-eu at /1
+}
@@ -0,0 +1,295 @@
+// Package validate checks API definitions in depth. Unlike
+// apidef.APIDefinition.Validate, which stops at the first missing field, it
+// reports every problem found, each located by the JSON pointer of the
+// offending field.
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/cors"
+)
+
+// FieldError is a problem with one field of a definition
+type FieldError struct {
+	// Path is the JSON pointer of the field, such as /proxy/targets/0/url.
+	// Errors found across a set of definitions are prefixed with the index
+	// of the definition.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Errors is every problem found by a validation
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap lets errors.As reach the individual field errors
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Validator checks API definitions
+type Validator struct {
+	now func() time.Time
+}
+
+// Option allows customization of the validator
+type Option func(*Validator)
+
+// WithClock sets the clock expiry dates are compared with
+func WithClock(now func() time.Time) Option {
+	return func(v *Validator) {
+		v.now = now
+	}
+}
+
+// New creates a validator
+func New(options ...Option) *Validator {
+	v := &Validator{now: time.Now}
+	for _, option := range options {
+		option(v)
+	}
+	return v
+}
+
+// Validate checks a definition, returning Errors listing every problem or
+// nil. The definition is not modified.
+func (v *Validator) Validate(def *apidef.APIDefinition) error {
+	if def == nil {
+		return Errors{{Message: "api definition cannot be nil"}}
+	}
+	c := &collector{}
+	v.definition(c, "", def)
+	return c.result()
+}
+
+// ValidateAll checks every definition of a set, and that no two of them
+// share an API ID or claim the same domain and listen path. Paths are
+// prefixed with the index of the definition, so /1/listen_path is the
+// listen path of defs[1]. Collisions are reported whatever the status of
+// the definitions, since activating either one would break routing.
+func (v *Validator) ValidateAll(defs []*apidef.APIDefinition) error {
+	c := &collector{}
+	ids := make(map[string]int)
+	claimed := make(map[string]int)
+	for i, def := range defs {
+		prefix := "/" + strconv.Itoa(i)
+		if def == nil {
+			c.add(prefix, "api definition cannot be nil")
+			continue
+		}
+		v.definition(c, prefix, def)
+
+		if def.APIID != "" {
+			if first, ok := ids[def.APIID]; ok {
+				c.add(prefix+"/api_id", "%s is already used at /%d", def.APIID, first)
+			} else {
+				ids[def.APIID] = i
+			}
+		}
+
+		key := apidef.NormalizeHost(def.Domain) + def.GetListenPath()
+		if first, ok := claimed[key]; ok {
+			c.add(prefix+"/listen_path", "%s is already claimed by api %s at /%d",
+				route(def), defs[first].APIID, first)
+			continue
+		}
+		claimed[key] = i
+	}
+	return c.result()
+}
+
+// Validate checks a definition with a default validator
+func Validate(def *apidef.APIDefinition) error {
+	return New().Validate(def)
+}
+
+// ValidateAll checks a set of definitions with a default validator
+func ValidateAll(defs []*apidef.APIDefinition) error {
+	return New().ValidateAll(defs)
+}
+
+// Internal methods
+
+// collector accumulates the errors of a validation
+type collector struct {
+	errs Errors
+}
+
+func (c *collector) add(path, format string, args ...interface{}) {
+	c.errs = append(c.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *collector) result() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
+
+func (v *Validator) definition(c *collector, path string, def *apidef.APIDefinition) {
+	if def.Name == "" {
+		c.add(path+"/name", "is required")
+	}
+	if def.APIID == "" {
+		c.add(path+"/api_id", "is required")
+	}
+	if def.ListenPath == "" {
+		c.add(path+"/listen_path", "is required")
+	}
+	if def.ExpireDate != nil && !def.ExpireDate.After(v.now()) {
+		c.add(path+"/expire_date", "%s is in the past", def.ExpireDate.Format(time.RFC3339))
+	}
+
+	proxy(c, path+"/proxy", &def.Proxy)
+
+	if err := def.AuthConfig.Validate(); err != nil {
+		c.add(path+"/auth_config", "%v", err)
+	}
+	transforms(c, path+"/request_transforms", def.RequestTransforms)
+	transforms(c, path+"/response_transforms", def.ResponseTransforms)
+
+	if def.CORSConfig != nil {
+		for i, origin := range def.CORSConfig.AllowedOrigins {
+			if err := cors.ValidateOrigin(origin, def.CORSConfig.AllowCredentials); err != nil {
+				c.add(fmt.Sprintf("%s/cors_config/allowed_origins/%d", path, i), "%v", err)
+			}
+		}
+	}
+
+	rateLimit(c, path+"/global_rate_limit", def.GlobalRateLimit)
+	rateLimit(c, path+"/per_key_rate_limit", def.PerKeyRateLimit)
+	if quota := def.GlobalQuota; quota != nil {
+		if quota.Max <= 0 {
+			c.add(path+"/global_quota/max", "must be greater than 0")
+		}
+		if quota.Period <= 0 {
+			c.add(path+"/global_quota/period", "must be greater than 0")
+		}
+	}
+
+	if versioning := def.VersioningConfig; versioning != nil && versioning.DefaultVersion != "" {
+		if _, ok := versioning.Versions[versioning.DefaultVersion]; !ok {
+			c.add(path+"/versioning_config/default_version", "%q is not one of the versions", versioning.DefaultVersion)
+		}
+	}
+}
+
+func proxy(c *collector, path string, config *apidef.ProxyConfig) {
+	if config.TargetURL == "" && len(config.Targets) == 0 {
+		c.add(path, "either target_url or targets must be specified")
+	}
+	if config.TargetURL != "" {
+		if err := targetURL(config.TargetURL); err != nil {
+			c.add(path+"/target_url", "%v", err)
+		}
+	}
+
+	switch config.LoadBalancing {
+	case "", apidef.LoadBalanceRoundRobin, apidef.LoadBalanceWeighted, apidef.LoadBalanceIPHash,
+		apidef.LoadBalanceLeastConn, apidef.LoadBalanceRandom:
+	default:
+		c.add(path+"/load_balancing", "unsupported strategy %q", config.LoadBalancing)
+	}
+
+	// targets are keyed by their ID, or by their URL when they have none
+	seen := make(map[string]int, len(config.Targets))
+	for i, target := range config.Targets {
+		targetPath := fmt.Sprintf("%s/targets/%d", path, i)
+		if err := targetURL(target.URL); err != nil {
+			c.add(targetPath+"/url", "%v", err)
+		}
+		key, field := target.ID, "/id"
+		if key == "" {
+			key, field = target.URL, "/url"
+		}
+		if first, ok := seen[key]; ok {
+			c.add(targetPath+field, "%q is already used by target %d", key, first)
+		} else {
+			seen[key] = i
+		}
+		switch {
+		case config.LoadBalancing == apidef.LoadBalanceWeighted && target.Weight <= 0:
+			c.add(targetPath+"/weight", "must be greater than 0 for weighted load balancing")
+		case target.Weight < 0:
+			c.add(targetPath+"/weight", "must not be negative")
+		}
+	}
+}
+
+// targetURL checks an upstream URL is an absolute http(s) URL
+func targetURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must use the http or https scheme", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
+	return nil
+}
+
+func transforms(c *collector, path string, list []apidef.Transform) {
+	for i, transform := range list {
+		// Validate compiles condition regexes into the condition
+		if transform.Condition != nil {
+			condition := *transform.Condition
+			transform.Condition = &condition
+		}
+		if err := transform.Validate(); err != nil {
+			c.add(fmt.Sprintf("%s/%d", path, i), "%v", err)
+		}
+	}
+}
+
+func rateLimit(c *collector, path string, limit *apidef.RateLimit) {
+	if limit == nil {
+		return
+	}
+	if limit.Rate <= 0 {
+		c.add(path+"/rate", "must be greater than 0")
+	}
+	if limit.Period <= 0 {
+		c.add(path+"/period", "must be greater than 0")
+	}
+	if limit.Burst < 0 {
+		c.add(path+"/burst", "must not be negative")
+	}
+}
+
+func route(def *apidef.APIDefinition) string {
+	domain := apidef.NormalizeHost(def.Domain)
+	if domain == "" {
+		domain = "*"
+	}
+	return domain + def.GetListenPath()
+}
@@ -0,0 +1,232 @@
+package apikey
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+)
+
+// DefaultCacheTTL is used when caching is enabled without a CacheTTL
+const DefaultCacheTTL = time.Minute
+
+// maxFormBodyBytes bounds the body read to find a key sent as a form field
+const maxFormBodyBytes = 10 << 20
+
+// Authenticator validates API keys according to an apidef.APIKeyConfig
+type Authenticator struct {
+	config  *apidef.APIKeyConfig
+	manager *Manager
+	orgID   string
+	apiID   string
+	cache   *keyCache
+}
+
+// Option allows customization of the authenticator
+type Option func(*Authenticator)
+
+// WithAPI restricts accepted keys to those issued for the given API
+func WithAPI(orgID, apiID string) Option {
+	return func(a *Authenticator) {
+		a.orgID = orgID
+		a.apiID = apiID
+	}
+}
+
+// NewAuthenticator creates an API key authenticator. The manager must be
+// created with the same HashKeys setting as the config.
+func NewAuthenticator(config *apidef.APIKeyConfig, manager *Manager, options ...Option) (*Authenticator, error) {
+	if config == nil {
+		return nil, fmt.Errorf("api key config cannot be nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid api key config: %w", err)
+	}
+	if manager.hashKeys != config.HashKeys {
+		return nil, fmt.Errorf("key manager hashing does not match hash_keys setting")
+	}
+
+	a := &Authenticator{
+		config:  config,
+		manager: manager,
+	}
+
+	for _, option := range options {
+		option(a)
+	}
+
+	if config.EnableCaching {
+		ttl := config.CacheTTL
+		if ttl <= 0 {
+			ttl = DefaultCacheTTL
+		}
+		a.cache = newKeyCache(ttl)
+	}
+
+	return a, nil
+}
+
+// Authenticate implements auth.Authenticator
+func (a *Authenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	raw := a.extract(r)
+	if raw == "" {
+		return nil, auth.Unauthorized("MISSING_API_KEY", "api key is required", auth.ErrMissingCredentials)
+	}
+
+	key, err := a.resolve(r, raw)
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		return nil, auth.Unauthorized("INVALID_API_KEY", "api key is invalid", auth.ErrInvalidCredentials)
+	case errors.Is(err, ErrKeyExpired):
+		return nil, auth.Unauthorized("EXPIRED_API_KEY", "api key has expired", auth.ErrExpiredCredentials)
+	case err != nil:
+		return nil, err
+	}
+
+	if (a.orgID != "" && key.OrgID != a.orgID) || (a.apiID != "" && key.APIID != a.apiID) {
+		return nil, auth.Forbidden("API_KEY_NOT_ALLOWED", "api key is not valid for this api", auth.ErrForbidden)
+	}
+
+	return &auth.Principal{
+		ID:       key.ID,
+		OrgID:    key.OrgID,
+		APIID:    key.APIID,
+		Method:   apidef.AuthAPIKey,
+		Policies: key.Policies,
+		Metadata: key.Metadata,
+	}, nil
+}
+
+// Middleware authenticates requests and attaches the key's principal to the context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return auth.Middleware(a)(next)
+}
+
+// resolve looks the key up in the local cache before hitting the store
+func (a *Authenticator) resolve(r *http.Request, raw string) (*Key, error) {
+	if a.cache != nil {
+		if key, ok := a.cache.get(raw); ok {
+			if key.IsExpired() {
+				return nil, ErrKeyExpired
+			}
+			return key, nil
+		}
+	}
+
+	key, err := a.manager.Resolve(r.Context(), raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.cache != nil {
+		a.cache.set(raw, key)
+	}
+	return key, nil
+}
+
+// extract reads the raw key from the configured location
+func (a *Authenticator) extract(r *http.Request) string {
+	switch strings.ToLower(a.config.Location) {
+	case "query":
+		return r.URL.Query().Get(a.config.ParamName)
+	case "form":
+		return formValue(r, a.config.ParamName)
+	default:
+		value := strings.TrimSpace(r.Header.Get(a.config.ParamName))
+		if strings.EqualFold(a.config.ParamName, "Authorization") {
+			for _, scheme := range []string{"Bearer ", "ApiKey ", "Key "} {
+				if len(value) > len(scheme) && strings.EqualFold(value[:len(scheme)], scheme) {
+					return strings.TrimSpace(value[len(scheme):])
+				}
+			}
+		}
+		return value
+	}
+}
+
+// formValue reads a form field from the request body, restoring the body
+// for downstream handlers
+func formValue(r *http.Request, name string) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	body := r.Body
+	data, err := io.ReadAll(io.LimitReader(body, maxFormBodyBytes+1))
+	if err != nil || len(data) > maxFormBodyBytes {
+		// hand the read part and the rest of the body on unparsed
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), body), body}
+		return ""
+	}
+	body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	// parse a copy so that the request keeps its body and unparsed form
+	form := &http.Request{
+		Method:        r.Method,
+		Header:        r.Header,
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+	}
+	return form.PostFormValue(name)
+}
+
+// keyCache is an in-process cache of resolved keys, indexed by the digest
+// of the raw key so raw keys are never held in memory longer than a request
+type keyCache struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	key       *Key
+	expiresAt time.Time
+}
+
+func newKeyCache(ttl time.Duration) *keyCache {
+	return &keyCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *keyCache) get(raw string) (*Key, bool) {
+	digest := HashKey(raw)
+
+	c.mu.RLock()
+	entry, ok := c.entries[digest]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.key, true
+}
+
+func (c *keyCache) set(raw string, key *Key) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sweep expired entries opportunistically to bound memory
+	for digest, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, digest)
+		}
+	}
+	c.entries[HashKey(raw)] = cacheEntry{key: key, expiresAt: now.Add(c.ttl)}
+}
@@ -0,0 +1,219 @@
+package apikey_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/auth/apikey"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+)
+
+// memoryStore is a minimal in-memory Store used by the examples
+type memoryStore struct {
+	mu   sync.Mutex
+	keys map[string]*apikey.Key
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{keys: make(map[string]*apikey.Key)}
+}
+
+func (s *memoryStore) Save(_ context.Context, key *apikey.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *key
+	s.keys[key.ID] = &copied
+	return nil
+}
+
+func (s *memoryStore) GetByID(_ context.Context, id string) (*apikey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, apikey.ErrKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *memoryStore) GetByLookup(ctx context.Context, lookup string) (*apikey.Key, error) {
+	s.mu.Lock()
+	var id string
+	for _, key := range s.keys {
+		if key.Lookup == lookup {
+			id = key.ID
+		}
+	}
+	s.mu.Unlock()
+	return s.GetByID(ctx, id)
+}
+
+func (s *memoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *memoryStore) List(_ context.Context, orgID, apiID string) ([]*apikey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []*apikey.Key
+	for _, key := range s.keys {
+		if key.OrgID == orgID && key.APIID == apiID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// ExampleAuthenticator demonstrates protecting a handler with hashed API keys
+func ExampleAuthenticator() {
+	ctx := context.Background()
+	manager := apikey.NewManager(newMemoryStore(), true)
+
+	raw, key, err := manager.Create(ctx, apikey.CreateRequest{
+		OrgID:    "acme",
+		APIID:    "orders",
+		Policies: []string{"read-only"},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create key: %v", err)
+	}
+	fmt.Println("stored hashed:", key.Lookup != raw)
+
+	authenticator, err := apikey.NewAuthenticator(&apidef.APIKeyConfig{
+		Location:      "header",
+		ParamName:     "X-API-Key",
+		HashKeys:      true,
+		EnableCaching: true,
+		CacheTTL:      time.Minute,
+	}, manager, apikey.WithAPI("acme", "orders"))
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		fmt.Println("policies:", principal.Policies)
+	}))
+
+	for _, presented := range []string{raw, "bogus", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if presented != "" {
+			req.Header.Set("X-API-Key", presented)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Println("status:", rec.Code)
+	}
+
+	// Output:
+	// stored hashed: true
+	// policies: [read-only]
+	// status: 200
+	// status: 401
+	// status: 401
+}
+
+// ExampleAuthenticator_form demonstrates reading the key from a form field
+// while the upstream still receives the whole body
+func ExampleAuthenticator_form() {
+	manager := apikey.NewManager(newMemoryStore(), false)
+	raw, _, err := manager.Create(context.Background(), apikey.CreateRequest{OrgID: "acme", APIID: "orders"})
+	if err != nil {
+		log.Fatalf("Failed to create key: %v", err)
+	}
+
+	authenticator, err := apikey.NewAuthenticator(&apidef.APIKeyConfig{
+		Location:  "form",
+		ParamName: "api_key",
+	}, manager, apikey.WithAPI("acme", "orders"))
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Println("upstream body:", strings.Replace(string(body), raw, "<key>", 1))
+	}))
+
+	body := url.Values{"api_key": {raw}, "item": {"book"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	fmt.Println("status:", rec.Code)
+
+	// Output:
+	// upstream body: api_key=<key>&item=book
+	// status: 200
+}
+
+// ExampleManager_Rotate demonstrates rotating a key with a grace period
+func ExampleManager_Rotate() {
+	ctx := context.Background()
+	manager := apikey.NewManager(newMemoryStore(), true)
+
+	oldRaw, oldKey, err := manager.Create(ctx, apikey.CreateRequest{OrgID: "acme", APIID: "orders"})
+	if err != nil {
+		log.Fatalf("Failed to create key: %v", err)
+	}
+
+	newRaw, _, err := manager.Rotate(ctx, oldKey.ID, time.Hour)
+	if err != nil {
+		log.Fatalf("Failed to rotate key: %v", err)
+	}
+
+	_, errOld := manager.Resolve(ctx, oldRaw)
+	_, errNew := manager.Resolve(ctx, newRaw)
+	fmt.Println("old key valid during grace period:", errOld == nil)
+	fmt.Println("new key valid:", errNew == nil)
+
+	if err := manager.Revoke(ctx, oldKey.ID); err != nil {
+		log.Fatalf("Failed to revoke key: %v", err)
+	}
+	_, errOld = manager.Resolve(ctx, oldRaw)
+	fmt.Println("old key after revoke:", errOld)
+
+	// Output:
+	// old key valid during grace period: true
+	// new key valid: true
+	// old key after revoke: api key not found
+}
+
+// ExampleNewDragonflyStore shows wiring the key manager to Dragonfly
+func ExampleNewDragonflyStore() {
+	client, err := dragonfly.NewClient(dragonfly.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to dragonfly: %v", err)
+	}
+	defer client.Stop()
+
+	ctx := context.Background()
+	if err := client.Start(ctx); err != nil {
+		log.Fatalf("Failed to start dragonfly client: %v", err)
+	}
+
+	manager := apikey.NewManager(apikey.NewDragonflyStore(client, ""), true)
+
+	raw, key, err := manager.Create(ctx, apikey.CreateRequest{
+		OrgID: "acme",
+		APIID: "orders",
+	})
+	if err != nil {
+		log.Fatalf("Failed to create key: %v", err)
+	}
+	fmt.Printf("issued key %s for %s/%s (%d chars)\n", key.ID, key.OrgID, key.APIID, len(raw))
+}
@@ -0,0 +1,191 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Common API key errors
+var (
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrKeyExpired  = errors.New("api key has expired")
+	ErrInvalidKey  = errors.New("api key cannot be empty")
+)
+
+// Key is a stored API key record. The raw key is never stored when hashing
+// is enabled; Lookup then holds its SHA-256 digest.
+type Key struct {
+	ID        string            `json:"id"`
+	OrgID     string            `json:"org_id"`
+	APIID     string            `json:"api_id"`
+	Alias     string            `json:"alias,omitempty"`
+	Lookup    string            `json:"lookup"`
+	Hashed    bool              `json:"hashed"`
+	Policies  []string          `json:"policies,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	RotatedTo string            `json:"rotated_to,omitempty"`
+}
+
+// IsExpired returns true if the key is past its expiry
+func (k *Key) IsExpired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+// CreateRequest describes a key to create
+type CreateRequest struct {
+	OrgID     string
+	APIID     string
+	Alias     string
+	Policies  []string
+	Metadata  map[string]string
+	ExpiresAt *time.Time
+}
+
+// Manager creates, revokes and rotates API keys
+type Manager struct {
+	store    Store
+	hashKeys bool
+}
+
+// NewManager creates a key manager. When hashKeys is set only the SHA-256
+// digest of each key is persisted.
+func NewManager(store Store, hashKeys bool) *Manager {
+	return &Manager{
+		store:    store,
+		hashKeys: hashKeys,
+	}
+}
+
+// Create generates and stores a new key. The raw key is only returned here.
+func (m *Manager) Create(ctx context.Context, req CreateRequest) (string, *Key, error) {
+	if req.OrgID == "" || req.APIID == "" {
+		return "", nil, fmt.Errorf("org_id and api_id are required")
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	key := &Key{
+		ID:        id,
+		OrgID:     req.OrgID,
+		APIID:     req.APIID,
+		Alias:     req.Alias,
+		Lookup:    m.lookupFor(raw),
+		Hashed:    m.hashKeys,
+		Policies:  req.Policies,
+		Metadata:  req.Metadata,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if err := m.store.Save(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to store key: %w", err)
+	}
+	return raw, key, nil
+}
+
+// Get returns a key by its ID
+func (m *Manager) Get(ctx context.Context, id string) (*Key, error) {
+	return m.store.GetByID(ctx, id)
+}
+
+// Revoke deletes a key so it can no longer be used
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, id)
+}
+
+// Rotate issues a replacement for a key, carrying over its identity and
+// policies. The old key keeps working for gracePeriod; a zero grace period
+// revokes it immediately.
+func (m *Manager) Rotate(ctx context.Context, id string, gracePeriod time.Duration) (string, *Key, error) {
+	old, err := m.store.GetByID(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	raw, replacement, err := m.Create(ctx, CreateRequest{
+		OrgID:     old.OrgID,
+		APIID:     old.APIID,
+		Alias:     old.Alias,
+		Policies:  old.Policies,
+		Metadata:  old.Metadata,
+		ExpiresAt: old.ExpiresAt,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if gracePeriod <= 0 {
+		if err := m.store.Delete(ctx, id); err != nil {
+			return "", nil, fmt.Errorf("failed to revoke rotated key: %w", err)
+		}
+		return raw, replacement, nil
+	}
+
+	expiresAt := time.Now().UTC().Add(gracePeriod)
+	if old.ExpiresAt == nil || expiresAt.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &expiresAt
+	}
+	old.RotatedTo = replacement.ID
+	if err := m.store.Save(ctx, old); err != nil {
+		return "", nil, fmt.Errorf("failed to update rotated key: %w", err)
+	}
+	return raw, replacement, nil
+}
+
+// List returns all keys issued for an API
+func (m *Manager) List(ctx context.Context, orgID, apiID string) ([]*Key, error) {
+	return m.store.List(ctx, orgID, apiID)
+}
+
+// Resolve finds the key matching a raw key presented by a caller
+func (m *Manager) Resolve(ctx context.Context, raw string) (*Key, error) {
+	if raw == "" {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := m.store.GetByLookup(ctx, m.lookupFor(raw))
+	if err != nil {
+		return nil, err
+	}
+	if key.IsExpired() {
+		return nil, ErrKeyExpired
+	}
+	return key, nil
+}
+
+// lookupFor returns the value under which a raw key is stored
+func (m *Manager) lookupFor(raw string) string {
+	if m.hashKeys {
+		return HashKey(raw)
+	}
+	return raw
+}
+
+// HashKey returns the hex-encoded SHA-256 digest of a raw key
+func HashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,147 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+)
+
+// DefaultKeyPrefix is the prefix of every key written by DragonflyStore
+const DefaultKeyPrefix = "apikey:"
+
+// Store persists API key records
+type Store interface {
+	Save(ctx context.Context, key *Key) error
+	GetByID(ctx context.Context, id string) (*Key, error)
+	GetByLookup(ctx context.Context, lookup string) (*Key, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, orgID, apiID string) ([]*Key, error)
+}
+
+// DragonflyStore stores keys in Dragonfly using the layout:
+//
+//	<prefix>key:<id>               JSON key record
+//	<prefix>lookup:<lookup>        key id
+//	<prefix>index:<org>:<api>      set of key ids issued for an API
+type DragonflyStore struct {
+	client *dragonfly.Client
+	prefix string
+}
+
+// NewDragonflyStore creates a key store backed by a Dragonfly client
+func NewDragonflyStore(client *dragonfly.Client, prefix string) *DragonflyStore {
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return &DragonflyStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Save writes the key record, its lookup entry and its API index membership
+func (s *DragonflyStore) Save(ctx context.Context, key *Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, s.recordKey(key.ID), data, 0)
+	pipe.Set(ctx, s.lookupKey(key.Lookup), key.ID, 0)
+	if key.ExpiresAt != nil {
+		pipe.ExpireAt(ctx, s.recordKey(key.ID), *key.ExpiresAt)
+		pipe.ExpireAt(ctx, s.lookupKey(key.Lookup), *key.ExpiresAt)
+	}
+	pipe.SAdd(ctx, s.indexKey(key.OrgID, key.APIID), key.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return dragonfly.WrapError(err, "failed to save api key")
+	}
+	return nil
+}
+
+// GetByID returns a key record by ID
+func (s *DragonflyStore) GetByID(ctx context.Context, id string) (*Key, error) {
+	data, err := s.client.Client().Get(ctx, s.recordKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to get api key")
+	}
+
+	var key Key
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key: %w", err)
+	}
+	return &key, nil
+}
+
+// GetByLookup returns the key record stored under a lookup value
+func (s *DragonflyStore) GetByLookup(ctx context.Context, lookup string) (*Key, error) {
+	id, err := s.client.Client().Get(ctx, s.lookupKey(lookup)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to resolve api key")
+	}
+	return s.GetByID(ctx, id)
+}
+
+// Delete removes a key record and its lookup entry
+func (s *DragonflyStore) Delete(ctx context.Context, id string) error {
+	key, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, s.recordKey(key.ID), s.lookupKey(key.Lookup))
+	pipe.SRem(ctx, s.indexKey(key.OrgID, key.APIID), key.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return dragonfly.WrapError(err, "failed to delete api key")
+	}
+	return nil
+}
+
+// List returns every live key issued for an API
+func (s *DragonflyStore) List(ctx context.Context, orgID, apiID string) ([]*Key, error) {
+	ids, err := s.client.Client().SMembers(ctx, s.indexKey(orgID, apiID)).Result()
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to list api keys")
+	}
+
+	keys := make([]*Key, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.GetByID(ctx, id)
+		if errors.Is(err, ErrKeyNotFound) {
+			// Expired records leave a stale index entry behind
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *DragonflyStore) recordKey(id string) string {
+	return s.prefix + "key:" + id
+}
+
+func (s *DragonflyStore) lookupKey(lookup string) string {
+	return s.prefix + "lookup:" + lookup
+}
+
+func (s *DragonflyStore) indexKey(orgID, apiID string) string {
+	return s.prefix + "index:" + orgID + ":" + apiID
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Principal is the authenticated identity of a caller
+type Principal struct {
+	ID     string                    `json:"id"`
+	OrgID  string                    `json:"org_id,omitempty"`
+	APIID  string                    `json:"api_id,omitempty"`
+	Method apidef.AuthenticationType `json:"method"`
+	// Methods lists every method that authenticated the caller when the
+	// principal was produced by a Chain
+	Methods  []apidef.AuthenticationType `json:"methods,omitempty"`
+	Policies []string                    `json:"policies,omitempty"`
+	Scopes   []string                    `json:"scopes,omitempty"`
+	Claims   map[string]interface{}      `json:"claims,omitempty"`
+	Metadata map[string]string           `json:"metadata,omitempty"`
+
+	// authenticated records the chain links that produced the principal,
+	// so only they forward the request
+	authenticated []authenticatedLink
+}
+
+// Key returns a stable identifier of the caller for rate limiting and
+// analytics. It is derived from the method that established the ID, so
+// the same caller keeps its key whichever way a chain authenticated it.
+func (p *Principal) Key() string {
+	method := p.Method
+	if len(p.Methods) > 0 {
+		method = p.Methods[0]
+	}
+	return string(method) + ":" + p.ID
+}
+
+// Authenticator verifies the credentials carried by a request
+type Authenticator interface {
+	// Authenticate returns the caller's principal, or an *Error describing
+	// why the request is not authenticated
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Forwarder is implemented by authenticators that adjust the request sent
+// upstream once it is authenticated, such as stripping credentials or
+// forwarding claims as headers
+type Forwarder interface {
+	Forward(r *http.Request, principal *Principal)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate implements Authenticator
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// Middleware authenticates every request and attaches the principal to its
+// context. Unauthenticated requests are rejected with WriteError.
+func Middleware(authenticator Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticator.Authenticate(r)
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+
+			r = r.WithContext(WithPrincipal(r.Context(), principal))
+			if forwarder, ok := authenticator.(Forwarder); ok {
+				forwarder.Forward(r, principal)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteError writes an authentication error as a JSON response, including
+// the WWW-Authenticate challenge when the error carries one
+func WriteError(w http.ResponseWriter, err error) {
+	var authErr *Error
+	if !errors.As(err, &authErr) {
+		authErr = &Error{
+			Status:  http.StatusInternalServerError,
+			Code:    "AUTH_ERROR",
+			Message: "authentication failed",
+			Cause:   err,
+		}
+	}
+
+	if authErr.Challenge != "" {
+		w.Header().Set("WWW-Authenticate", authErr.Challenge)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(authErr.Status)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":      authErr.Message,
+		"error_code": authErr.Code,
+	})
+}
+
+// Context helpers
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of the current request
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
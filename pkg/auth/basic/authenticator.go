@@ -0,0 +1,106 @@
+package basic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+)
+
+// DefaultRealm is used when the config has no realm
+const DefaultRealm = "Restricted"
+
+// Authenticator validates HTTP basic credentials against a CredentialStore
+type Authenticator struct {
+	config *apidef.BasicAuthConfig
+	store  CredentialStore
+	realm  string
+}
+
+// NewAuthenticator creates a basic auth authenticator
+func NewAuthenticator(config *apidef.BasicAuthConfig, store CredentialStore) (*Authenticator, error) {
+	if config == nil {
+		return nil, fmt.Errorf("basic auth config cannot be nil")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("credential store cannot be nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid basic auth config: %w", err)
+	}
+
+	realm := config.Realm
+	if realm == "" {
+		realm = DefaultRealm
+	}
+
+	return &Authenticator{
+		config: config,
+		store:  store,
+		realm:  realm,
+	}, nil
+}
+
+// Authenticate implements auth.Authenticator
+func (a *Authenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, a.unauthorized("MISSING_CREDENTIALS", "basic credentials are required", auth.ErrMissingCredentials)
+	}
+
+	credential, err := a.store.Lookup(r.Context(), username)
+	if errors.Is(err, ErrUserNotFound) {
+		// Spend the same time as a real comparison so usernames cannot be probed
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, a.unauthorized("INVALID_CREDENTIALS", "invalid username or password", auth.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !credential.Check(password) {
+		return nil, a.unauthorized("INVALID_CREDENTIALS", "invalid username or password", auth.ErrInvalidCredentials)
+	}
+
+	return &auth.Principal{
+		ID:       credential.Username,
+		Method:   apidef.AuthBasic,
+		Policies: credential.Policies,
+		Metadata: credential.Metadata,
+	}, nil
+}
+
+// Middleware authenticates requests and attaches the principal to the context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return auth.Middleware(a)(next)
+}
+
+// Forward implements auth.Forwarder. With HideCredentials the Authorization
+// header is removed so the password never reaches the upstream.
+func (a *Authenticator) Forward(r *http.Request, _ *auth.Principal) {
+	if a.config.HideCredentials {
+		r.Header.Del("Authorization")
+	}
+}
+
+func (a *Authenticator) unauthorized(code, message string, cause error) *auth.Error {
+	return auth.Unauthorized(code, message, cause).
+		WithChallenge(fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, a.realm))
+}
+
+var (
+	dummyOnce sync.Once
+	dummy     []byte
+)
+
+func dummyHash() []byte {
+	dummyOnce.Do(func() {
+		dummy, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	})
+	return dummy
+}
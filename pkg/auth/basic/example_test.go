@@ -0,0 +1,111 @@
+package basic_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth/basic"
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+	"github.com/vzahanych/gochoreo/pkg/vault"
+)
+
+// ExampleAuthenticator demonstrates htpasswd-backed basic auth that hides credentials from the upstream
+func ExampleAuthenticator() {
+	hash, err := bcrypt.GenerateFromPassword([]byte("open-sesame"), bcrypt.MinCost)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "htpasswd")
+	if err != nil {
+		log.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".htpasswd")
+	if err := os.WriteFile(path, []byte("# gateway users\nalice:"+string(hash)+"\n"), 0o600); err != nil {
+		log.Fatalf("Failed to write htpasswd: %v", err)
+	}
+
+	store, err := basic.NewFileStore(path)
+	if err != nil {
+		log.Fatalf("Failed to load htpasswd: %v", err)
+	}
+
+	authenticator, err := basic.NewAuthenticator(&apidef.BasicAuthConfig{
+		Realm:           "orders",
+		HideCredentials: true,
+	}, store)
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Printf("upstream Authorization header: %q\n", r.Header.Get("Authorization"))
+	}))
+
+	for _, password := range []string{"open-sesame", "guess"} {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.SetBasicAuth("alice", password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Println(strings.TrimSpace(fmt.Sprintln(rec.Code, rec.Header().Get("WWW-Authenticate"))))
+	}
+
+	// Output:
+	// upstream Authorization header: ""
+	// 200
+	// 401 Basic realm="orders", charset="UTF-8"
+}
+
+// ExampleNewPostgresStore shows reading credentials from a Postgres table
+func ExampleNewPostgresStore() {
+	ctx := context.Background()
+
+	client, err := postgres.New(ctx, postgres.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	defer client.Close()
+
+	store, err := basic.NewPostgresStore(client, "")
+	if err != nil {
+		log.Fatalf("Failed to create store: %v", err)
+	}
+	if err := store.CreateSchema(ctx); err != nil {
+		log.Fatalf("Failed to create schema: %v", err)
+	}
+
+	authenticator, err := basic.NewAuthenticator(&apidef.BasicAuthConfig{Realm: "admin"}, store)
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+	http.Handle("/admin/", authenticator.Middleware(http.NotFoundHandler()))
+}
+
+// ExampleNewVaultStore shows reading credentials from Vault KV
+func ExampleNewVaultStore() {
+	client, err := vault.New(context.Background(), vault.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to vault: %v", err)
+	}
+	defer client.Close()
+
+	authenticator, err := basic.NewAuthenticator(
+		&apidef.BasicAuthConfig{Realm: "partners", HideCredentials: true},
+		basic.NewVaultStore(client, "secret/data/gateway/partners"),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+	http.Handle("/partners/", authenticator.Middleware(http.NotFoundHandler()))
+}
@@ -0,0 +1,74 @@
+package basic
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FileStore reads credentials from an htpasswd file with bcrypt hashes,
+// as produced by "htpasswd -B"
+type FileStore struct {
+	path  string
+	mu    sync.RWMutex
+	users map[string]string
+}
+
+// NewFileStore loads an htpasswd file
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads the file, keeping the previous users if it is invalid
+func (s *FileStore) Reload() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open htpasswd file: %w", err)
+	}
+	defer file.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(text, ":")
+		if !ok || username == "" {
+			return fmt.Errorf("%s:%d: %w", s.path, line, ErrMalformedEntry)
+		}
+		if !isBcrypt(hash) {
+			return fmt.Errorf("%s:%d: %w", s.path, line, ErrUnsupportedHash)
+		}
+		users[username] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+	return nil
+}
+
+// Lookup implements CredentialStore
+func (s *FileStore) Lookup(_ context.Context, username string) (*Credential, error) {
+	s.mu.RLock()
+	hash, ok := s.users[username]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &Credential{Username: username, PasswordHash: hash}, nil
+}
@@ -0,0 +1,81 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+)
+
+// DefaultTable is the table queried by PostgresStore
+const DefaultTable = "basic_auth_credentials"
+
+// PostgresStore reads credentials from a Postgres table
+type PostgresStore struct {
+	client *postgres.Client
+	table  string
+}
+
+// NewPostgresStore creates a credential store over the given table
+func NewPostgresStore(client *postgres.Client, table string) (*PostgresStore, error) {
+	if table == "" {
+		table = DefaultTable
+	}
+	if !postgres.ValidTableName(table) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTableName, table)
+	}
+	return &PostgresStore{
+		client: client,
+		table:  table,
+	}, nil
+}
+
+// CreateSchema creates the credential table if it does not exist
+func (s *PostgresStore) CreateSchema(ctx context.Context) error {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		username      TEXT PRIMARY KEY,
+		password_hash TEXT NOT NULL,
+		policies      TEXT[] NOT NULL DEFAULT '{}',
+		metadata      JSONB NOT NULL DEFAULT '{}',
+		disabled      BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`, s.table)
+
+	if _, err := s.client.Execute(ctx, query); err != nil {
+		return fmt.Errorf("failed to create credential table: %w", err)
+	}
+	return nil
+}
+
+// Lookup implements CredentialStore. Disabled users are reported as missing.
+func (s *PostgresStore) Lookup(ctx context.Context, username string) (*Credential, error) {
+	query := fmt.Sprintf(
+		`SELECT password_hash, policies, metadata FROM %s WHERE username = $1 AND NOT disabled`,
+		s.table,
+	)
+
+	credential := &Credential{Username: username}
+	var metadata map[string]interface{}
+	err := s.client.QueryRow(ctx, query, username).
+		Scan(&credential.PasswordHash, &credential.Policies, &metadata)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up credential: %w", err)
+	}
+	if metadata != nil {
+		credential.Metadata = make(map[string]string, len(metadata))
+		for k, v := range metadata {
+			credential.Metadata[k] = fmt.Sprint(v)
+		}
+	}
+
+	if !isBcrypt(credential.PasswordHash) {
+		return nil, ErrUnsupportedHash
+	}
+	return credential, nil
+}
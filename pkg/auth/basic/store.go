@@ -0,0 +1,57 @@
+package basic
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Common credential store errors
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUnsupportedHash  = errors.New("unsupported password hash, only bcrypt is accepted")
+	ErrInvalidTableName = errors.New("invalid table name")
+	ErrMalformedEntry   = errors.New("malformed credential entry")
+)
+
+// Credential is a stored user record
+type Credential struct {
+	Username string
+	// PasswordHash is a bcrypt hash of the password
+	PasswordHash string
+	// Password is a plaintext password, only used by stores that keep
+	// secrets encrypted at rest such as Vault
+	Password string
+	Policies []string
+	Metadata map[string]string
+}
+
+// Check reports whether password matches the credential
+func (c *Credential) Check(password string) bool {
+	if c.PasswordHash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(c.PasswordHash), []byte(password)) == nil
+	}
+	if c.Password != "" {
+		return subtle.ConstantTimeCompare([]byte(c.Password), []byte(password)) == 1
+	}
+	return false
+}
+
+// CredentialStore looks up credentials by username
+type CredentialStore interface {
+	// Lookup returns ErrUserNotFound when the user does not exist
+	Lookup(ctx context.Context, username string) (*Credential, error)
+}
+
+// isBcrypt reports whether hash uses one of the bcrypt prefixes
+func isBcrypt(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vzahanych/gochoreo/pkg/vault"
+)
+
+// DefaultVaultPath is the KV path under which VaultStore reads one secret per user
+const DefaultVaultPath = "secret/data/gateway/basic-auth"
+
+// VaultStore reads credentials from Vault KV. Each user is a secret at
+// <path>/<username> holding either "password_hash" (bcrypt) or "password",
+// plus optional "policies" (comma separated) and "metadata" entries.
+type VaultStore struct {
+	client *vault.Client
+	path   string
+}
+
+// NewVaultStore creates a credential store backed by a Vault client
+func NewVaultStore(client *vault.Client, path string) *VaultStore {
+	if path == "" {
+		path = DefaultVaultPath
+	}
+	return &VaultStore{
+		client: client,
+		path:   strings.TrimSuffix(path, "/"),
+	}
+}
+
+// Lookup implements CredentialStore
+func (s *VaultStore) Lookup(ctx context.Context, username string) (*Credential, error) {
+	// Usernames become path segments, so they must not traverse the KV tree
+	if username == "" || strings.ContainsAny(username, "/\\") || username == "." || username == ".." {
+		return nil, ErrUserNotFound
+	}
+
+	secret, err := s.client.GetSecret(ctx, s.path+"/"+username)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential from vault: %w", err)
+	}
+
+	credential := &Credential{Username: username}
+	if hash, ok := secret.Data["password_hash"].(string); ok {
+		if !isBcrypt(hash) {
+			return nil, ErrUnsupportedHash
+		}
+		credential.PasswordHash = hash
+	} else if password, ok := secret.Data["password"].(string); ok {
+		credential.Password = password
+	} else {
+		return nil, ErrMalformedEntry
+	}
+
+	if policies, ok := secret.Data["policies"].(string); ok {
+		for _, policy := range strings.Split(policies, ",") {
+			if policy = strings.TrimSpace(policy); policy != "" {
+				credential.Policies = append(credential.Policies, policy)
+			}
+		}
+	}
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		credential.Metadata = make(map[string]string, len(metadata))
+		for k, v := range metadata {
+			credential.Metadata[k] = fmt.Sprint(v)
+		}
+	}
+	return credential, nil
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Factory builds the authenticator for a single, non-multi auth config
+type Factory func(config *apidef.AuthConfig) (Authenticator, error)
+
+// Link is one method of a Chain
+type Link struct {
+	Method        apidef.AuthenticationType
+	Authenticator Authenticator
+}
+
+// Chain composes several authenticators. In "any" mode the first method
+// that succeeds authenticates the caller; in "all" mode every method must
+// succeed and their principals are merged.
+type Chain struct {
+	mode  apidef.MultiAuthMode
+	links []Link
+}
+
+// NewChain creates a chain over the given links, tried in order
+func NewChain(mode apidef.MultiAuthMode, links ...Link) (*Chain, error) {
+	if mode == "" {
+		mode = apidef.MultiAuthAny
+	}
+	if mode != apidef.MultiAuthAny && mode != apidef.MultiAuthAll {
+		return nil, fmt.Errorf("unsupported multi auth mode: %s", mode)
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("auth chain requires at least one method")
+	}
+	return &Chain{
+		mode:  mode,
+		links: links,
+	}, nil
+}
+
+// BuildChain creates a chain from a multi auth config, building nested
+// methods with factory. Nested multi configs become nested chains.
+func BuildChain(config *apidef.AuthConfig, factory Factory) (*Chain, error) {
+	if config == nil || config.Type != apidef.AuthMulti {
+		return nil, fmt.Errorf("auth chain requires a %s auth config", apidef.AuthMulti)
+	}
+
+	links := make([]Link, 0, len(config.MultiConfig))
+	for i := range config.MultiConfig {
+		nested := &config.MultiConfig[i]
+
+		var authenticator Authenticator
+		var err error
+		if nested.Type == apidef.AuthMulti {
+			authenticator, err = BuildChain(nested, factory)
+		} else {
+			authenticator, err = factory(nested)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s authenticator at multi_config[%d]: %w", nested.Type, i, err)
+		}
+
+		links = append(links, Link{Method: nested.Type, Authenticator: authenticator})
+	}
+
+	return NewChain(config.MultiMode, links...)
+}
+
+// Mode returns the chain's composition mode
+func (c *Chain) Mode() apidef.MultiAuthMode {
+	return c.mode
+}
+
+// Authenticate implements Authenticator
+func (c *Chain) Authenticate(r *http.Request) (*Principal, error) {
+	if c.mode == apidef.MultiAuthAll {
+		return c.authenticateAll(r)
+	}
+	return c.authenticateAny(r)
+}
+
+// Forward implements Forwarder by forwarding through every link that
+// authenticated the caller, each with the principal it produced. Nested
+// chains forward through their own links in turn.
+func (c *Chain) Forward(r *http.Request, principal *Principal) {
+	for _, authenticated := range principal.authenticated {
+		if authenticated.chain != c {
+			continue
+		}
+		link := c.links[authenticated.index]
+		if forwarder, ok := link.Authenticator.(Forwarder); ok {
+			forwarder.Forward(r, authenticated.principal)
+		}
+	}
+}
+
+// Internal methods
+
+// authenticatedLink is a link of a chain that authenticated a caller
+type authenticatedLink struct {
+	chain     *Chain
+	index     int
+	principal *Principal
+}
+
+func (c *Chain) authenticateAny(r *http.Request) (*Principal, error) {
+	var rejected, failed, missing error
+	var challenges []string
+
+	for i, link := range c.links {
+		principal, err := link.Authenticator.Authenticate(r)
+		if err == nil {
+			unified := merge(apidef.MultiAuthAny, []*Principal{principal}, []apidef.AuthenticationType{link.Method})
+			unified.authenticated = []authenticatedLink{{chain: c, index: i, principal: principal}}
+			return unified, nil
+		}
+
+		var authErr *Error
+		switch {
+		case !errors.As(err, &authErr):
+			// Infrastructure failures must not hide a later method that succeeds
+			if failed == nil {
+				failed = err
+			}
+		case errors.Is(err, ErrMissingCredentials):
+			if missing == nil {
+				missing = err
+			}
+		default:
+			if rejected == nil {
+				rejected = err
+			}
+		}
+		if authErr != nil && authErr.Challenge != "" {
+			challenges = append(challenges, authErr.Challenge)
+		}
+	}
+
+	// Report the most useful failure: credentials that were presented but
+	// rejected, then backend failures, then the absence of credentials
+	for _, err := range []error{rejected, failed, missing} {
+		if err != nil {
+			return nil, withChallenges(err, challenges)
+		}
+	}
+	return nil, Unauthorized("UNAUTHENTICATED", "authentication required", ErrMissingCredentials)
+}
+
+func (c *Chain) authenticateAll(r *http.Request) (*Principal, error) {
+	principals := make([]*Principal, 0, len(c.links))
+	methods := make([]apidef.AuthenticationType, 0, len(c.links))
+	authenticated := make([]authenticatedLink, 0, len(c.links))
+
+	for i, link := range c.links {
+		principal, err := link.Authenticator.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, principal)
+		methods = append(methods, link.Method)
+		authenticated = append(authenticated, authenticatedLink{chain: c, index: i, principal: principal})
+	}
+
+	unified := merge(apidef.MultiAuthAll, principals, methods)
+	unified.authenticated = authenticated
+	return unified, nil
+}
+
+// merge builds the unified principal. Identity comes from the first
+// principal; policies and scopes are unioned; claims and metadata keep
+// the first value seen for each key.
+func merge(mode apidef.MultiAuthMode, principals []*Principal, methods []apidef.AuthenticationType) *Principal {
+	first := principals[0]
+	unified := &Principal{
+		ID:     first.ID,
+		OrgID:  first.OrgID,
+		APIID:  first.APIID,
+		Method: first.Method,
+	}
+	if mode == apidef.MultiAuthAll {
+		unified.Method = apidef.AuthMulti
+	}
+
+	for i, principal := range principals {
+		// Nested chains contribute the methods they used themselves
+		if len(principal.Methods) > 0 {
+			unified.Methods = append(unified.Methods, principal.Methods...)
+		} else {
+			unified.Methods = append(unified.Methods, methods[i])
+		}
+
+		if unified.OrgID == "" {
+			unified.OrgID = principal.OrgID
+		}
+		if unified.APIID == "" {
+			unified.APIID = principal.APIID
+		}
+		unified.Policies = union(unified.Policies, principal.Policies)
+		unified.Scopes = union(unified.Scopes, principal.Scopes)
+
+		for k, v := range principal.Claims {
+			if unified.Claims == nil {
+				unified.Claims = make(map[string]interface{})
+			}
+			if _, ok := unified.Claims[k]; !ok {
+				unified.Claims[k] = v
+			}
+		}
+		for k, v := range principal.Metadata {
+			if unified.Metadata == nil {
+				unified.Metadata = make(map[string]string)
+			}
+			if _, ok := unified.Metadata[k]; !ok {
+				unified.Metadata[k] = v
+			}
+		}
+	}
+	return unified
+}
+
+func union(a, b []string) []string {
+	for _, v := range b {
+		if !slices.Contains(a, v) {
+			a = append(a, v)
+		}
+	}
+	return a
+}
+
+// withChallenges advertises every method's challenge on the returned error
+func withChallenges(err error, challenges []string) error {
+	var authErr *Error
+	if len(challenges) == 0 || !errors.As(err, &authErr) {
+		return err
+	}
+	combined := *authErr
+	combined.Challenge = strings.Join(challenges, ", ")
+	return &combined
+}
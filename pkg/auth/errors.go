@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Common authentication errors
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrExpiredCredentials = errors.New("credentials have expired")
+	ErrForbidden          = errors.New("access forbidden")
+)
+
+// Error is an authentication failure that maps onto an HTTP response
+type Error struct {
+	Status    int    // HTTP status code
+	Code      string // machine readable error code
+	Message   string // message safe to return to the caller
+	Challenge string // WWW-Authenticate header value, if any
+	Cause     error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Unauthorized creates a 401 error
+func Unauthorized(code, message string, cause error) *Error {
+	return &Error{
+		Status:  http.StatusUnauthorized,
+		Code:    code,
+		Message: message,
+		Cause:   cause,
+	}
+}
+
+// Forbidden creates a 403 error
+func Forbidden(code, message string, cause error) *Error {
+	return &Error{
+		Status:  http.StatusForbidden,
+		Code:    code,
+		Message: message,
+		Cause:   cause,
+	}
+}
+
+// WithChallenge sets the WWW-Authenticate challenge of the error
+func (e *Error) WithChallenge(challenge string) *Error {
+	e.Challenge = challenge
+	return e
+}
+
+// IsAuthError checks if the error is an authentication error
+func IsAuthError(err error) bool {
+	var authErr *Error
+	return errors.As(err, &authErr)
+}
@@ -0,0 +1,130 @@
+package hmac_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/auth/hmac"
+)
+
+// memoryNonces is a minimal in-memory NonceStore used by the examples
+type memoryNonces struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (m *memoryNonces) Remember(_ context.Context, nonce string, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen[nonce] {
+		return false, nil
+	}
+	m.seen[nonce] = true
+	return true, nil
+}
+
+// ExampleVerifier demonstrates signed service-to-gateway calls with replay protection
+func ExampleVerifier() {
+	config := &apidef.HMACConfig{
+		Algorithm:        "sha256",
+		Header:           "Authorization",
+		SecretKey:        "shared-secret",
+		AllowedClockSkew: time.Minute,
+		Headers:          []string{"host", "digest"},
+	}
+
+	verifier, err := hmac.NewVerifier(config,
+		hmac.WithKeys(map[string]string{"billing-service": "billing-secret"}),
+		hmac.WithNonceStore(&memoryNonces{seen: make(map[string]bool)}),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	gateway := httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s sent %s", principal.ID, body)
+	})))
+	defer gateway.Close()
+
+	// Each service signs with its own secret
+	billing := *config
+	billing.SecretKey = "billing-secret"
+	signer, err := hmac.NewSigner(&billing, "billing-service")
+	if err != nil {
+		log.Fatalf("Failed to create signer: %v", err)
+	}
+	client := &http.Client{Transport: signer.Transport(nil)}
+
+	resp, err := client.Post(gateway.URL+"/invoices", "application/json", strings.NewReader(`{"amount":42}`))
+	if err != nil {
+		log.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	fmt.Println(resp.StatusCode, string(body))
+
+	// Replaying a captured request and tampering with a body both fail
+	req, _ := http.NewRequest(http.MethodPost, gateway.URL+"/invoices", strings.NewReader(`{"amount":42}`))
+	if err := signer.Sign(req); err != nil {
+		log.Fatalf("Failed to sign request: %v", err)
+	}
+	for _, payload := range []string{`{"amount":42}`, `{"amount":42}`, `{"amount":9000}`} {
+		replay := req.Clone(context.Background())
+		replay.Body = io.NopCloser(strings.NewReader(payload))
+		replay.ContentLength = int64(len(payload))
+		resp, err := http.DefaultClient.Do(replay)
+		if err != nil {
+			log.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fmt.Println(resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	// Claiming another service's key ID without its secret fails
+	impostor, err := hmac.NewSigner(&billing, "payroll-service")
+	if err != nil {
+		log.Fatalf("Failed to create signer: %v", err)
+	}
+	req, _ = http.NewRequest(http.MethodGet, gateway.URL+"/invoices", nil)
+	if err := impostor.Sign(req); err != nil {
+		log.Fatalf("Failed to sign request: %v", err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("Request failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	fmt.Println(resp.StatusCode, strings.TrimSpace(string(body)))
+
+	// Output:
+	// 200 billing-service sent {"amount":42}
+	// 200 billing-service sent {"amount":42}
+	// 401 {"error":"request nonce has already been used","error_code":"REPLAYED_REQUEST"}
+	// 401 {"error":"request body does not match its digest","error_code":"INVALID_DIGEST"}
+	// 401 {"error":"request signature key is not known","error_code":"UNKNOWN_KEY"}
+}
+
+// ExampleParseParams shows the signature header format
+func ExampleParseParams() {
+	params, err := hmac.ParseParams(`Signature keyId="svc",algorithm="hmac-sha512",headers="(request-target) date x-nonce",signature="c2lnbmF0dXJl"`)
+	if err != nil {
+		log.Fatalf("Failed to parse params: %v", err)
+	}
+	fmt.Println(params.KeyID, params.Algorithm, params.Headers)
+
+	// Output:
+	// svc hmac-sha512 [(request-target) date x-nonce]
+}
@@ -0,0 +1,44 @@
+package hmac
+
+import (
+	"context"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+)
+
+// DefaultNoncePrefix is the prefix of every key written by DragonflyNonceStore
+const DefaultNoncePrefix = "hmac:nonce:"
+
+// NonceStore remembers nonces that have already been used
+type NonceStore interface {
+	// Remember records a nonce for ttl and reports whether it was unused
+	Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// DragonflyNonceStore keeps the nonce set in Dragonfly so a request
+// replayed against a different gateway node is still rejected
+type DragonflyNonceStore struct {
+	client *dragonfly.Client
+	prefix string
+}
+
+// NewDragonflyNonceStore creates a nonce store backed by a Dragonfly client
+func NewDragonflyNonceStore(client *dragonfly.Client, prefix string) *DragonflyNonceStore {
+	if prefix == "" {
+		prefix = DefaultNoncePrefix
+	}
+	return &DragonflyNonceStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Remember implements NonceStore
+func (s *DragonflyNonceStore) Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	fresh, err := s.client.Client().SetNX(ctx, s.prefix+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, dragonfly.WrapError(err, "failed to record hmac nonce")
+	}
+	return fresh, nil
+}
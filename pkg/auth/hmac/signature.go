@@ -0,0 +1,149 @@
+package hmac
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Signature defaults
+const (
+	DefaultHeader     = "Authorization"
+	DefaultClockSkew  = 5 * time.Minute
+	NonceHeader       = "X-Nonce"
+	DigestHeader      = "Digest"
+	RequestTarget     = "(request-target)"
+	authorizationType = "Signature"
+)
+
+// Common signature errors
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported hmac algorithm")
+	ErrMalformedSignature   = errors.New("malformed signature header")
+)
+
+// algorithms maps configured algorithm names onto hash constructors
+var algorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// ParseAlgorithm normalizes an algorithm such as "sha256" or "hmac-sha256"
+func ParseAlgorithm(name string) (string, func() hash.Hash, error) {
+	normalized := strings.TrimPrefix(strings.ToLower(name), "hmac-")
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	newHash, ok := algorithms[normalized]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, name)
+	}
+	return "hmac-" + normalized, newHash, nil
+}
+
+// Params are the parameters of a signature header:
+//
+//	keyId="svc",algorithm="hmac-sha256",headers="(request-target) date x-nonce",signature="..."
+type Params struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Signature string
+}
+
+// String renders the params in header form
+func (p *Params) String() string {
+	var b strings.Builder
+	if p.KeyID != "" {
+		fmt.Fprintf(&b, "keyId=%q,", p.KeyID)
+	}
+	fmt.Fprintf(&b, "algorithm=%q,headers=%q,signature=%q", p.Algorithm, strings.Join(p.Headers, " "), p.Signature)
+	return b.String()
+}
+
+// ParseParams parses a signature header value. A leading "Signature"
+// scheme, as used in the Authorization header, is ignored.
+func ParseParams(value string) (*Params, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > len(authorizationType) && strings.EqualFold(value[:len(authorizationType)], authorizationType) && value[len(authorizationType)] == ' ' {
+		value = strings.TrimSpace(value[len(authorizationType):])
+	}
+
+	params := &Params{}
+	for value != "" {
+		name, rest, ok := strings.Cut(value, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return nil, ErrMalformedSignature
+		}
+		end := strings.Index(rest[1:], `"`)
+		if end < 0 {
+			return nil, ErrMalformedSignature
+		}
+		param := rest[1 : end+1]
+		value = strings.TrimLeft(rest[end+2:], ", ")
+
+		switch strings.TrimSpace(name) {
+		case "keyId":
+			params.KeyID = param
+		case "algorithm":
+			params.Algorithm = strings.ToLower(param)
+		case "headers":
+			params.Headers = strings.Fields(strings.ToLower(param))
+		case "signature":
+			params.Signature = param
+		}
+	}
+
+	if params.Signature == "" || params.Algorithm == "" || len(params.Headers) == 0 {
+		return nil, ErrMalformedSignature
+	}
+	return params, nil
+}
+
+// signingString builds the canonical string covered by the signature, one
+// "name: value" line per signed header in the order listed
+func signingString(r *http.Request, headers []string) (string, error) {
+	lines := make([]string, 0, len(headers))
+	for _, name := range headers {
+		var value string
+		switch name {
+		case RequestTarget:
+			value = strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "host":
+			value = r.Host
+			if value == "" {
+				value = r.URL.Host
+			}
+		default:
+			values := r.Header.Values(name)
+			if len(values) == 0 {
+				return "", fmt.Errorf("signed header %q is missing", name)
+			}
+			value = strings.Join(values, ", ")
+		}
+		lines = append(lines, name+": "+strings.TrimSpace(value))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// signedHeaders returns the configured headers plus the ones replay
+// protection depends on, lowercased and without duplicates
+func signedHeaders(configured []string) []string {
+	required := []string{RequestTarget, "date", strings.ToLower(NonceHeader)}
+
+	seen := make(map[string]bool)
+	var headers []string
+	for _, name := range append(required, configured...) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			headers = append(headers, name)
+		}
+	}
+	return headers
+}
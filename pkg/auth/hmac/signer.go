@@ -0,0 +1,142 @@
+package hmac
+
+import (
+	"bytes"
+	stdhmac "crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Signer signs outgoing requests so they pass a Verifier using the same config
+type Signer struct {
+	secret    []byte
+	keyID     string
+	algorithm string
+	newHash   func() hash.Hash
+	header    string
+	headers   []string
+}
+
+// NewSigner creates a request signer. keyID is sent with the signature;
+// verifiers using WithKeys look up the secret by it and make it the
+// caller's identity, so config.SecretKey must then be that key's secret.
+func NewSigner(config *apidef.HMACConfig, keyID string) (*Signer, error) {
+	if config == nil {
+		return nil, fmt.Errorf("hmac config cannot be nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid hmac config: %w", err)
+	}
+
+	algorithm, newHash, err := ParseAlgorithm(config.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	header := config.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+
+	return &Signer{
+		secret:    []byte(config.SecretKey),
+		keyID:     keyID,
+		algorithm: algorithm,
+		newHash:   newHash,
+		header:    header,
+		headers:   signedHeaders(config.Headers),
+	}, nil
+}
+
+// Sign adds the Date, nonce, digest and signature headers to a request.
+// An existing Date header is kept.
+func (s *Signer) Sign(r *http.Request) error {
+	if r.Header.Get("Date") == "" {
+		r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	r.Header.Set(NonceHeader, base64.RawURLEncoding.EncodeToString(nonce))
+
+	if slices.Contains(s.headers, "digest") {
+		body, err := readBody(r)
+		if err != nil {
+			return err
+		}
+		r.Header.Set(DigestHeader, bodyDigest(body))
+	}
+
+	payload, err := signingString(r, s.headers)
+	if err != nil {
+		return err
+	}
+
+	mac := stdhmac.New(s.newHash, s.secret)
+	mac.Write([]byte(payload))
+
+	params := &Params{
+		KeyID:     s.keyID,
+		Algorithm: s.algorithm,
+		Headers:   s.headers,
+		Signature: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	}
+
+	value := params.String()
+	if strings.EqualFold(s.header, "Authorization") {
+		value = authorizationType + " " + value
+	}
+	r.Header.Set(s.header, value)
+	return nil
+}
+
+// Transport returns a RoundTripper that signs every request before sending
+// it through base, or http.DefaultTransport when base is nil
+func (s *Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &signingTransport{signer: s, base: base}
+}
+
+type signingTransport struct {
+	signer *Signer
+	base   http.RoundTripper
+}
+
+func (t *signingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	r = r.Clone(r.Context())
+	if err := t.signer.Sign(r); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(r)
+}
+
+// readBody drains the body for digesting and puts it back
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
@@ -0,0 +1,209 @@
+package hmac
+
+import (
+	"bytes"
+	stdhmac "crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+)
+
+const maxDigestBodyBytes = 10 << 20
+
+// Verifier authenticates requests signed according to an apidef.HMACConfig
+type Verifier struct {
+	config    *apidef.HMACConfig
+	algorithm string
+	newHash   func() hash.Hash
+	header    string
+	required  []string
+	skew      time.Duration
+	nonces    NonceStore
+	keys      map[string][]byte
+}
+
+// Option allows customization of the verifier
+type Option func(*Verifier)
+
+// WithNonceStore enables replay protection; see NewDragonflyNonceStore
+func WithNonceStore(store NonceStore) Option {
+	return func(v *Verifier) {
+		v.nonces = store
+	}
+}
+
+// WithKeys gives every caller its own secret, by the keyId of its
+// signatures. Signatures without a keyId or with an unknown one are
+// rejected, and the keyId becomes the caller's identity. Without keys every
+// caller shares the config's secret key and is the same principal, since
+// the keyId is not signed and anyone holding the secret could claim any.
+func WithKeys(keys map[string]string) Option {
+	return func(v *Verifier) {
+		v.keys = make(map[string][]byte, len(keys))
+		for id, secret := range keys {
+			v.keys[id] = []byte(secret)
+		}
+	}
+}
+
+// NewVerifier creates an HMAC signature verifier
+func NewVerifier(config *apidef.HMACConfig, options ...Option) (*Verifier, error) {
+	if config == nil {
+		return nil, fmt.Errorf("hmac config cannot be nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid hmac config: %w", err)
+	}
+
+	algorithm, newHash, err := ParseAlgorithm(config.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verifier{
+		config:    config,
+		algorithm: algorithm,
+		newHash:   newHash,
+		header:    config.Header,
+		required:  signedHeaders(config.Headers),
+		skew:      config.AllowedClockSkew,
+	}
+	if v.header == "" {
+		v.header = DefaultHeader
+	}
+	if v.skew <= 0 {
+		v.skew = DefaultClockSkew
+	}
+
+	for _, option := range options {
+		option(v)
+	}
+
+	return v, nil
+}
+
+// Authenticate implements auth.Authenticator
+func (v *Verifier) Authenticate(r *http.Request) (*auth.Principal, error) {
+	value := r.Header.Get(v.header)
+	if value == "" {
+		return nil, v.unauthorized("MISSING_SIGNATURE", "request signature is required", auth.ErrMissingCredentials)
+	}
+
+	params, err := ParseParams(value)
+	if err != nil {
+		return nil, v.unauthorized("INVALID_SIGNATURE", "request signature is malformed", err)
+	}
+	if params.Algorithm != v.algorithm {
+		return nil, v.unauthorized("INVALID_SIGNATURE", "request signature algorithm is not accepted", ErrUnsupportedAlgorithm)
+	}
+	for _, name := range v.required {
+		if !slices.Contains(params.Headers, name) {
+			return nil, v.unauthorized("INVALID_SIGNATURE", fmt.Sprintf("header %q must be signed", name), auth.ErrInvalidCredentials)
+		}
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return nil, v.unauthorized("INVALID_DATE", "date header is missing or malformed", auth.ErrInvalidCredentials)
+	}
+	if skew := time.Since(date); skew > v.skew || skew < -v.skew {
+		return nil, v.unauthorized("CLOCK_SKEW", "date header is outside the allowed clock skew", auth.ErrExpiredCredentials)
+	}
+
+	id, secret := string(apidef.AuthHMAC), []byte(v.config.SecretKey)
+	if v.keys != nil {
+		var ok bool
+		if secret, ok = v.keys[params.KeyID]; !ok {
+			return nil, v.unauthorized("UNKNOWN_KEY", "request signature key is not known", auth.ErrInvalidCredentials)
+		}
+		id = params.KeyID
+	}
+
+	payload, err := signingString(r, params.Headers)
+	if err != nil {
+		return nil, v.unauthorized("INVALID_SIGNATURE", err.Error(), auth.ErrInvalidCredentials)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params.Signature)
+	if err != nil || !stdhmac.Equal(signature, v.sign(secret, payload)) {
+		return nil, v.unauthorized("INVALID_SIGNATURE", "request signature does not match", auth.ErrInvalidCredentials)
+	}
+
+	if slices.Contains(params.Headers, "digest") {
+		if err := verifyDigest(r); err != nil {
+			return nil, v.unauthorized("INVALID_DIGEST", "request body does not match its digest", err)
+		}
+	}
+
+	// The nonce is checked last so unauthenticated requests cannot burn nonces
+	if v.nonces != nil {
+		fresh, err := v.nonces.Remember(r.Context(), r.Header.Get(NonceHeader), 2*v.skew)
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			return nil, v.unauthorized("REPLAYED_REQUEST", "request nonce has already been used", auth.ErrInvalidCredentials)
+		}
+	}
+
+	return &auth.Principal{
+		ID:     id,
+		Method: apidef.AuthHMAC,
+	}, nil
+}
+
+// Middleware authenticates requests and attaches the principal to the context
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return auth.Middleware(v)(next)
+}
+
+// Internal methods
+
+func (v *Verifier) sign(secret []byte, payload string) []byte {
+	mac := stdhmac.New(v.newHash, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (v *Verifier) unauthorized(code, message string, cause error) *auth.Error {
+	return auth.Unauthorized(code, message, cause).
+		WithChallenge(fmt.Sprintf(`%s algorithm=%q, headers=%q`, authorizationType, v.algorithm, strings.Join(v.required, " ")))
+}
+
+// verifyDigest checks a "SHA-256=<base64>" digest against the request body,
+// restoring the body for downstream handlers
+func verifyDigest(r *http.Request) error {
+	var body []byte
+	if r.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxDigestBodyBytes+1))
+		r.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		if len(data) > maxDigestBodyBytes {
+			return fmt.Errorf("body exceeds %d bytes", maxDigestBodyBytes)
+		}
+		body = data
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.Header.Get(DigestHeader) != bodyDigest(body) {
+		return fmt.Errorf("digest mismatch")
+	}
+	return nil
+}
+
+// bodyDigest returns an RFC 3230 SHA-256 digest header value
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
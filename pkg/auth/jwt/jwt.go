@@ -0,0 +1,278 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	josejwt "github.com/go-jose/go-jose/v4/jwt"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+)
+
+// Authenticator defaults
+const (
+	DefaultIdentityKey = "sub"
+	DefaultLeeway      = 30 * time.Second
+	DefaultJWKSTimeout = 5 * time.Second
+)
+
+// Registered claim checks that can be listed in JWTConfig.SkipValidation
+const (
+	CheckExpiry    = "exp"
+	CheckNotBefore = "nbf"
+	CheckIssuedAt  = "iat"
+	CheckIssuer    = "iss"
+	CheckAudience  = "aud"
+)
+
+// Authenticator validates bearer JWTs according to an apidef.JWTConfig
+type Authenticator struct {
+	config    *apidef.JWTConfig
+	algorithm jose.SignatureAlgorithm
+	keys      keySource
+	skip      map[string]bool
+	leeway    time.Duration
+	client    *http.Client
+	refresh   time.Duration
+}
+
+// Option allows customization of the authenticator
+type Option func(*Authenticator)
+
+// WithHTTPClient sets the client used to fetch JWKS documents
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *Authenticator) {
+		a.client = client
+	}
+}
+
+// WithLeeway sets the clock skew tolerated on exp, nbf and iat
+func WithLeeway(leeway time.Duration) Option {
+	return func(a *Authenticator) {
+		a.leeway = leeway
+	}
+}
+
+// WithJWKSRefresh sets how long a fetched JWKS is trusted before refetching
+func WithJWKSRefresh(interval time.Duration) Option {
+	return func(a *Authenticator) {
+		a.refresh = interval
+	}
+}
+
+// NewAuthenticator creates a JWT authenticator. SigningKey holds an HMAC
+// secret for HS methods, a PEM public key, certificate or file path for
+// RS/PS/ES/EdDSA methods, or a JWKS URL for any asymmetric method.
+func NewAuthenticator(config *apidef.JWTConfig, options ...Option) (*Authenticator, error) {
+	if config == nil {
+		return nil, fmt.Errorf("jwt config cannot be nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid jwt config: %w", err)
+	}
+
+	algorithm, err := ParseSigningMethod(config.SigningMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{
+		config:    config,
+		algorithm: algorithm,
+		skip:      make(map[string]bool, len(config.SkipValidation)),
+		leeway:    DefaultLeeway,
+		client:    &http.Client{Timeout: DefaultJWKSTimeout},
+	}
+
+	for _, option := range options {
+		option(a)
+	}
+
+	for _, check := range config.SkipValidation {
+		switch check = strings.ToLower(check); check {
+		case CheckExpiry, CheckNotBefore, CheckIssuedAt, CheckIssuer, CheckAudience:
+			a.skip[check] = true
+		default:
+			return nil, fmt.Errorf("invalid jwt config: unknown skip_validation check %q", check)
+		}
+	}
+
+	a.keys, err = newKeySource(algorithm, config.SigningKey, a.client, a.refresh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt signing key: %w", err)
+	}
+
+	return a, nil
+}
+
+// Authenticate implements auth.Authenticator
+func (a *Authenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	raw := bearerToken(r)
+	if raw == "" {
+		return nil, auth.Unauthorized("MISSING_TOKEN", "bearer token is required", auth.ErrMissingCredentials).
+			WithChallenge(`Bearer`)
+	}
+
+	token, err := josejwt.ParseSigned(raw, []jose.SignatureAlgorithm{a.algorithm})
+	if err != nil {
+		return nil, invalidToken("token is malformed or uses an unexpected signing method", err)
+	}
+
+	key, err := a.keys.Key(r.Context(), token.Headers[0])
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, invalidToken("token signing key is unknown", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var registered josejwt.Claims
+	claims := make(map[string]interface{})
+	if err := token.Claims(key, &registered, &claims); err != nil {
+		return nil, invalidToken("token signature is invalid", err)
+	}
+
+	if err := a.validate(&registered, claims); err != nil {
+		return nil, err
+	}
+
+	identityKey := a.config.IdentityKey
+	if identityKey == "" {
+		identityKey = DefaultIdentityKey
+	}
+	identity := claimString(claims[identityKey])
+	if identity == "" {
+		return nil, invalidToken(fmt.Sprintf("token is missing identity claim %q", identityKey), auth.ErrInvalidCredentials)
+	}
+
+	return &auth.Principal{
+		ID:     identity,
+		Method: apidef.AuthJWT,
+		Scopes: scopes(claims),
+		Claims: claims,
+	}, nil
+}
+
+// Middleware authenticates requests, forwards the configured claims to the
+// upstream as headers and attaches the principal to the context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return auth.Middleware(a)(next)
+}
+
+// Forward implements auth.Forwarder by copying the claims listed in
+// ClaimsToHeaders onto request headers. Client supplied values for those
+// headers are always dropped.
+func (a *Authenticator) Forward(r *http.Request, principal *auth.Principal) {
+	for claim, header := range a.config.ClaimsToHeaders {
+		r.Header.Del(header)
+		if value := claimString(principal.Claims[claim]); value != "" {
+			r.Header.Set(header, value)
+		}
+	}
+}
+
+// Internal methods
+
+// validate checks the registered and required claims
+func (a *Authenticator) validate(registered *josejwt.Claims, claims map[string]interface{}) error {
+	now := time.Now()
+
+	if !a.skip[CheckExpiry] && registered.Expiry != nil && now.After(registered.Expiry.Time().Add(a.leeway)) {
+		return auth.Unauthorized("TOKEN_EXPIRED", "token has expired", auth.ErrExpiredCredentials).
+			WithChallenge(challenge("invalid_token", "token has expired"))
+	}
+	if !a.skip[CheckNotBefore] && registered.NotBefore != nil && now.Add(a.leeway).Before(registered.NotBefore.Time()) {
+		return invalidToken("token is not valid yet", auth.ErrInvalidCredentials)
+	}
+	if !a.skip[CheckIssuedAt] && registered.IssuedAt != nil && now.Add(a.leeway).Before(registered.IssuedAt.Time()) {
+		return invalidToken("token was issued in the future", auth.ErrInvalidCredentials)
+	}
+	if !a.skip[CheckIssuer] && a.config.Issuer != "" && registered.Issuer != a.config.Issuer {
+		return invalidToken("token issuer is not accepted", auth.ErrInvalidCredentials)
+	}
+	if !a.skip[CheckAudience] && len(a.config.Audience) > 0 && !audienceMatches(registered.Audience, a.config.Audience) {
+		return invalidToken("token audience is not accepted", auth.ErrInvalidCredentials)
+	}
+
+	for _, name := range a.config.RequiredClaims {
+		if value, ok := claims[name]; !ok || value == nil {
+			return invalidToken(fmt.Sprintf("token is missing required claim %q", name), auth.ErrInvalidCredentials)
+		}
+	}
+	return nil
+}
+
+func audienceMatches(audience josejwt.Audience, accepted []string) bool {
+	for _, aud := range accepted {
+		if audience.Contains(aud) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopes reads OAuth2 style scopes from the scope or scp claim
+func scopes(claims map[string]interface{}) []string {
+	if value, ok := claims["scope"].(string); ok {
+		return strings.Fields(value)
+	}
+	switch value := claims["scp"].(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// claimString renders a claim value as a header-safe string
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, claimString(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func invalidToken(message string, cause error) *auth.Error {
+	return auth.Unauthorized("INVALID_TOKEN", message, cause).
+		WithChallenge(challenge("invalid_token", message))
+}
+
+// challenge formats an RFC 6750 Bearer challenge
+func challenge(code, description string) string {
+	return fmt.Sprintf(`Bearer error=%q, error_description=%q`, code, description)
+}
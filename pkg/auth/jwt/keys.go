@@ -0,0 +1,303 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"golang.org/x/sync/singleflight"
+)
+
+// Key source defaults
+const (
+	DefaultJWKSRefreshInterval = 5 * time.Minute
+	DefaultJWKSMinRefresh      = 10 * time.Second
+	maxJWKSBytes               = 1 << 20
+)
+
+// Common key errors
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing method")
+	ErrUnknownKey           = errors.New("no signing key matches the token")
+	ErrKeyTypeMismatch      = errors.New("signing key type does not match signing method")
+)
+
+// keySource resolves the verification key for a token header
+type keySource interface {
+	Key(ctx context.Context, header jose.Header) (interface{}, error)
+}
+
+// staticKey verifies every token with one configured key
+type staticKey struct {
+	key interface{}
+}
+
+func (s *staticKey) Key(_ context.Context, _ jose.Header) (interface{}, error) {
+	return s.key, nil
+}
+
+// algorithmFamilies maps each supported signing method onto its key family
+var algorithmFamilies = map[jose.SignatureAlgorithm]string{
+	jose.HS256: "HS", jose.HS384: "HS", jose.HS512: "HS",
+	jose.RS256: "RS", jose.RS384: "RS", jose.RS512: "RS",
+	jose.PS256: "RS", jose.PS384: "RS", jose.PS512: "RS",
+	jose.ES256: "ES", jose.ES384: "ES", jose.ES512: "ES",
+	jose.EdDSA: "EdDSA",
+}
+
+// ParseSigningMethod validates a signing method name such as "RS256" or "EdDSA"
+func ParseSigningMethod(method string) (jose.SignatureAlgorithm, error) {
+	for alg := range algorithmFamilies {
+		if strings.EqualFold(string(alg), method) {
+			return alg, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, method)
+}
+
+// newKeySource builds the key source described by a signing key. The key
+// may be an HMAC secret, PEM content, a path to a PEM file or a JWKS URL.
+// HMAC secrets are taken as is, even when they look like a URL.
+func newKeySource(alg jose.SignatureAlgorithm, signingKey string, client *http.Client, refresh time.Duration) (keySource, error) {
+	if algorithmFamilies[alg] == "HS" {
+		return &staticKey{key: []byte(signingKey)}, nil
+	}
+
+	if isURL(signingKey) {
+		return newJWKS(signingKey, client, refresh), nil
+	}
+
+	key, err := ParsePublicKey(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeyType(alg, key); err != nil {
+		return nil, err
+	}
+	return &staticKey{key: key}, nil
+}
+
+// ParsePublicKey parses a PEM encoded public key or certificate, given
+// either as PEM content or as a path to a PEM file
+func ParsePublicKey(value string) (interface{}, error) {
+	data := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		content, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		data = content
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA public key: %w", err)
+		}
+		return key, nil
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil
+	}
+}
+
+// checkKeyType ensures a key can verify the given algorithm
+func checkKeyType(alg jose.SignatureAlgorithm, key interface{}) error {
+	var ok bool
+	switch algorithmFamilies[alg] {
+	case "HS":
+		_, ok = key.([]byte)
+	case "RS":
+		_, ok = key.(*rsa.PublicKey)
+	case "ES":
+		_, ok = key.(*ecdsa.PublicKey)
+	case "EdDSA":
+		_, ok = key.(ed25519.PublicKey)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s cannot be verified with %T", ErrKeyTypeMismatch, alg, key)
+	}
+	return nil
+}
+
+// jwks fetches and caches a remote JSON Web Key Set. Unknown key IDs
+// trigger a refresh, rate limited so forged kids cannot hammer the issuer.
+// Fetches run outside the lock and are shared by concurrent callers, and a
+// stale set keeps being served while it is refreshed in the background.
+type jwks struct {
+	url        string
+	client     *http.Client
+	refresh    time.Duration
+	minRefresh time.Duration
+
+	group      singleflight.Group
+	refreshing atomic.Bool
+
+	mu          sync.RWMutex
+	keys        jose.JSONWebKeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	err         error
+}
+
+func newJWKS(url string, client *http.Client, refresh time.Duration) *jwks {
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefreshInterval
+	}
+	return &jwks{
+		url:        url,
+		client:     client,
+		refresh:    refresh,
+		minRefresh: DefaultJWKSMinRefresh,
+	}
+}
+
+func (j *jwks) Key(ctx context.Context, header jose.Header) (interface{}, error) {
+	keys, fetchedAt := j.snapshot()
+	switch {
+	case fetchedAt.IsZero():
+		// Nothing to serve until the first fetch succeeds
+		if err := j.update(ctx); err != nil {
+			return nil, err
+		}
+		keys, _ = j.snapshot()
+	case time.Since(fetchedAt) > j.refresh && j.refreshing.CompareAndSwap(false, true):
+		go func() {
+			defer j.refreshing.Store(false)
+			j.update(context.Background())
+		}()
+	}
+
+	if key := match(keys, header); key != nil {
+		return key, nil
+	}
+
+	// The issuer may have rotated keys since the last fetch
+	if err := j.update(ctx); err != nil {
+		return nil, err
+	}
+	keys, _ = j.snapshot()
+	if key := match(keys, header); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (j *jwks) snapshot() (jose.JSONWebKeySet, time.Time) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.keys, j.fetchedAt
+}
+
+// update refreshes the key set unless it was attempted within minRefresh,
+// in which case the outcome of that attempt is returned. Concurrent callers
+// share one fetch.
+func (j *jwks) update(ctx context.Context) error {
+	_, err, _ := j.group.Do(j.url, func() (interface{}, error) {
+		j.mu.Lock()
+		if time.Since(j.attemptedAt) < j.minRefresh {
+			err := j.err
+			j.mu.Unlock()
+			return nil, err
+		}
+		j.attemptedAt = time.Now()
+		j.mu.Unlock()
+
+		// The fetch is shared, so one caller going away must not fail it
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DefaultJWKSTimeout)
+		defer cancel()
+		keys, err := j.fetch(ctx)
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.err = err
+		if err == nil {
+			j.keys = keys
+			j.fetchedAt = time.Now()
+		}
+		return nil, err
+	})
+	return err
+}
+
+// match returns the public key for the token's kid and algorithm
+func match(keys jose.JSONWebKeySet, header jose.Header) interface{} {
+	candidates := keys.Keys
+	if header.KeyID != "" {
+		candidates = keys.Key(header.KeyID)
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Use != "" && candidate.Use != "sig" {
+			continue
+		}
+		if candidate.Algorithm != "" && candidate.Algorithm != header.Algorithm {
+			continue
+		}
+		// Public drops private and symmetric material from the set
+		key := candidate.Public().Key
+		if checkKeyType(jose.SignatureAlgorithm(header.Algorithm), key) == nil {
+			return key
+		}
+	}
+	return nil
+}
+
+// fetch downloads the key set
+func (j *jwks) fetch(ctx context.Context) (jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return keys, fmt.Errorf("failed to create jwks request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return keys, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return keys, fmt.Errorf("failed to fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&keys); err != nil {
+		return keys, fmt.Errorf("failed to decode jwks: %w", err)
+	}
+	return keys, nil
+}
+
+func isURL(value string) bool {
+	return strings.HasPrefix(value, "https://") || strings.HasPrefix(value, "http://")
+}
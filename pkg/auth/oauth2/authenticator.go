@@ -0,0 +1,222 @@
+package oauth2
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// Authenticator defaults
+const (
+	DefaultCacheTTL             = time.Minute
+	DefaultIntrospectionTimeout = 5 * time.Second
+	DefaultTokenParam           = "access_token"
+)
+
+// Authenticator validates opaque bearer tokens through RFC 7662 introspection
+type Authenticator struct {
+	config       *apidef.OAuth2Config
+	introspector *Introspector
+	client       *http.Client
+	cache        Cache
+	cacheTTL     time.Duration
+	logger       *logger.Logger
+}
+
+// Option allows customization of the authenticator
+type Option func(*Authenticator)
+
+// WithHTTPClient sets the client used to call the introspection endpoint
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *Authenticator) {
+		a.client = client
+	}
+}
+
+// WithCache caches introspection results; see NewDragonflyCache
+func WithCache(cache Cache) Option {
+	return func(a *Authenticator) {
+		a.cache = cache
+	}
+}
+
+// WithLogger sets the logger used to report cache failures
+func WithLogger(log *logger.Logger) Option {
+	return func(a *Authenticator) {
+		a.logger = log
+	}
+}
+
+// NewAuthenticator creates an OAuth2 introspection authenticator
+func NewAuthenticator(config *apidef.OAuth2Config, options ...Option) (*Authenticator, error) {
+	if config == nil {
+		return nil, fmt.Errorf("oauth2 config cannot be nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid oauth2 config: %w", err)
+	}
+	if config.IntrospectURL == "" {
+		return nil, fmt.Errorf("invalid oauth2 config: introspect_url is required for token validation")
+	}
+
+	a := &Authenticator{
+		config:   config,
+		client:   &http.Client{Timeout: DefaultIntrospectionTimeout},
+		cacheTTL: config.CacheTTL,
+	}
+
+	for _, option := range options {
+		option(a)
+	}
+
+	if a.cacheTTL <= 0 {
+		a.cacheTTL = DefaultCacheTTL
+	}
+	if a.logger == nil {
+		a.logger = logger.GetGlobalLogger()
+	}
+	a.logger = a.logger.WithComponent("oauth2")
+	a.introspector = NewIntrospector(config.IntrospectURL, config.ClientID, config.ClientSecret, a.client)
+
+	return a, nil
+}
+
+// Authenticate implements auth.Authenticator
+func (a *Authenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	token := a.extract(r)
+	if token == "" {
+		return nil, auth.Unauthorized("MISSING_TOKEN", "bearer token is required", auth.ErrMissingCredentials).
+			WithChallenge("Bearer")
+	}
+
+	result, err := a.introspect(r, token)
+	if err != nil {
+		return nil, &auth.Error{
+			Status:  http.StatusServiceUnavailable,
+			Code:    "INTROSPECTION_UNAVAILABLE",
+			Message: "token could not be validated",
+			Cause:   err,
+		}
+	}
+
+	if !result.IsActive(time.Now()) {
+		return nil, auth.Unauthorized("INVALID_TOKEN", "token is not active", auth.ErrInvalidCredentials).
+			WithChallenge(challenge("invalid_token", "token is not active", nil))
+	}
+
+	scopes := result.Scopes()
+	if missing := missingScopes(scopes, a.config.RequiredScopes); len(missing) > 0 {
+		return nil, auth.Forbidden("INSUFFICIENT_SCOPE", "token lacks required scopes", auth.ErrForbidden).
+			WithChallenge(challenge("insufficient_scope", "token lacks required scopes", a.config.RequiredScopes))
+	}
+
+	id := result.Sub
+	if id == "" {
+		id = result.Username
+	}
+	if id == "" {
+		id = result.ClientID
+	}
+
+	return &auth.Principal{
+		ID:     id,
+		Method: apidef.AuthOAuth2,
+		Scopes: scopes,
+		Claims: result.Claims,
+	}, nil
+}
+
+// Middleware authenticates requests and attaches the principal to the context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return auth.Middleware(a)(next)
+}
+
+// Internal methods
+
+// introspect answers from the cache when possible. Inactive answers are
+// cached too, so replayed bad tokens do not reach the authorization server.
+func (a *Authenticator) introspect(r *http.Request, token string) (*Introspection, error) {
+	ctx := r.Context()
+	digest := TokenDigest(token)
+
+	if a.cache != nil {
+		cached, err := a.cache.Get(ctx, digest)
+		if err != nil {
+			a.logger.Warn("Failed to read introspection cache", zap.Error(err))
+		} else if cached != nil {
+			return cached, nil
+		}
+	}
+
+	result, err := a.introspector.Introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.cache != nil {
+		if ttl := a.ttlFor(result); ttl > 0 {
+			if err := a.cache.Set(ctx, digest, result, ttl); err != nil {
+				a.logger.Warn("Failed to write introspection cache", zap.Error(err))
+			}
+		}
+	}
+	return result, nil
+}
+
+// ttlFor never lets a cached active answer outlive the token itself
+func (a *Authenticator) ttlFor(result *Introspection) time.Duration {
+	ttl := a.cacheTTL
+	if result.Active && result.Exp != 0 {
+		if remaining := time.Until(time.Unix(result.Exp, 0)); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl
+}
+
+// extract reads the token from the configured location
+func (a *Authenticator) extract(r *http.Request) string {
+	switch strings.ToLower(a.config.TokenLocation) {
+	case "query":
+		return r.URL.Query().Get(DefaultTokenParam)
+	case "form":
+		return r.PostFormValue(DefaultTokenParam)
+	default:
+		header := strings.TrimSpace(r.Header.Get("Authorization"))
+		if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+			return strings.TrimSpace(header[7:])
+		}
+		return ""
+	}
+}
+
+func missingScopes(granted, required []string) []string {
+	have := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		have[scope] = true
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if !have[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// challenge formats an RFC 6750 Bearer challenge
+func challenge(code, description string, scopes []string) string {
+	value := fmt.Sprintf(`Bearer error=%q, error_description=%q`, code, description)
+	if len(scopes) > 0 {
+		value += fmt.Sprintf(`, scope=%q`, strings.Join(scopes, " "))
+	}
+	return value
+}
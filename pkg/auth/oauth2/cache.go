@@ -0,0 +1,80 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+)
+
+// DefaultCachePrefix is the prefix of every key written by DragonflyCache
+const DefaultCachePrefix = "oauth2:introspect:"
+
+// Cache stores introspection results keyed by token digest
+type Cache interface {
+	// Get returns the cached result, or nil when the token is not cached
+	Get(ctx context.Context, digest string) (*Introspection, error)
+	Set(ctx context.Context, digest string, result *Introspection, ttl time.Duration) error
+}
+
+// DragonflyCache caches introspection results in Dragonfly so every
+// gateway node shares them
+type DragonflyCache struct {
+	client *dragonfly.Client
+	prefix string
+}
+
+// NewDragonflyCache creates an introspection cache backed by a Dragonfly client
+func NewDragonflyCache(client *dragonfly.Client, prefix string) *DragonflyCache {
+	if prefix == "" {
+		prefix = DefaultCachePrefix
+	}
+	return &DragonflyCache{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Get implements Cache
+func (c *DragonflyCache) Get(ctx context.Context, digest string) (*Introspection, error) {
+	data, err := c.client.Client().Get(ctx, c.prefix+digest).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to read introspection cache")
+	}
+	return parseIntrospection(data)
+}
+
+// Set implements Cache
+func (c *DragonflyCache) Set(ctx context.Context, digest string, result *Introspection, ttl time.Duration) error {
+	var data []byte
+	var err error
+	if result.Claims != nil {
+		data, err = json.Marshal(result.Claims)
+	} else {
+		data, err = json.Marshal(result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal introspection result: %w", err)
+	}
+
+	if err := c.client.Client().Set(ctx, c.prefix+digest, data, ttl).Err(); err != nil {
+		return dragonfly.WrapError(err, "failed to write introspection cache")
+	}
+	return nil
+}
+
+// TokenDigest returns the cache key of a token, so raw tokens never reach the cache
+func TokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,124 @@
+package oauth2_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth/oauth2"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// memoryCache is a minimal in-memory Cache used by the examples
+type memoryCache struct {
+	mu      sync.Mutex
+	results map[string]*oauth2.Introspection
+}
+
+func (c *memoryCache) Get(_ context.Context, digest string) (*oauth2.Introspection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results[digest], nil
+}
+
+func (c *memoryCache) Set(_ context.Context, digest string, result *oauth2.Introspection, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[digest] = result
+	return nil
+}
+
+// ExampleAuthenticator demonstrates introspection with cached answers and scope enforcement
+func ExampleAuthenticator() {
+	var calls atomic.Int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.PostFormValue("token") {
+		case "good-token":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"active": true, "sub": "user-42", "scope": "orders:read orders:write",
+				"exp": time.Now().Add(time.Hour).Unix(),
+			})
+		case "read-only-token":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"active": true, "sub": "user-7", "scope": "orders:read",
+			})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+		}
+	}))
+	defer authServer.Close()
+
+	authenticator, err := oauth2.NewAuthenticator(&apidef.OAuth2Config{
+		IntrospectURL:  authServer.URL,
+		ClientID:       "gateway",
+		ClientSecret:   "s3cret",
+		RequiredScopes: []string{"orders:write"},
+		CacheTTL:       time.Minute,
+	},
+		oauth2.WithCache(&memoryCache{results: make(map[string]*oauth2.Introspection)}),
+		oauth2.WithLogger(&logger.Logger{Logger: zap.NewNop()}),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, token := range []string{"good-token", "good-token", "revoked-token", "revoked-token", "read-only-token"} {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Println(strings.TrimSpace(fmt.Sprintln(token, rec.Code, rec.Header().Get("WWW-Authenticate"))))
+	}
+	fmt.Println("introspection calls:", calls.Load())
+
+	// Output:
+	// good-token 200
+	// good-token 200
+	// revoked-token 401 Bearer error="invalid_token", error_description="token is not active"
+	// revoked-token 401 Bearer error="invalid_token", error_description="token is not active"
+	// read-only-token 403 Bearer error="insufficient_scope", error_description="token lacks required scopes", scope="orders:write"
+	// introspection calls: 3
+}
+
+// ExampleNewDragonflyCache shows sharing introspection results across gateway nodes
+func ExampleNewDragonflyCache() {
+	client, err := dragonfly.NewClient(dragonfly.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to dragonfly: %v", err)
+	}
+	defer client.Stop()
+
+	if err := client.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start dragonfly client: %v", err)
+	}
+
+	authenticator, err := oauth2.NewAuthenticator(&apidef.OAuth2Config{
+		IntrospectURL: "https://auth.example.com/oauth2/introspect",
+		ClientID:      "gateway",
+		ClientSecret:  "s3cret",
+		CacheTTL:      30 * time.Second,
+	}, oauth2.WithCache(oauth2.NewDragonflyCache(client, "")))
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	http.Handle("/orders/", authenticator.Middleware(http.NotFoundHandler()))
+}
@@ -0,0 +1,137 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const maxIntrospectionBytes = 1 << 20
+
+// Introspection is an RFC 7662 token introspection response
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       Audience `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+
+	// Claims holds every member of the response, including extensions
+	Claims map[string]interface{} `json:"-"`
+}
+
+// Scopes returns the space separated scope as a list
+func (i *Introspection) Scopes() []string {
+	return strings.Fields(i.Scope)
+}
+
+// IsActive reports whether the token is active and within its validity window
+func (i *Introspection) IsActive(now time.Time) bool {
+	if !i.Active {
+		return false
+	}
+	if i.Exp != 0 && !now.Before(time.Unix(i.Exp, 0)) {
+		return false
+	}
+	if i.Nbf != 0 && now.Before(time.Unix(i.Nbf, 0)) {
+		return false
+	}
+	return true
+}
+
+// Audience accepts both the string and array forms of the aud member
+type Audience []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+	*a = multiple
+	return nil
+}
+
+// Introspector calls an RFC 7662 introspection endpoint
+type Introspector struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+}
+
+// NewIntrospector creates an introspection client authenticating with the
+// given client credentials
+func NewIntrospector(endpoint, clientID, clientSecret string, client *http.Client) *Introspector {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Introspector{
+		endpoint:     endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       client,
+	}
+}
+
+// Introspect asks the authorization server about a token
+func (i *Introspector) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIntrospectionBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read introspection response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned status %d", resp.StatusCode)
+	}
+
+	return parseIntrospection(body)
+}
+
+func parseIntrospection(body []byte) (*Introspection, error) {
+	var result Introspection
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+	if err := json.Unmarshal(body, &result.Claims); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+	return &result, nil
+}
@@ -0,0 +1,199 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// targetState tracks the runtime state of a single upstream target
+type targetState struct {
+	target   *apidef.UpstreamTarget
+	key      string
+	weight   int
+	healthy  atomic.Bool
+	ejected  atomic.Bool
+	inFlight atomic.Int64
+
+	// currentWeight is only touched by the weighted strategy under its lock
+	currentWeight int
+}
+
+// TargetStats is a point-in-time view of a target's state
+type TargetStats struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	Weight   int    `json:"weight"`
+	Healthy  bool   `json:"healthy"`
+	Ejected  bool   `json:"ejected"`
+	InFlight int64  `json:"in_flight"`
+}
+
+// Balancer distributes requests across upstream targets using one of the
+// apidef load balancing strategies. It is safe for concurrent use and
+// implements proxy.Selector.
+type Balancer struct {
+	lbType   apidef.LoadBalancingType
+	strategy strategy
+	states   []*targetState
+	byKey    map[string]*targetState
+
+	// healthy holds the current []*targetState of admitted targets
+	healthy atomic.Value
+	mu      sync.Mutex
+}
+
+// New creates a balancer over the given targets. An empty strategy defaults
+// to round robin. Targets must have distinct keys, see TargetKey.
+func New(targets []apidef.UpstreamTarget, lbType apidef.LoadBalancingType) (*Balancer, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	s, err := newStrategy(lbType)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Balancer{
+		lbType:   lbType,
+		strategy: s,
+		states:   make([]*targetState, 0, len(targets)),
+		byKey:    make(map[string]*targetState, len(targets)),
+	}
+
+	for i := range targets {
+		target := targets[i]
+		state := &targetState{
+			target: &target,
+			key:    TargetKey(&target),
+			weight: target.Weight,
+		}
+		if state.weight <= 0 {
+			state.weight = 1
+		}
+		state.healthy.Store(true)
+
+		if _, ok := b.byKey[state.key]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateTarget, state.key)
+		}
+		b.states = append(b.states, state)
+		b.byKey[state.key] = state
+	}
+
+	b.rebuild()
+	return b, nil
+}
+
+// TargetKey returns the identifier used for a target: its ID, or its URL when no ID is set
+func TargetKey(target *apidef.UpstreamTarget) string {
+	if target.ID != "" {
+		return target.ID
+	}
+	return target.URL
+}
+
+// Strategy returns the load balancing type in use
+func (b *Balancer) Strategy() apidef.LoadBalancingType {
+	return b.lbType
+}
+
+// Select returns the target that should receive the request
+func (b *Balancer) Select(r *http.Request) (*apidef.UpstreamTarget, error) {
+	candidates := b.healthy.Load().([]*targetState)
+	if len(candidates) == 0 {
+		return nil, ErrNoHealthyTarget
+	}
+
+	state := b.strategy.Pick(candidates, r)
+	state.inFlight.Add(1)
+	return state.target, nil
+}
+
+// Release marks the end of a request previously routed by Select
+func (b *Balancer) Release(target *apidef.UpstreamTarget, statusCode int, err error) {
+	if state, ok := b.byKey[TargetKey(target)]; ok {
+		state.inFlight.Add(-1)
+	}
+}
+
+// SetHealthy evicts an unhealthy target from rotation or readmits a healthy one
+func (b *Balancer) SetHealthy(key string, healthy bool) error {
+	state, ok := b.byKey[key]
+	if !ok {
+		return ErrUnknownTarget
+	}
+
+	if state.healthy.Swap(healthy) != healthy {
+		b.rebuild()
+	}
+	return nil
+}
+
+// SetEjected temporarily removes a target from rotation independently of its
+// active health state, e.g. while its circuit breaker is open
+func (b *Balancer) SetEjected(key string, ejected bool) error {
+	state, ok := b.byKey[key]
+	if !ok {
+		return ErrUnknownTarget
+	}
+
+	if state.ejected.Swap(ejected) != ejected {
+		b.rebuild()
+	}
+	return nil
+}
+
+// IsHealthy reports whether the target passes active health checks
+func (b *Balancer) IsHealthy(key string) bool {
+	state, ok := b.byKey[key]
+	return ok && state.healthy.Load()
+}
+
+// IsAvailable reports whether the target is currently in rotation
+func (b *Balancer) IsAvailable(key string) bool {
+	state, ok := b.byKey[key]
+	return ok && state.healthy.Load() && !state.ejected.Load()
+}
+
+// Targets returns the configured targets
+func (b *Balancer) Targets() []*apidef.UpstreamTarget {
+	targets := make([]*apidef.UpstreamTarget, len(b.states))
+	for i, state := range b.states {
+		targets[i] = state.target
+	}
+	return targets
+}
+
+// Stats returns the state of every target
+func (b *Balancer) Stats() []TargetStats {
+	stats := make([]TargetStats, len(b.states))
+	for i, state := range b.states {
+		stats[i] = TargetStats{
+			ID:       state.key,
+			URL:      state.target.URL,
+			Weight:   state.weight,
+			Healthy:  state.healthy.Load(),
+			Ejected:  state.ejected.Load(),
+			InFlight: state.inFlight.Load(),
+		}
+	}
+	return stats
+}
+
+// rebuild recomputes the list of admitted targets
+func (b *Balancer) rebuild() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	healthy := make([]*targetState, 0, len(b.states))
+	for _, state := range b.states {
+		if state.healthy.Load() && !state.ejected.Load() {
+			healthy = append(healthy, state)
+		}
+	}
+	b.healthy.Store(healthy)
+}
@@ -0,0 +1,23 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Common balancer errors
+var (
+	ErrNoTargets       = errors.New("balancer requires at least one target")
+	ErrNoHealthyTarget = errors.New("no healthy upstream target available")
+	ErrUnknownTarget   = errors.New("unknown upstream target")
+	ErrDuplicateTarget = errors.New("duplicate upstream target")
+)
+
+// StrategyError is returned for unsupported load balancing types
+type StrategyError struct {
+	Type string
+}
+
+func (e *StrategyError) Error() string {
+	return fmt.Sprintf("unsupported load balancing strategy: %s", e.Type)
+}
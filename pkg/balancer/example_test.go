@@ -0,0 +1,131 @@
+package balancer_test
+
+import (
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/balancer"
+)
+
+func exampleTargets() []apidef.UpstreamTarget {
+	return []apidef.UpstreamTarget{
+		{ID: "a", URL: "http://10.0.0.1:8080", Weight: 3},
+		{ID: "b", URL: "http://10.0.0.2:8080", Weight: 1},
+	}
+}
+
+// pick selects n targets and immediately releases them
+func pick(b *balancer.Balancer, n int) string {
+	req := httptest.NewRequest("GET", "/", nil)
+	picks := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		target, err := b.Select(req)
+		if err != nil {
+			return err.Error()
+		}
+		b.Release(target, 200, nil)
+		picks = append(picks, target.ID)
+	}
+	return strings.Join(picks, " ")
+}
+
+// ExampleBalancer_weighted demonstrates smooth weighted round robin
+func ExampleBalancer_weighted() {
+	b, err := balancer.New(exampleTargets(), apidef.LoadBalanceWeighted)
+	if err != nil {
+		log.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	fmt.Println(pick(b, 8))
+	// Output: a a b a a a b a
+}
+
+// ExampleBalancer_SetHealthy demonstrates evicting and readmitting a target
+func ExampleBalancer_SetHealthy() {
+	b, err := balancer.New(exampleTargets(), apidef.LoadBalanceRoundRobin)
+	if err != nil {
+		log.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	fmt.Println(pick(b, 4))
+
+	b.SetHealthy("a", false)
+	fmt.Println(pick(b, 3))
+
+	b.SetHealthy("b", false)
+	fmt.Println(pick(b, 1))
+
+	b.SetHealthy("a", true)
+	fmt.Println(pick(b, 2))
+
+	// Output:
+	// a b a b
+	// b b b
+	// no healthy upstream target available
+	// a a
+}
+
+// ExampleBalancer_leastConn demonstrates in-flight tracking
+func ExampleBalancer_leastConn() {
+	b, err := balancer.New([]apidef.UpstreamTarget{
+		{ID: "a", URL: "http://10.0.0.1:8080"},
+		{ID: "b", URL: "http://10.0.0.2:8080"},
+	}, apidef.LoadBalanceLeastConn)
+	if err != nil {
+		log.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	first, _ := b.Select(req)
+	second, _ := b.Select(req)
+	fmt.Println(first.ID != second.ID)
+
+	// Finish the first request: the next pick must go to its target
+	b.Release(first, 200, nil)
+	third, _ := b.Select(req)
+	fmt.Println(third.ID == first.ID)
+
+	for _, stats := range b.Stats() {
+		fmt.Printf("%s in_flight=%d\n", stats.ID, stats.InFlight)
+	}
+
+	// Output:
+	// true
+	// true
+	// a in_flight=1
+	// b in_flight=1
+}
+
+// ExampleBalancer_ipHash demonstrates client affinity
+func ExampleBalancer_ipHash() {
+	b, err := balancer.New(exampleTargets(), apidef.LoadBalanceIPHash)
+	if err != nil {
+		log.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.9:51234"
+
+	first, _ := b.Select(req)
+	sticky := true
+	for i := 0; i < 10; i++ {
+		target, _ := b.Select(req)
+		sticky = sticky && target.ID == first.ID
+	}
+	fmt.Println("sticky:", sticky)
+	// Output: sticky: true
+}
+
+// ExampleNew_duplicateTarget shows targets without an ID are keyed by URL,
+// which must then be unique
+func ExampleNew_duplicateTarget() {
+	_, err := balancer.New([]apidef.UpstreamTarget{
+		{URL: "http://10.0.0.1:8080"},
+		{URL: "http://10.0.0.1:8080"},
+	}, apidef.LoadBalanceRoundRobin)
+	fmt.Println(err)
+	// Output: duplicate upstream target: http://10.0.0.1:8080
+}
@@ -0,0 +1,130 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// strategy picks one target out of the currently healthy candidates.
+// Candidates are never empty when Pick is called.
+type strategy interface {
+	Pick(candidates []*targetState, r *http.Request) *targetState
+}
+
+// newStrategy returns the strategy implementation for a load balancing type
+func newStrategy(lbType apidef.LoadBalancingType) (strategy, error) {
+	switch lbType {
+	case "", apidef.LoadBalanceRoundRobin:
+		return &roundRobin{}, nil
+	case apidef.LoadBalanceWeighted:
+		return &weighted{}, nil
+	case apidef.LoadBalanceIPHash:
+		return &ipHash{}, nil
+	case apidef.LoadBalanceLeastConn:
+		return &leastConn{}, nil
+	case apidef.LoadBalanceRandom:
+		return &random{}, nil
+	default:
+		return nil, &StrategyError{Type: string(lbType)}
+	}
+}
+
+// roundRobin cycles through candidates in order
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (s *roundRobin) Pick(candidates []*targetState, r *http.Request) *targetState {
+	n := s.next.Add(1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+// weighted implements smooth weighted round robin, which spreads picks of
+// heavier targets evenly instead of sending them in bursts
+type weighted struct {
+	mu sync.Mutex
+}
+
+func (s *weighted) Pick(candidates []*targetState, r *http.Request) *targetState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *targetState
+	total := 0
+	for _, candidate := range candidates {
+		candidate.currentWeight += candidate.weight
+		total += candidate.weight
+		if best == nil || candidate.currentWeight > best.currentWeight {
+			best = candidate
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
+
+// ipHash maps each client IP to a target using rendezvous hashing, so that
+// evicting a target only remaps the clients that were pinned to it
+type ipHash struct{}
+
+func (s *ipHash) Pick(candidates []*targetState, r *http.Request) *targetState {
+	ip := clientIP(r)
+
+	var best *targetState
+	var bestScore uint64
+	for _, candidate := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(ip))
+		h.Write([]byte{0})
+		h.Write([]byte(candidate.key))
+		score := h.Sum64()
+		if best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// leastConn picks the target with the fewest in-flight requests relative to
+// its weight, rotating between equally loaded targets
+type leastConn struct {
+	next atomic.Uint64
+}
+
+func (s *leastConn) Pick(candidates []*targetState, r *http.Request) *targetState {
+	offset := int(s.next.Add(1) % uint64(len(candidates)))
+
+	var best *targetState
+	var bestLoad float64
+	for i := range candidates {
+		candidate := candidates[(offset+i)%len(candidates)]
+		load := float64(candidate.inFlight.Load()) / float64(candidate.weight)
+		if best == nil || load < bestLoad {
+			best, bestLoad = candidate, load
+		}
+	}
+	return best
+}
+
+// random picks a candidate uniformly at random
+type random struct{}
+
+func (s *random) Pick(candidates []*targetState, r *http.Request) *targetState {
+	return candidates[rand.IntN(len(candidates))]
+}
+
+// clientIP extracts the peer address of the request
+func clientIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// AdminHandler serves the cache purge API over a store shared by APIs:
+//
+//	DELETE /cache/{api_id}          purge every response of an API
+//	DELETE /cache/{api_id}/{path}   purge every response of one path
+//
+// Both answer with the number of purged entries. Mount it behind the admin
+// listener's authentication, using http.StripPrefix when it is not served
+// from the root.
+func AdminHandler(store Store) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("DELETE /cache/{api_id}", func(w http.ResponseWriter, r *http.Request) {
+		purged, err := store.DeletePrefix(r.Context(), APIPrefix(r.PathValue("api_id")))
+		writePurged(w, purged, err)
+	})
+
+	mux.HandleFunc("DELETE /cache/{api_id}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		purged, err := store.DeletePrefix(r.Context(), PathPrefix(r.PathValue("api_id"), "/"+r.PathValue("path")))
+		writePurged(w, purged, err)
+	})
+
+	return mux
+}
+
+func writePurged(w http.ResponseWriter, purged int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
@@ -0,0 +1,674 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// Cache defaults
+const (
+	DefaultTTL         = time.Minute
+	DefaultMaxBodySize = 1 << 20
+)
+
+// HeaderCache reports whether a response was served from the cache
+const HeaderCache = "X-Cache"
+
+// Values of the X-Cache header
+const (
+	StatusHit    = "HIT"
+	StatusMiss   = "MISS"
+	StatusBypass = "BYPASS"
+)
+
+// Values accepted in apidef.CacheConfig.Storage
+const (
+	StorageMemory      = "memory"
+	StorageRedis       = "redis"
+	StorageDistributed = "distributed" // alias of redis
+)
+
+// Values accepted in apidef.CacheConfig.CacheKeys
+const (
+	KeyQuery     = "query"     // the whole, normalized query string
+	KeyPrincipal = "principal" // auth.Principal.Key
+	keyQueryName = "query:"    // query:<name>
+	keyHeader    = "header:"   // header:<name>
+)
+
+// Common cache errors
+var (
+	ErrDragonflyRequired  = errors.New("dragonfly client is required for redis cache storage")
+	ErrUnsupportedStorage = errors.New("unsupported cache storage")
+	ErrUnsupportedKey     = errors.New("unsupported cache key")
+)
+
+// Unsafe methods are never cached, whatever SkipMethods says
+var unsafeMethods = map[string]bool{
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+}
+
+// Hop-by-hop headers are never stored
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", HeaderCache,
+}
+
+// Cache serves cached upstream responses according to an API definition's
+// CacheConfig
+type Cache struct {
+	apiID       string
+	config      *apidef.CacheConfig
+	store       Store
+	client      *dragonfly.Client
+	logger      *logger.Logger
+	maxBodySize int
+	skipMethods map[string]bool
+	statuses    map[int]bool
+	keys        []string
+	vary        []string
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is an upstream call that concurrent misses for its key wait on
+type flight struct {
+	key   string
+	entry *Entry
+	// done is closed once the response is stored, or as soon as it is
+	// known not to be cached
+	done chan struct{}
+	once sync.Once
+}
+
+// Option allows customization of the cache
+type Option func(*Cache)
+
+// WithStore sets the store, overriding CacheConfig.Storage. Sharing one
+// store between APIs lets a single admin handler purge all of them.
+func WithStore(store Store) Option {
+	return func(c *Cache) {
+		c.store = store
+	}
+}
+
+// WithDragonfly sets the client used by the redis storage
+func WithDragonfly(client *dragonfly.Client) Option {
+	return func(c *Cache) {
+		c.client = client
+	}
+}
+
+// WithMaxBodySize sets the largest response body that is cached
+func WithMaxBodySize(size int) Option {
+	return func(c *Cache) {
+		c.maxBodySize = size
+	}
+}
+
+// WithLogger sets the logger used to report store failures
+func WithLogger(log *logger.Logger) Option {
+	return func(c *Cache) {
+		c.logger = log
+	}
+}
+
+// New creates a response cache for an API definition. A missing or
+// disabled CacheConfig yields a cache that passes every request through.
+func New(def *apidef.APIDefinition, options ...Option) (*Cache, error) {
+	if def == nil {
+		return nil, fmt.Errorf("api definition cannot be nil")
+	}
+
+	c := &Cache{
+		apiID:       def.APIID,
+		config:      def.CacheConfig,
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.logger == nil {
+		c.logger = logger.GetGlobalLogger()
+	}
+	c.logger = c.logger.WithComponent("cache")
+
+	if !c.enabled() {
+		return c, nil
+	}
+
+	if c.store == nil {
+		switch strings.ToLower(c.config.Storage) {
+		case "", StorageMemory:
+			c.store = NewMemoryStore(0, 0)
+		case StorageRedis, StorageDistributed:
+			if c.client == nil {
+				return nil, ErrDragonflyRequired
+			}
+			c.store = NewDragonflyStore(c.client, "")
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedStorage, c.config.Storage)
+		}
+	}
+
+	c.skipMethods = make(map[string]bool, len(c.config.SkipMethods))
+	for _, method := range c.config.SkipMethods {
+		c.skipMethods[strings.ToUpper(method)] = true
+	}
+
+	c.statuses = map[int]bool{http.StatusOK: true}
+	if len(c.config.OnlyStatusCodes) > 0 {
+		c.statuses = make(map[int]bool, len(c.config.OnlyStatusCodes))
+		for _, status := range c.config.OnlyStatusCodes {
+			c.statuses[status] = true
+		}
+	}
+
+	c.keys = []string{KeyQuery}
+	if len(c.config.CacheKeys) > 0 {
+		c.keys = make([]string, 0, len(c.config.CacheKeys))
+		for _, key := range c.config.CacheKeys {
+			lower := strings.ToLower(key)
+			switch {
+			case lower == KeyQuery, lower == KeyPrincipal:
+				key = lower
+			case strings.HasPrefix(lower, keyQueryName) && len(key) > len(keyQueryName):
+				key = keyQueryName + key[len(keyQueryName):]
+			case strings.HasPrefix(lower, keyHeader) && len(key) > len(keyHeader):
+				key = keyHeader + http.CanonicalHeaderKey(key[len(keyHeader):])
+			default:
+				return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, key)
+			}
+			c.keys = append(c.keys, key)
+		}
+	}
+
+	for _, header := range c.config.VaryHeaders {
+		c.vary = append(c.vary, http.CanonicalHeaderKey(header))
+	}
+
+	return c, nil
+}
+
+// Middleware serves fresh cached responses and caches cacheable upstream
+// responses. Concurrent misses for the same key that may share a response
+// are coalesced into a single upstream call, and forwarded on their own
+// as soon as that response turns out not to be cacheable. Store failures
+// fail open.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	if !c.enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.cacheable(r) {
+			w.Header().Set(HeaderCache, StatusBypass)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		directives := parseCacheControl(r.Header.Get("Cache-Control"))
+		if _, ok := directives["no-store"]; ok {
+			w.Header().Set(HeaderCache, StatusBypass)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := c.Key(r)
+		if !revalidate(r, directives) {
+			entry, err := c.store.Get(r.Context(), key)
+			if err != nil {
+				c.logger.Warn("Cache store unavailable, forwarding request",
+					zap.String("api_id", c.apiID),
+					zap.Error(err),
+				)
+			}
+			if entry != nil {
+				serve(w, r, entry)
+				return
+			}
+		}
+
+		// Responses to requests that are not shared are specific to the
+		// caller until the upstream marks them public
+		if !c.shared(r) {
+			c.fetch(w, r, next, key, nil)
+			return
+		}
+
+		f, leader := c.join(key)
+		if leader {
+			defer c.land(f, nil)
+			c.fetch(w, r, next, key, f)
+			return
+		}
+
+		select {
+		case <-f.done:
+		case <-r.Context().Done():
+			return
+		}
+		// Coalesced requests share the leader's response only if it was
+		// cacheable; anything else may be specific to the leader
+		if f.entry != nil {
+			serve(w, r, f.entry)
+			return
+		}
+		w.Header().Set(HeaderCache, StatusMiss)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Key returns the cache key of a request
+func (c *Cache) Key(r *http.Request) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method))
+
+	for _, key := range c.keys {
+		var value string
+		switch {
+		case key == KeyQuery:
+			value = r.URL.Query().Encode()
+		case key == KeyPrincipal:
+			if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+				value = principal.Key()
+			}
+		case strings.HasPrefix(key, keyQueryName):
+			value = strings.Join(r.URL.Query()[key[len(keyQueryName):]], ",")
+		case strings.HasPrefix(key, keyHeader):
+			value = strings.Join(r.Header.Values(key[len(keyHeader):]), ",")
+		}
+		fmt.Fprintf(hash, "\n%s=%q", key, value)
+	}
+	for _, header := range c.vary {
+		fmt.Fprintf(hash, "\nvary:%s=%q", header, strings.Join(r.Header.Values(header), ","))
+	}
+
+	return PathPrefix(c.apiID, r.URL.Path) + hex.EncodeToString(hash.Sum(nil))
+}
+
+// Purge removes every cached response of the API
+func (c *Cache) Purge(ctx context.Context) (int, error) {
+	if !c.enabled() {
+		return 0, nil
+	}
+	return c.store.DeletePrefix(ctx, APIPrefix(c.apiID))
+}
+
+// PurgePath removes every cached response of one path of the API, for
+// all methods and key variants. path is the path seen by the middleware.
+func (c *Cache) PurgePath(ctx context.Context, path string) (int, error) {
+	if !c.enabled() {
+		return 0, nil
+	}
+	return c.store.DeletePrefix(ctx, PathPrefix(c.apiID, path))
+}
+
+// APIPrefix returns the prefix shared by every cache key of an API
+func APIPrefix(apiID string) string {
+	return url.QueryEscape(apiID) + ":"
+}
+
+// PathPrefix returns the prefix shared by every cache key of one path of an API
+func PathPrefix(apiID, path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return APIPrefix(apiID) + hex.EncodeToString(sum[:8]) + ":"
+}
+
+// Internal methods
+
+func (c *Cache) enabled() bool {
+	return c.config != nil && c.config.Enabled
+}
+
+// cacheable reports whether a request may be answered from the cache
+func (c *Cache) cacheable(r *http.Request) bool {
+	if unsafeMethods[r.Method] || c.skipMethods[r.Method] {
+		return false
+	}
+	if r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	for _, pattern := range c.config.SkipPaths {
+		if matchPath(pattern, r.URL.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+// join returns the flight of a key, starting one when there is none. The
+// caller starting it is its leader.
+func (c *Cache) join(key string) (*flight, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.flights[key]; ok {
+		return f, false
+	}
+	if c.flights == nil {
+		c.flights = make(map[string]*flight)
+	}
+	f := &flight{key: key, done: make(chan struct{})}
+	c.flights[key] = f
+	return f, true
+}
+
+// land ends a flight with the entry its waiters are served, nil sending
+// them upstream. Later calls are ignored.
+func (c *Cache) land(f *flight, entry *Entry) {
+	if f == nil {
+		return
+	}
+	f.once.Do(func() {
+		c.mu.Lock()
+		delete(c.flights, f.key)
+		c.mu.Unlock()
+
+		f.entry = entry
+		close(f.done)
+	})
+}
+
+// fetch forwards a miss upstream and stores the response when cacheable.
+// Waiters on the flight, if any, are released as soon as the response is
+// not going to be stored.
+func (c *Cache) fetch(w http.ResponseWriter, r *http.Request, next http.Handler, key string, f *flight) {
+	w.Header().Set(HeaderCache, StatusMiss)
+
+	// Headers set by outer middleware, such as CORS, are recomputed per
+	// request and are neither stored nor mistaken for upstream headers
+	capture := &captureWriter{ResponseWriter: w, cache: c, outer: w.Header().Clone(), shared: c.shared(r), flight: f}
+	next.ServeHTTP(capture, r)
+	if !capture.wroteHeader {
+		capture.WriteHeader(http.StatusOK)
+	}
+
+	entry := capture.entry(r)
+	if entry == nil {
+		return
+	}
+
+	// The leader's request may be cancelled once the response is written
+	ctx := context.WithoutCancel(r.Context())
+	if err := c.store.Set(ctx, key, entry, entry.ExpiresAt.Sub(entry.StoredAt)); err != nil {
+		c.logger.Warn("Failed to store cached response",
+			zap.String("api_id", c.apiID),
+			zap.Error(err),
+		)
+	}
+	c.land(f, entry)
+}
+
+// shared reports whether a response to the request may be served to other
+// callers. Responses to authenticated requests are specific to the caller
+// unless the cache key tells callers apart.
+func (c *Cache) shared(r *http.Request) bool {
+	if slices.Contains(c.keys, KeyPrincipal) || slices.Contains(c.keys, keyHeader+"Authorization") {
+		return true
+	}
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	return principal == nil
+}
+
+// ttl returns how long a response may be cached, or 0 if it must not be.
+// Responses to requests that are not shared are only cached when the
+// upstream marks them public or gives them an s-maxage (RFC 9111 3.5).
+func (c *Cache) ttl(status int, header http.Header, shared bool) time.Duration {
+	if !c.statuses[status] || len(header.Values("Set-Cookie")) > 0 {
+		return 0
+	}
+
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" || (name != "" && !slices.Contains(c.vary, name)) {
+				// The key cannot tell apart the variants the upstream serves
+				return 0
+			}
+		}
+	}
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[directive]; ok {
+			return 0
+		}
+	}
+	if !shared {
+		_, public := directives["public"]
+		_, sharedMaxAge := directives["s-maxage"]
+		if !public && !sharedMaxAge {
+			return 0
+		}
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		value, ok := directives[directive]
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return 0
+		}
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return time.Duration(seconds-age) * time.Second
+	}
+
+	if c.config.TTL > 0 {
+		return c.config.TTL
+	}
+	return DefaultTTL
+}
+
+// serve writes a cached entry
+func serve(w http.ResponseWriter, r *http.Request, entry *Entry) {
+	h := w.Header()
+	for name, values := range entry.Header {
+		if name == "Vary" {
+			addVary(h, values)
+			continue
+		}
+		h[name] = slices.Clone(values)
+	}
+
+	age := int(time.Since(entry.StoredAt) / time.Second)
+	if stored, err := strconv.Atoi(entry.Header.Get("Age")); err == nil {
+		age += stored
+	}
+	h.Set("Age", strconv.Itoa(age))
+	h.Set(HeaderCache, StatusHit)
+
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+// upstreamHeader returns the response headers minus those set by outer
+// middleware before the upstream was called
+func upstreamHeader(header, outer http.Header) http.Header {
+	upstream := header.Clone()
+	for name, values := range outer {
+		if name != "Vary" && slices.Equal(upstream[name], values) {
+			delete(upstream, name)
+		}
+	}
+
+	var vary []string
+	for _, value := range upstream.Values("Vary") {
+		if !slices.Contains(outer.Values("Vary"), value) {
+			vary = append(vary, value)
+		}
+	}
+	upstream.Del("Vary")
+	if len(vary) > 0 {
+		upstream["Vary"] = vary
+	}
+	return upstream
+}
+
+// addVary appends values to the Vary header unless already listed
+func addVary(h http.Header, values []string) {
+	for _, value := range values {
+		if !slices.Contains(h.Values("Vary"), value) {
+			h.Add("Vary", value)
+		}
+	}
+}
+
+// revalidate reports whether the client asked to bypass cached responses
+func revalidate(r *http.Request, directives map[string]string) bool {
+	if _, ok := directives["no-cache"]; ok {
+		return true
+	}
+	if directives["max-age"] == "0" {
+		return true
+	}
+	return len(directives) == 0 && strings.EqualFold(r.Header.Get("Pragma"), "no-cache")
+}
+
+// parseCacheControl parses Cache-Control directives into lowercase names
+// and unquoted values
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
+
+// matchPath matches SkipPaths entries: a trailing * matches any suffix,
+// otherwise the pattern is a path.Match glob
+func matchPath(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && !strings.ContainsAny(prefix, "*?[") {
+		return strings.HasPrefix(p, prefix)
+	}
+	matched, _ := path.Match(pattern, p)
+	return matched
+}
+
+// captureWriter streams the response to the client while keeping a copy
+// of cacheable responses
+type captureWriter struct {
+	http.ResponseWriter
+	cache       *Cache
+	outer       http.Header
+	shared      bool
+	flight      *flight
+	status      int
+	header      http.Header
+	ttl         time.Duration
+	body        bytes.Buffer
+	written     int
+	wroteHeader bool
+	capturing   bool
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	if status >= 100 && status < 200 {
+		// Informational responses are passed through and never cached
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.wroteHeader = true
+	w.status = status
+	w.header = upstreamHeader(w.Header(), w.outer)
+	w.ttl = w.cache.ttl(status, w.header, w.shared)
+	w.capturing = w.ttl > 0
+	if !w.capturing {
+		w.cache.land(w.flight, nil)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.capturing {
+		if w.body.Len()+len(p) > w.cache.maxBodySize {
+			w.capturing = false
+			w.body = bytes.Buffer{}
+			w.cache.land(w.flight, nil)
+		} else {
+			w.body.Write(p)
+		}
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += n
+	return n, err
+}
+
+func (w *captureWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// entry returns the captured response, or nil when it must not be cached
+func (w *captureWriter) entry(r *http.Request) *Entry {
+	if !w.capturing || r.Context().Err() != nil || w.written != w.body.Len() {
+		return nil
+	}
+	if length := w.header.Get("Content-Length"); length != "" && r.Method != http.MethodHead {
+		if n, err := strconv.Atoi(length); err != nil || n != w.body.Len() {
+			// Truncated upstream response
+			return nil
+		}
+	}
+
+	for _, name := range hopHeaders {
+		w.header.Del(name)
+	}
+
+	now := time.Now()
+	return &Entry{
+		Status:    w.status,
+		Header:    w.header,
+		Body:      w.body.Bytes(),
+		StoredAt:  now,
+		ExpiresAt: now.Add(w.ttl),
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+)
+
+// DefaultKeyPrefix is the prefix of every key written by DragonflyStore
+const DefaultKeyPrefix = "cache:"
+
+// DragonflyStore keeps cached responses in Dragonfly so every gateway node
+// shares them
+type DragonflyStore struct {
+	client *dragonfly.Client
+	prefix string
+}
+
+// NewDragonflyStore creates a store backed by a Dragonfly client
+func NewDragonflyStore(client *dragonfly.Client, prefix string) *DragonflyStore {
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return &DragonflyStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Get implements Store
+func (s *DragonflyStore) Get(ctx context.Context, key string) (*Entry, error) {
+	data, err := s.client.Client().Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to read cached response")
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached response: %w", err)
+	}
+	return &entry, nil
+}
+
+// Set implements Store
+func (s *DragonflyStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached response: %w", err)
+	}
+	if err := s.client.Client().Set(ctx, s.prefix+key, data, ttl).Err(); err != nil {
+		return dragonfly.WrapError(err, "failed to write cached response")
+	}
+	return nil
+}
+
+// DeletePrefix implements Store. Keys built by this package never contain
+// glob metacharacters, so the prefix is used as a SCAN pattern as is.
+func (s *DragonflyStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	deleted := 0
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Client().Scan(ctx, cursor, s.prefix+prefix+"*", 500).Result()
+		if err != nil {
+			return deleted, dragonfly.WrapError(err, "failed to scan cached responses")
+		}
+
+		if len(keys) > 0 {
+			n, err := s.client.Client().Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, dragonfly.WrapError(err, "failed to purge cached responses")
+			}
+			deleted += int(n)
+		}
+
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,252 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/cache"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// ExampleCache demonstrates cache hits, Cache-Control handling and purging
+func ExampleCache() {
+	c, err := cache.New(&apidef.APIDefinition{
+		APIID: "catalog",
+		CacheConfig: &apidef.CacheConfig{
+			Enabled:     true,
+			TTL:         time.Minute,
+			VaryHeaders: []string{"Accept-Language"},
+			SkipPaths:   []string{"/catalog/live/*"},
+			Storage:     cache.StorageMemory,
+		},
+	}, cache.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	var calls int
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/catalog/cart" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		fmt.Fprintf(w, "call %d", calls)
+	}))
+
+	send := func(path, language string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Language", language)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Printf("%s %s: %s %q\n", path, language, rec.Header().Get(cache.HeaderCache), rec.Body.String())
+	}
+
+	send("/catalog/items", "en")
+	send("/catalog/items", "en")
+	send("/catalog/items", "de")
+	send("/catalog/cart", "en")
+	send("/catalog/cart", "en")
+	send("/catalog/live/prices", "en")
+
+	purged, _ := c.PurgePath(context.Background(), "/catalog/items")
+	fmt.Println("purged", purged)
+	send("/catalog/items", "en")
+
+	// Output:
+	// /catalog/items en: MISS "call 1"
+	// /catalog/items en: HIT "call 1"
+	// /catalog/items de: MISS "call 2"
+	// /catalog/cart en: MISS "call 3"
+	// /catalog/cart en: MISS "call 4"
+	// /catalog/live/prices en: BYPASS "call 5"
+	// purged 2
+	// /catalog/items en: MISS "call 6"
+}
+
+// ExampleCache_coalescing shows concurrent misses sharing one upstream call
+func ExampleCache_coalescing() {
+	c, err := cache.New(&apidef.APIDefinition{
+		APIID:       "catalog",
+		CacheConfig: &apidef.CacheConfig{Enabled: true, TTL: time.Minute},
+	}, cache.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		fmt.Fprint(w, "items")
+	}))
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalog/items", nil))
+			bodies[i] = rec.Body.String()
+		}()
+	}
+
+	// Let every request join the in-flight call before answering it
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	fmt.Println("upstream calls:", calls.Load())
+	fmt.Println("responses:", bodies[0], bodies[9])
+
+	// Output:
+	// upstream calls: 1
+	// responses: items items
+}
+
+// ExampleCache_uncacheable shows requests waiting on an upstream call being
+// forwarded on their own once its response turns out not to be cacheable
+func ExampleCache_uncacheable() {
+	c, err := cache.New(&apidef.APIDefinition{
+		APIID:       "feed",
+		CacheConfig: &apidef.CacheConfig{Enabled: true, TTL: time.Minute},
+	}, cache.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	var calls atomic.Int32
+	entered, answer, finish := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			fmt.Fprint(w, "fresh")
+			return
+		}
+		// The first call streams a response that must not be stored
+		close(entered)
+		<-answer
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		<-finish
+		fmt.Fprint(w, "stream")
+	}))
+
+	get := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feed/live", nil))
+		return rec.Body.String()
+	}
+
+	leader := make(chan string)
+	go func() { leader <- get() }()
+	<-entered
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 3)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = get()
+		}()
+	}
+
+	// Let the requests join the call before the upstream answers, then
+	// serve them while the first response is still streaming
+	time.Sleep(50 * time.Millisecond)
+	close(answer)
+	wg.Wait()
+	fmt.Println("waiting requests:", bodies)
+	close(finish)
+	fmt.Println("first request:", <-leader)
+	fmt.Println("upstream calls:", calls.Load())
+
+	// Output:
+	// waiting requests: [fresh fresh fresh]
+	// first request: stream
+	// upstream calls: 4
+}
+
+// ExampleCache_authenticated shows that responses to authenticated requests
+// are only shared when the upstream marks them public
+func ExampleCache_authenticated() {
+	c, err := cache.New(&apidef.APIDefinition{
+		APIID:       "accounts",
+		CacheConfig: &apidef.CacheConfig{Enabled: true, TTL: time.Minute},
+	}, cache.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/accounts/plans" {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		}
+		fmt.Fprintf(w, "for %s", r.Header.Get("Authorization"))
+	}))
+
+	send := func(path, credentials string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", credentials)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Printf("%s: %s %q\n", path, rec.Header().Get(cache.HeaderCache), rec.Body.String())
+	}
+
+	send("/accounts/me", "Bearer alice")
+	send("/accounts/me", "Bearer bob")
+	send("/accounts/plans", "Bearer alice")
+	send("/accounts/plans", "Bearer bob")
+
+	// Output:
+	// /accounts/me: MISS "for Bearer alice"
+	// /accounts/me: MISS "for Bearer bob"
+	// /accounts/plans: MISS "for Bearer alice"
+	// /accounts/plans: HIT "for Bearer alice"
+}
+
+// ExampleAdminHandler shows a Dragonfly store shared by every API and purged
+// through the admin API
+func ExampleAdminHandler() {
+	client, err := dragonfly.NewClient(dragonfly.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to dragonfly: %v", err)
+	}
+	defer client.Stop()
+
+	if err := client.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start dragonfly client: %v", err)
+	}
+
+	store := cache.NewDragonflyStore(client, "")
+
+	c, err := cache.New(&apidef.APIDefinition{
+		APIID: "catalog",
+		CacheConfig: &apidef.CacheConfig{
+			Enabled:         true,
+			TTL:             5 * time.Minute,
+			CacheKeys:       []string{"query:page", cache.KeyPrincipal},
+			SkipMethods:     []string{http.MethodHead},
+			OnlyStatusCodes: []int{http.StatusOK, http.StatusNotFound},
+			Storage:         cache.StorageRedis,
+		},
+	}, cache.WithStore(store))
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	http.Handle("/catalog/", c.Middleware(http.NotFoundHandler()))
+	http.Handle("/admin/cache/", http.StripPrefix("/admin", cache.AdminHandler(store)))
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory store defaults
+const (
+	DefaultMaxEntries = 10000
+	DefaultMaxBytes   = 64 << 20
+)
+
+// Entry is a cached upstream response
+type Entry struct {
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body"`
+	StoredAt  time.Time   `json:"stored_at"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// Store holds cached responses
+type Store interface {
+	// Get returns the cached entry, or nil when the key is not cached
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+	// DeletePrefix removes every entry whose key starts with prefix and
+	// returns how many were removed
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// MemoryStore is an in-process LRU store bounded by entry count and total
+// body size. It is not shared between gateway nodes.
+type MemoryStore struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	size       int64
+	maxEntries int
+	maxBytes   int64
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewMemoryStore creates an LRU store. Non-positive limits use the defaults.
+func NewMemoryStore(maxEntries int, maxBytes int64) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &MemoryStore{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	item := element.Value.(*memoryItem)
+	if !time.Now().Before(item.entry.ExpiresAt) {
+		s.remove(element)
+		return nil, nil
+	}
+	s.lru.MoveToFront(element)
+	return item.entry, nil
+}
+
+// Set implements Store
+func (s *MemoryStore) Set(_ context.Context, key string, entry *Entry, ttl time.Duration) error {
+	size := int64(len(entry.Body))
+	if ttl <= 0 || size > s.maxBytes {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+	s.entries[key] = s.lru.PushFront(&memoryItem{key: key, entry: entry})
+	s.size += size
+
+	for len(s.entries) > s.maxEntries || s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+// DeletePrefix implements Store
+func (s *MemoryStore) DeletePrefix(_ context.Context, prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, element := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(element)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Len returns the number of cached entries, including expired ones not yet evicted
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Internal methods
+
+func (s *MemoryStore) remove(element *list.Element) {
+	item := s.lru.Remove(element).(*memoryItem)
+	delete(s.entries, item.key)
+	s.size -= int64(len(item.entry.Body))
+}
@@ -0,0 +1,135 @@
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Common change feed errors
+var (
+	ErrInvalidEvent = errors.New("invalid change event")
+	ErrNilTransport = errors.New("change feed transport cannot be nil")
+)
+
+// EventType is the kind of change an event announces
+type EventType string
+
+// Event types
+const (
+	EventUpsert EventType = "upsert"
+	EventDelete EventType = "delete"
+)
+
+// Event announces that an API definition was stored or deleted. Revision is
+// the repository revision of the change; nodes ignore events older than
+// what they hold. Upserts carry the definition, so nodes do not need to
+// read it back from Postgres.
+type Event struct {
+	Type       EventType             `json:"type"`
+	APIID      string                `json:"api_id"`
+	Revision   int64                 `json:"revision"`
+	Definition *apidef.APIDefinition `json:"definition,omitempty"`
+	Time       time.Time             `json:"time"`
+}
+
+// UpsertEvent announces a created, updated or restored definition
+func UpsertEvent(def *apidef.APIDefinition) *Event {
+	return &Event{
+		Type:       EventUpsert,
+		APIID:      def.APIID,
+		Revision:   def.Revision,
+		Definition: def,
+		Time:       time.Now(),
+	}
+}
+
+// DeleteEvent announces a deleted definition. revision is the revision
+// recorded for the deletion.
+func DeleteEvent(apiID string, revision int64) *Event {
+	return &Event{
+		Type:     EventDelete,
+		APIID:    apiID,
+		Revision: revision,
+		Time:     time.Now(),
+	}
+}
+
+// Validate checks an event is complete
+func (e *Event) Validate() error {
+	if e.APIID == "" {
+		return fmt.Errorf("%w: api_id is required", ErrInvalidEvent)
+	}
+	switch e.Type {
+	case EventUpsert:
+		if e.Definition == nil || e.Definition.APIID != e.APIID {
+			return fmt.Errorf("%w: upsert of %s must carry its definition", ErrInvalidEvent, e.APIID)
+		}
+	case EventDelete:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidEvent, e.Type)
+	}
+	return nil
+}
+
+// Handler receives the messages of a subscription
+type Handler interface {
+	HandleMessage(ctx context.Context, data []byte)
+	HandleError(ctx context.Context, err error)
+}
+
+// Transport carries encoded events from publishers to every subscribed
+// node. Delivery may be lossy; nodes heal by resyncing.
+type Transport interface {
+	// Publish sends a message. key orders messages of the same API on
+	// transports that partition.
+	Publish(ctx context.Context, key string, data []byte) error
+	// Subscribe returns once subscribed and calls handler from a single
+	// goroutine until ctx is done
+	Subscribe(ctx context.Context, handler Handler) error
+}
+
+// Publisher announces definition changes to gateway nodes. Publish after
+// the change is committed to the repository.
+type Publisher struct {
+	transport Transport
+}
+
+// NewPublisher creates a publisher
+func NewPublisher(transport Transport) (*Publisher, error) {
+	if transport == nil {
+		return nil, ErrNilTransport
+	}
+	return &Publisher{transport: transport}, nil
+}
+
+// Publish sends an event
+func (p *Publisher) Publish(ctx context.Context, event *Event) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode change event: %w", err)
+	}
+	if err := p.transport.Publish(ctx, event.APIID, data); err != nil {
+		return fmt.Errorf("failed to publish change event: %w", err)
+	}
+	return nil
+}
+
+func decodeEvent(data []byte) (*Event, error) {
+	event := &Event{}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,177 @@
+package changefeed_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/changefeed"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+	"github.com/vzahanych/gochoreo/pkg/repository"
+	"github.com/vzahanych/gochoreo/pkg/router"
+)
+
+// source is an in-memory stand-in for the repository
+type source struct {
+	mu   sync.Mutex
+	defs []*apidef.APIDefinition
+}
+
+func (s *source) List(ctx context.Context, options repository.ListOptions) (*repository.ListResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &repository.ListResult{Definitions: s.defs}, nil
+}
+
+func definition(apiID, listenPath string, revision int64) *apidef.APIDefinition {
+	return &apidef.APIDefinition{
+		APIID:      apiID,
+		Name:       apiID,
+		ListenPath: listenPath,
+		Status:     apidef.StatusActive,
+		Proxy:      apidef.ProxyConfig{TargetURL: "http://" + apiID + ":8080"},
+		Revision:   revision,
+	}
+}
+
+func printRoutes(r *router.Router) {
+	var routes []string
+	for _, route := range r.Routes() {
+		routes = append(routes, fmt.Sprintf("%s@%d", route.ListenPath, route.Definition.Revision))
+	}
+	fmt.Println(routes)
+}
+
+// ExampleSyncer applies published changes to a node's router, ignores a
+// stale event, and heals a missed one by resyncing. Only changed
+// definitions get new handlers.
+func ExampleSyncer() {
+	ctx := context.Background()
+
+	var built atomic.Int64
+	r, err := router.New(func(def *apidef.APIDefinition) (http.Handler, error) {
+		built.Add(1)
+		return http.NotFoundHandler(), nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+
+	transport := changefeed.NewMemoryTransport()
+	store := &source{defs: []*apidef.APIDefinition{definition("orders", "/orders", 1)}}
+
+	syncer, err := changefeed.NewSyncer(transport, store, r,
+		changefeed.WithLogger(&logger.Logger{Logger: zap.NewNop()}),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create syncer: %v", err)
+	}
+	if err := syncer.Start(ctx); err != nil {
+		log.Fatalf("Failed to start syncer: %v", err)
+	}
+	defer syncer.Stop()
+	printRoutes(r)
+
+	publisher, err := changefeed.NewPublisher(transport)
+	if err != nil {
+		log.Fatalf("Failed to create publisher: %v", err)
+	}
+	publish := func(event *changefeed.Event) {
+		if err := publisher.Publish(ctx, event); err != nil {
+			log.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	publish(changefeed.UpsertEvent(definition("orders", "/shop/orders", 2)))
+	publish(changefeed.UpsertEvent(definition("billing", "/billing", 1)))
+	printRoutes(r)
+
+	// Delivered late, after revision 2
+	publish(changefeed.UpsertEvent(definition("orders", "/orders", 1)))
+	printRoutes(r)
+
+	publish(changefeed.DeleteEvent("billing", 2))
+	printRoutes(r)
+
+	// A change whose event was lost
+	store.mu.Lock()
+	store.defs = []*apidef.APIDefinition{definition("orders", "/v3/orders", 3)}
+	store.mu.Unlock()
+	if err := syncer.Resync(ctx); err != nil {
+		log.Fatalf("Failed to resync: %v", err)
+	}
+	printRoutes(r)
+
+	// Nothing changed since
+	if err := syncer.Resync(ctx); err != nil {
+		log.Fatalf("Failed to resync: %v", err)
+	}
+	fmt.Println(built.Load(), "handlers built")
+
+	// Output:
+	// [/orders@1]
+	// [/billing@1 /shop/orders@2]
+	// [/billing@1 /shop/orders@2]
+	// [/shop/orders@2]
+	// [/v3/orders@3]
+	// 4 handlers built
+}
+
+// ExampleNewDragonflyTransport wires a node to the Postgres repository and
+// Dragonfly pub/sub; admin processes publish on the same channel after
+// committing changes
+func ExampleNewDragonflyTransport() {
+	ctx := context.Background()
+
+	db, err := postgres.New(ctx, postgres.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	defer db.Close()
+
+	repo, err := repository.New(db)
+	if err != nil {
+		log.Fatalf("Failed to create repository: %v", err)
+	}
+
+	client, err := dragonfly.NewClient(dragonfly.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to create dragonfly client: %v", err)
+	}
+	if err := client.Start(ctx); err != nil {
+		log.Fatalf("Failed to connect to dragonfly: %v", err)
+	}
+	defer client.Stop()
+
+	transport, err := changefeed.NewDragonflyTransport(client, "")
+	if err != nil {
+		log.Fatalf("Failed to create transport: %v", err)
+	}
+
+	r, err := router.New(func(def *apidef.APIDefinition) (http.Handler, error) {
+		return http.NotFoundHandler(), nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+
+	syncer, err := changefeed.NewSyncer(transport, repo, r, changefeed.WithResyncInterval(time.Minute))
+	if err != nil {
+		log.Fatalf("Failed to create syncer: %v", err)
+	}
+	if err := syncer.Start(ctx); err != nil {
+		log.Fatalf("Failed to start syncer: %v", err)
+	}
+	defer syncer.Stop()
+
+	http.Handle("/", r)
+}
@@ -0,0 +1,340 @@
+package changefeed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/repository"
+)
+
+// DefaultResyncInterval is how often nodes reload every definition from
+// the source of truth
+const DefaultResyncInterval = 30 * time.Second
+
+// Source lists the stored definitions, such as a repository.Repository
+type Source interface {
+	List(ctx context.Context, options repository.ListOptions) (*repository.ListResult, error)
+}
+
+// Loader compiles definitions and swaps them in, such as a router.Router,
+// which keeps the handlers of definitions that did not change
+type Loader interface {
+	Load(defs []*apidef.APIDefinition) error
+}
+
+// Syncer keeps a gateway node's routing up to date. It applies change
+// events as they arrive and periodically reloads every definition from the
+// source, healing from events the transport lost. Each change loads the
+// full set of definitions; resyncs finding nothing new load nothing.
+type Syncer struct {
+	transport Transport
+	source    Source
+	loader    Loader
+	interval  time.Duration
+	logger    *logger.Logger
+
+	mu         sync.Mutex
+	entries    map[string]*entry
+	seq        uint64
+	lastResync time.Time
+
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// entry is the latest known state of an API. Deleted APIs are kept as
+// tombstones until the next resync, so late events cannot revive them.
+type entry struct {
+	def      *apidef.APIDefinition
+	revision int64
+	// seq orders local changes, telling which happened during a resync
+	seq uint64
+}
+
+// Option allows customization of the syncer
+type Option func(*Syncer)
+
+// WithResyncInterval sets how often every definition is reloaded from the
+// source
+func WithResyncInterval(interval time.Duration) Option {
+	return func(s *Syncer) {
+		s.interval = interval
+	}
+}
+
+// WithLogger sets the logger
+func WithLogger(log *logger.Logger) Option {
+	return func(s *Syncer) {
+		s.logger = log
+	}
+}
+
+// NewSyncer creates a syncer loading the definitions of source, kept up to
+// date by the events of transport, into loader
+func NewSyncer(transport Transport, source Source, loader Loader, options ...Option) (*Syncer, error) {
+	if transport == nil {
+		return nil, ErrNilTransport
+	}
+	if source == nil {
+		return nil, fmt.Errorf("change feed source cannot be nil")
+	}
+	if loader == nil {
+		return nil, fmt.Errorf("change feed loader cannot be nil")
+	}
+
+	s := &Syncer{
+		transport: transport,
+		source:    source,
+		loader:    loader,
+		interval:  DefaultResyncInterval,
+		entries:   make(map[string]*entry),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	if s.interval <= 0 {
+		return nil, fmt.Errorf("resync interval must be greater than 0")
+	}
+	if s.logger == nil {
+		s.logger = logger.GetGlobalLogger()
+	}
+	s.logger = s.logger.WithComponent("changefeed")
+
+	return s, nil
+}
+
+// Start subscribes to changes, loads every definition and resyncs
+// periodically until Stop is called or ctx is done. It fails when the
+// initial load does.
+func (s *Syncer) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	// Subscribe first, so no change made while loading is missed
+	if err := s.transport.Subscribe(ctx, &subscriber{syncer: s}); err != nil {
+		cancel()
+		return fmt.Errorf("failed to subscribe to changes: %w", err)
+	}
+	if err := s.Resync(ctx); err != nil {
+		cancel()
+		return err
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Resync(ctx); err != nil {
+					s.logger.Warn("Failed to resync api definitions", zap.Error(err))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends the subscription and periodic resync
+func (s *Syncer) Stop() {
+	s.stopOnce.Do(func() {
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+	s.wg.Wait()
+}
+
+// Resync reloads every definition from the source. Changes received while
+// listing are kept when newer than what was listed. Definitions listed at
+// the revision already held are kept as held, and nothing is loaded when
+// no definition changed.
+func (s *Syncer) Resync(ctx context.Context) error {
+	s.mu.Lock()
+	start := s.seq
+	s.mu.Unlock()
+
+	defs, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[string]*entry, len(defs))
+	for _, def := range defs {
+		if held, ok := s.entries[def.APIID]; ok && held.def != nil && def.Revision != 0 && held.revision == def.Revision {
+			entries[def.APIID] = held
+			continue
+		}
+		entries[def.APIID] = &entry{def: def, revision: def.Revision, seq: start}
+	}
+	for apiID, current := range s.entries {
+		if current.seq <= start {
+			continue
+		}
+		if listed, ok := entries[apiID]; !ok || newer(current.revision, listed.revision) {
+			entries[apiID] = current
+		}
+	}
+
+	previous := s.entries
+	s.entries = entries
+	if !sameDefinitions(previous, entries) {
+		if err := s.reload(); err != nil {
+			s.entries = previous
+			return err
+		}
+	}
+
+	s.lastResync = time.Now()
+	s.logger.Debug("Resynced api definitions", zap.Int("definitions", len(defs)))
+	return nil
+}
+
+// Apply applies a change event, ignoring it when the node already holds
+// the same or a later revision of the API
+func (s *Syncer) Apply(event *Event) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.entries[event.APIID]
+	if ok && !newer(event.Revision, current.revision) {
+		return nil
+	}
+
+	s.seq++
+	next := &entry{revision: event.Revision, seq: s.seq}
+	if event.Type == EventUpsert {
+		next.def = event.Definition
+	}
+	s.entries[event.APIID] = next
+
+	if err := s.reload(); err != nil {
+		// Keep serving the previous table; the next resync retries
+		if ok {
+			s.entries[event.APIID] = current
+		} else {
+			delete(s.entries, event.APIID)
+		}
+		return err
+	}
+	return nil
+}
+
+// LastResync returns when definitions were last fully reloaded
+func (s *Syncer) LastResync() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastResync
+}
+
+// Internal methods
+
+func (s *Syncer) list(ctx context.Context) ([]*apidef.APIDefinition, error) {
+	var defs []*apidef.APIDefinition
+	options := repository.ListOptions{Limit: repository.MaxPageSize}
+	for {
+		page, err := s.source.List(ctx, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list api definitions: %w", err)
+		}
+		defs = append(defs, page.Definitions...)
+		if page.NextCursor == "" {
+			return defs, nil
+		}
+		options.Cursor = page.NextCursor
+	}
+}
+
+// reload loads the held definitions. Callers hold mu, which also keeps
+// loads in order.
+func (s *Syncer) reload() error {
+	defs := make([]*apidef.APIDefinition, 0, len(s.entries))
+	for _, e := range s.entries {
+		if e.def != nil {
+			defs = append(defs, e.def)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].APIID < defs[j].APIID
+	})
+
+	if err := s.loader.Load(defs); err != nil {
+		return fmt.Errorf("failed to load api definitions: %w", err)
+	}
+	return nil
+}
+
+// sameDefinitions reports whether two sets of entries hold the same
+// definitions, tombstones aside
+func sameDefinitions(a, b map[string]*entry) bool {
+	count := 0
+	for apiID, e := range b {
+		if e.def == nil {
+			continue
+		}
+		if held, ok := a[apiID]; !ok || held.def != e.def {
+			return false
+		}
+		count++
+	}
+	for _, e := range a {
+		if e.def != nil {
+			count--
+		}
+	}
+	return count == 0
+}
+
+// newer reports whether revision supersedes current. Definitions managed
+// outside the repository have no revision and always apply.
+func newer(revision, current int64) bool {
+	return revision == 0 || current == 0 || revision > current
+}
+
+// subscriber handles the messages of the syncer's subscription
+type subscriber struct {
+	syncer *Syncer
+}
+
+func (sub *subscriber) HandleMessage(ctx context.Context, data []byte) {
+	event, err := decodeEvent(data)
+	if err != nil {
+		sub.syncer.logger.Warn("Ignoring invalid change event", zap.Error(err))
+		return
+	}
+	if err := sub.syncer.Apply(event); err != nil {
+		sub.syncer.logger.Error("Failed to apply change event",
+			zap.String("api_id", event.APIID),
+			zap.Int64("revision", event.Revision),
+			zap.String("type", string(event.Type)),
+			zap.Error(err),
+		)
+	}
+}
+
+func (sub *subscriber) HandleError(ctx context.Context, err error) {
+	sub.syncer.logger.Warn("Change feed error", zap.Error(err))
+}
@@ -0,0 +1,173 @@
+package changefeed
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/kafka"
+)
+
+// Transport defaults
+const (
+	DefaultChannel = "gochoreo:apidefs"
+	DefaultTopic   = "gochoreo.apidefs"
+)
+
+// MemoryTransport delivers messages within the process, for gateways
+// running their admin API and a single node together
+type MemoryTransport struct {
+	mu       sync.Mutex
+	handlers map[*memorySubscription]struct{}
+}
+
+type memorySubscription struct {
+	ctx     context.Context
+	handler Handler
+}
+
+// NewMemoryTransport creates an in-process transport
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{handlers: make(map[*memorySubscription]struct{})}
+}
+
+// Publish delivers a message to every subscriber before returning
+func (t *MemoryTransport) Publish(ctx context.Context, key string, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for sub := range t.handlers {
+		if sub.ctx.Err() == nil {
+			sub.handler.HandleMessage(sub.ctx, data)
+		}
+	}
+	return nil
+}
+
+// Subscribe implements Transport
+func (t *MemoryTransport) Subscribe(ctx context.Context, handler Handler) error {
+	sub := &memorySubscription{ctx: ctx, handler: handler}
+
+	t.mu.Lock()
+	t.handlers[sub] = struct{}{}
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.handlers, sub)
+		t.mu.Unlock()
+	}()
+	return nil
+}
+
+// DragonflyTransport carries messages over Dragonfly pub/sub. Messages
+// published while a node is disconnected are lost to it.
+type DragonflyTransport struct {
+	client  *dragonfly.Client
+	channel string
+}
+
+// NewDragonflyTransport creates a pub/sub transport on channel, or
+// DefaultChannel when empty
+func NewDragonflyTransport(client *dragonfly.Client, channel string) (*DragonflyTransport, error) {
+	if client == nil {
+		return nil, fmt.Errorf("dragonfly client cannot be nil")
+	}
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &DragonflyTransport{client: client, channel: channel}, nil
+}
+
+// Publish implements Transport
+func (t *DragonflyTransport) Publish(ctx context.Context, key string, data []byte) error {
+	if err := t.client.Client().Publish(ctx, t.channel, data).Err(); err != nil {
+		return dragonfly.WrapError(err, "failed to publish to "+t.channel)
+	}
+	return nil
+}
+
+// Subscribe implements Transport. The subscription reconnects by itself.
+func (t *DragonflyTransport) Subscribe(ctx context.Context, handler Handler) error {
+	pubsub := t.client.Subscribe(ctx, t.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return dragonfly.WrapError(err, "failed to subscribe to "+t.channel)
+	}
+
+	go func() {
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				handler.HandleMessage(ctx, []byte(message.Payload))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// KafkaTransport carries messages over a Kafka topic, keyed by API so the
+// changes of one API stay in order. Every node must consume with its own
+// consumer group ID, otherwise nodes share the topic's messages instead of
+// each receiving all of them.
+type KafkaTransport struct {
+	client *kafka.Client
+	topic  string
+}
+
+// NewKafkaTransport creates a transport on topic, or DefaultTopic when
+// empty
+func NewKafkaTransport(client *kafka.Client, topic string) (*KafkaTransport, error) {
+	if client == nil {
+		return nil, fmt.Errorf("kafka client cannot be nil")
+	}
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	return &KafkaTransport{client: client, topic: topic}, nil
+}
+
+// Publish implements Transport
+func (t *KafkaTransport) Publish(ctx context.Context, key string, data []byte) error {
+	_, err := t.client.ProduceSync(ctx, &kafka.ProducerMessage{
+		Topic:     t.topic,
+		Key:       []byte(key),
+		Value:     data,
+		Partition: -1,
+	})
+	return err
+}
+
+// Subscribe implements Transport
+func (t *KafkaTransport) Subscribe(ctx context.Context, handler Handler) error {
+	return t.client.ConsumeMessages(ctx, []string{t.topic}, &kafkaHandler{handler: handler})
+}
+
+// kafkaHandler adapts a Handler to Kafka consumers
+type kafkaHandler struct {
+	mu      sync.Mutex
+	handler Handler
+}
+
+func (h *kafkaHandler) HandleMessage(ctx context.Context, message *kafka.Message) error {
+	// Partitions are consumed concurrently
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.handler.HandleMessage(ctx, message.Value)
+	return nil
+}
+
+func (h *kafkaHandler) HandleError(ctx context.Context, err error) {
+	h.handler.HandleError(ctx, err)
+}
@@ -0,0 +1,202 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// State represents the state of a circuit
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// Defaults applied to zero-valued CircuitBreakerConfig fields
+const (
+	DefaultConsecutiveFailures = 5
+	DefaultCoolDown            = 30 * time.Second
+	DefaultHalfOpenRequests    = 1
+)
+
+// Hooks receive breaker events. They are called with the breaker lock held,
+// so they observe transitions in order and must not call back into the breaker.
+type Hooks struct {
+	// OnStateChange is called on every state transition
+	OnStateChange func(from, to State)
+
+	// OnAvailabilityChange is called when the breaker starts or stops accepting requests
+	OnAvailabilityChange func(available bool)
+}
+
+// Breaker is a per-target circuit breaker. It opens after a number of
+// consecutive failures, stays open for a cool-down, then lets a limited
+// number of trial requests through before closing again.
+type Breaker struct {
+	config apidef.CircuitBreakerConfig
+	hooks  Hooks
+
+	mu             sync.Mutex
+	state          State
+	failures       int
+	successes      int
+	inFlightTrials int
+	openedAt       time.Time
+	timer          *time.Timer
+	available      bool
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(config apidef.CircuitBreakerConfig, hooks Hooks) *Breaker {
+	return &Breaker{
+		config:    withDefaults(config),
+		hooks:     hooks,
+		state:     StateClosed,
+		available: true,
+	}
+}
+
+// Allow reports whether a request may be sent. In the half-open state each
+// allowed request counts as a trial whose result must be recorded.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		return true
+	case StateHalfOpen:
+		if !b.hasTrialCapacity() {
+			return false
+		}
+		b.inFlightTrials++
+		b.updateAvailability()
+		return true
+	default:
+		return false
+	}
+}
+
+// Record records the outcome of a request previously allowed by Allow
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.config.ConsecutiveFailures {
+			b.open()
+		}
+
+	case StateHalfOpen:
+		// Results of requests sent before the circuit opened are not trials
+		if b.inFlightTrials == 0 {
+			return
+		}
+		b.inFlightTrials--
+		if !success {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenRequests {
+			b.transition(StateClosed)
+			return
+		}
+		b.updateAvailability()
+	}
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// OpenedAt returns when the circuit last opened
+func (b *Breaker) OpenedAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt
+}
+
+// Stop cancels a pending half-open transition
+func (b *Breaker) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
+
+// Internal methods, called with the lock held
+
+func (b *Breaker) open() {
+	b.openedAt = time.Now()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.timer = time.AfterFunc(b.config.CoolDown, b.halfOpen)
+	b.transition(StateOpen)
+}
+
+func (b *Breaker) halfOpen() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		b.transition(StateHalfOpen)
+	}
+}
+
+func (b *Breaker) transition(to State) {
+	from := b.state
+	b.state = to
+	b.failures = 0
+	b.successes = 0
+	b.inFlightTrials = 0
+
+	if from != to && b.hooks.OnStateChange != nil {
+		b.hooks.OnStateChange(from, to)
+	}
+	b.updateAvailability()
+}
+
+func (b *Breaker) hasTrialCapacity() bool {
+	return b.inFlightTrials < b.config.HalfOpenRequests-b.successes
+}
+
+func (b *Breaker) updateAvailability() {
+	available := b.state == StateClosed || (b.state == StateHalfOpen && b.hasTrialCapacity())
+	if available == b.available {
+		return
+	}
+	b.available = available
+	if b.hooks.OnAvailabilityChange != nil {
+		b.hooks.OnAvailabilityChange(available)
+	}
+}
+
+// withDefaults fills zero-valued fields with sensible defaults
+func withDefaults(config apidef.CircuitBreakerConfig) apidef.CircuitBreakerConfig {
+	if config.ConsecutiveFailures <= 0 {
+		config.ConsecutiveFailures = DefaultConsecutiveFailures
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = DefaultCoolDown
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+	return config
+}
@@ -0,0 +1,84 @@
+package circuitbreaker_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/balancer"
+	"github.com/vzahanych/gochoreo/pkg/circuitbreaker"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// ExampleSelector demonstrates ejecting a failing target and readmitting it after a trial
+func ExampleSelector() {
+	lb, err := balancer.New([]apidef.UpstreamTarget{
+		{ID: "a", URL: "http://10.0.0.1:8080"},
+		{ID: "b", URL: "http://10.0.0.2:8080"},
+	}, apidef.LoadBalanceRoundRobin)
+	if err != nil {
+		log.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	cb, err := circuitbreaker.New(&apidef.CircuitBreakerConfig{
+		Enabled:             true,
+		ConsecutiveFailures: 2,
+		CoolDown:            50 * time.Millisecond,
+		HalfOpenRequests:    1,
+	}, lb, circuitbreaker.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create circuit breaker: %v", err)
+	}
+	defer cb.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// Two consecutive failures against "a" open its circuit
+	for cb.State("a") == circuitbreaker.StateClosed {
+		target, _ := cb.Select(req)
+		if target.ID == "a" {
+			cb.Release(target, 0, errors.New("connection refused"))
+		} else {
+			cb.Release(target, http.StatusOK, nil)
+		}
+	}
+	fmt.Println("a:", cb.State("a"), "available:", lb.IsAvailable("a"))
+
+	// While open, all traffic goes to "b"
+	picks := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		target, _ := cb.Select(req)
+		picks = append(picks, target.ID)
+		cb.Release(target, http.StatusOK, nil)
+	}
+	fmt.Println(strings.Join(picks, " "))
+
+	// After the cool-down a single trial request is let through
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println("a:", cb.State("a"), "available:", lb.IsAvailable("a"))
+
+	for {
+		target, _ := cb.Select(req)
+		if target.ID == "a" {
+			fmt.Println("a: trial in flight, available:", lb.IsAvailable("a"))
+			cb.Release(target, http.StatusOK, nil)
+			break
+		}
+		cb.Release(target, http.StatusOK, nil)
+	}
+	fmt.Println("a:", cb.State("a"), "available:", lb.IsAvailable("a"))
+
+	// Output:
+	// a: open available: false
+	// b b b
+	// a: half_open available: true
+	// a: trial in flight, available: false
+	// a: closed available: true
+}
@@ -0,0 +1,81 @@
+package circuitbreaker
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/vzahanych/gochoreo/pkg/otel"
+)
+
+// metrics holds the OpenTelemetry instruments used to alert on ejected targets
+type metrics struct {
+	stateChanges metric.Int64Counter
+	ejected      metric.Int64UpDownCounter
+	rejected     metric.Int64Counter
+}
+
+func newMetrics(client *otel.Client) (*metrics, error) {
+	stateChanges, err := client.Counter(
+		"upstream_circuit_state_changes_total",
+		"Total number of upstream circuit breaker state transitions",
+		"1",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create state change counter: %w", err)
+	}
+
+	ejected, err := client.UpDownCounter(
+		"upstream_targets_ejected",
+		"Number of upstream targets currently ejected by their circuit breaker",
+		"1",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ejected targets counter: %w", err)
+	}
+
+	rejected, err := client.Counter(
+		"upstream_circuit_rejected_requests_total",
+		"Total number of requests rejected because of an open circuit",
+		"1",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rejected requests counter: %w", err)
+	}
+
+	return &metrics{
+		stateChanges: stateChanges,
+		ejected:      ejected,
+		rejected:     rejected,
+	}, nil
+}
+
+func (m *metrics) recordStateChange(target string, from, to State) {
+	if m == nil {
+		return
+	}
+
+	ctx := context.Background()
+	m.stateChanges.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("target", target),
+		attribute.String("from", string(from)),
+		attribute.String("to", string(to)),
+	))
+
+	// A target counts as ejected from the moment its circuit opens until it closes
+	switch {
+	case to == StateOpen && from == StateClosed:
+		m.ejected.Add(ctx, 1, metric.WithAttributes(attribute.String("target", target)))
+	case to == StateClosed:
+		m.ejected.Add(ctx, -1, metric.WithAttributes(attribute.String("target", target)))
+	}
+}
+
+func (m *metrics) recordRejected(target string) {
+	if m == nil {
+		return
+	}
+	m.rejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("target", target)))
+}
@@ -0,0 +1,216 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/balancer"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/otel"
+)
+
+// ErrCircuitOpen is returned when every candidate target has an open circuit
+var ErrCircuitOpen = errors.New("upstream circuit is open")
+
+// maxSelectAttempts bounds how often Select re-picks when a target rejects the request
+const maxSelectAttempts = 3
+
+// TargetSelector is the selector being protected, typically a *balancer.Balancer
+type TargetSelector interface {
+	Select(r *http.Request) (*apidef.UpstreamTarget, error)
+	Release(target *apidef.UpstreamTarget, statusCode int, err error)
+}
+
+// Ejector is implemented by selectors that can take targets out of rotation
+type Ejector interface {
+	SetEjected(key string, ejected bool) error
+}
+
+// BreakerStats is a point-in-time view of a target's circuit
+type BreakerStats struct {
+	Target string `json:"target"`
+	State  State  `json:"state"`
+}
+
+// Selector wraps a TargetSelector with passive health checking: it counts
+// consecutive 5xx responses and transport errors per target and opens the
+// target's circuit, ejecting it from rotation for the cool-down period.
+type Selector struct {
+	config  apidef.CircuitBreakerConfig
+	next    TargetSelector
+	ejector Ejector
+	metrics *metrics
+	logger  *logger.Logger
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// Option allows customization of the selector
+type Option func(*Selector) error
+
+// WithMetrics reports circuit transitions through the given OpenTelemetry client
+func WithMetrics(client *otel.Client) Option {
+	return func(s *Selector) error {
+		m, err := newMetrics(client)
+		if err != nil {
+			return err
+		}
+		s.metrics = m
+		return nil
+	}
+}
+
+// WithLogger sets the logger used for circuit transitions
+func WithLogger(log *logger.Logger) Option {
+	return func(s *Selector) error {
+		s.logger = log
+		return nil
+	}
+}
+
+// New wraps next with per-target circuit breakers. If next implements Ejector,
+// open targets are removed from its rotation; otherwise requests to them fail
+// fast with ErrCircuitOpen.
+func New(config *apidef.CircuitBreakerConfig, next TargetSelector, options ...Option) (*Selector, error) {
+	if config == nil {
+		return nil, fmt.Errorf("circuit breaker config cannot be nil")
+	}
+	if next == nil {
+		return nil, fmt.Errorf("target selector cannot be nil")
+	}
+
+	s := &Selector{
+		config:   withDefaults(*config),
+		next:     next,
+		breakers: make(map[string]*Breaker),
+	}
+	s.ejector, _ = next.(Ejector)
+
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.logger == nil {
+		s.logger = logger.GetGlobalLogger()
+	}
+	s.logger = s.logger.WithComponent("circuitbreaker")
+
+	return s, nil
+}
+
+// Select picks a target whose circuit accepts the request
+func (s *Selector) Select(r *http.Request) (*apidef.UpstreamTarget, error) {
+	for attempt := 0; attempt < maxSelectAttempts; attempt++ {
+		target, err := s.next.Select(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.breakerFor(target).Allow() {
+			return target, nil
+		}
+
+		s.metrics.recordRejected(balancer.TargetKey(target))
+		s.next.Release(target, 0, ErrCircuitOpen)
+	}
+	return nil, ErrCircuitOpen
+}
+
+// Release records the attempt outcome on the target's circuit
+func (s *Selector) Release(target *apidef.UpstreamTarget, statusCode int, err error) {
+	// A client hanging up says nothing about the upstream
+	if !errors.Is(err, context.Canceled) {
+		s.breakerFor(target).Record(err == nil && statusCode < http.StatusInternalServerError)
+	}
+	s.next.Release(target, statusCode, err)
+}
+
+// State returns the circuit state of a target
+func (s *Selector) State(key string) State {
+	s.mu.Lock()
+	breaker, ok := s.breakers[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return StateClosed
+	}
+	return breaker.State()
+}
+
+// Stats returns the circuit state of every target seen so far
+func (s *Selector) Stats() []BreakerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]BreakerStats, 0, len(s.breakers))
+	for key, breaker := range s.breakers {
+		stats = append(stats, BreakerStats{Target: key, State: breaker.State()})
+	}
+	return stats
+}
+
+// Close stops all pending cool-down timers
+func (s *Selector) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, breaker := range s.breakers {
+		breaker.Stop()
+	}
+}
+
+// breakerFor returns the breaker of a target, creating it on first use
+func (s *Selector) breakerFor(target *apidef.UpstreamTarget) *Breaker {
+	key := balancer.TargetKey(target)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	breaker, ok := s.breakers[key]
+	if !ok {
+		breaker = NewBreaker(s.config, s.hooksFor(key, target.URL))
+		s.breakers[key] = breaker
+	}
+	return breaker
+}
+
+func (s *Selector) hooksFor(key, url string) Hooks {
+	return Hooks{
+		OnStateChange: func(from, to State) {
+			s.metrics.recordStateChange(key, from, to)
+
+			if to == StateOpen {
+				s.logger.Warn("Upstream circuit opened, ejecting target",
+					zap.String("target", key),
+					zap.String("url", url),
+					zap.String("from", string(from)),
+					zap.Duration("cool_down", s.config.CoolDown),
+				)
+			} else {
+				s.logger.Info("Upstream circuit state changed",
+					zap.String("target", key),
+					zap.String("url", url),
+					zap.String("from", string(from)),
+					zap.String("to", string(to)),
+				)
+			}
+		},
+		OnAvailabilityChange: func(available bool) {
+			if s.ejector == nil {
+				return
+			}
+			if err := s.ejector.SetEjected(key, !available); err != nil {
+				s.logger.Debug("Failed to update target ejection", zap.String("target", key), zap.Error(err))
+			}
+		},
+	}
+}
@@ -0,0 +1,342 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// CORS request and response headers
+const (
+	HeaderOrigin           = "Origin"
+	HeaderRequestMethod    = "Access-Control-Request-Method"
+	HeaderRequestHeaders   = "Access-Control-Request-Headers"
+	HeaderAllowOrigin      = "Access-Control-Allow-Origin"
+	HeaderAllowMethods     = "Access-Control-Allow-Methods"
+	HeaderAllowHeaders     = "Access-Control-Allow-Headers"
+	HeaderAllowCredentials = "Access-Control-Allow-Credentials"
+	HeaderExposeHeaders    = "Access-Control-Expose-Headers"
+	HeaderMaxAge           = "Access-Control-Max-Age"
+)
+
+// Defaults used when CORSConfig leaves a list empty
+var (
+	DefaultAllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	DefaultAllowedHeaders = []string{"Origin", "Accept", "Content-Type", "X-Requested-With"}
+)
+
+// Common CORS errors
+var (
+	ErrInvalidOrigin        = errors.New("invalid cors origin")
+	ErrCredentialsAnyOrigin = errors.New("cors credentials cannot be allowed for any origin")
+)
+
+// CORS-safelisted methods and request headers are always allowed
+var (
+	safelistedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	safelistedHeaders = []string{"accept", "accept-language", "content-language", "content-type"}
+)
+
+// CORS applies an API definition's CORSConfig
+type CORS struct {
+	enabled         bool
+	passthrough     bool
+	credentials     bool
+	anyOrigin       bool
+	origins         []origin
+	methods         []string
+	allowMethods    string
+	headers         []string
+	anyHeader       bool
+	allowHeaders    string
+	exposeHeaders   string
+	maxAge          string
+	preflightVaries string
+}
+
+// origin is a parsed AllowedOrigins entry. A wildcard origin matches any
+// subdomain of host, at any depth, but not host itself.
+type origin struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+	literal  string
+}
+
+// New creates a CORS handler for an API definition. When EnableCORS is
+// false every request passes through untouched; when it is set without a
+// CORSConfig any origin may use the default methods and headers.
+func New(def *apidef.APIDefinition) (*CORS, error) {
+	if def == nil {
+		return nil, fmt.Errorf("api definition cannot be nil")
+	}
+
+	c := &CORS{enabled: def.EnableCORS}
+	if !c.enabled {
+		return c, nil
+	}
+
+	config := def.CORSConfig
+	if config == nil {
+		config = &apidef.CORSConfig{AllowedOrigins: []string{"*"}}
+	}
+	c.passthrough = config.OptionsPassthrough
+	c.credentials = config.AllowCredentials
+
+	for _, pattern := range config.AllowedOrigins {
+		if err := ValidateOrigin(pattern, c.credentials); err != nil {
+			return nil, err
+		}
+		if pattern == "*" {
+			c.anyOrigin = true
+			continue
+		}
+		parsed, _ := parseOrigin(pattern)
+		c.origins = append(c.origins, parsed)
+	}
+
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultAllowedMethods
+	}
+	for _, method := range methods {
+		c.methods = append(c.methods, strings.ToUpper(method))
+	}
+	c.allowMethods = strings.Join(c.methods, ", ")
+
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultAllowedHeaders
+	}
+	for _, header := range headers {
+		if header == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers = append(c.headers, strings.ToLower(header))
+	}
+	c.allowHeaders = strings.Join(c.headers, ", ")
+
+	c.exposeHeaders = strings.Join(config.ExposedHeaders, ", ")
+	switch {
+	case config.MaxAge > 0:
+		c.maxAge = strconv.Itoa(config.MaxAge)
+	case config.MaxAge < 0:
+		// Ask browsers not to cache preflight results
+		c.maxAge = "0"
+	}
+
+	c.preflightVaries = strings.Join([]string{HeaderOrigin, HeaderRequestMethod, HeaderRequestHeaders}, ", ")
+	return c, nil
+}
+
+// ValidateOrigin reports whether pattern is a valid AllowedOrigins entry:
+// "*", "null", an origin such as https://example.com, or a subdomain
+// wildcard such as https://*.example.com. "*" is rejected when credentials
+// are allowed, as any website could then read credentialed responses.
+func ValidateOrigin(pattern string, allowCredentials bool) error {
+	if pattern == "*" {
+		if allowCredentials {
+			return ErrCredentialsAnyOrigin
+		}
+		return nil
+	}
+	_, err := parseOrigin(pattern)
+	return err
+}
+
+// Middleware answers preflight requests and adds CORS headers to actual
+// requests. Preflights are answered without reaching next unless
+// OptionsPassthrough is set. Vary: Origin is always added so shared caches
+// keep responses for different origins apart.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	if !c.enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.Header.Get(HeaderRequestMethod) != "" {
+			allowed := c.preflight(w, r)
+			if c.passthrough {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		c.actual(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowsOrigin reports whether a request Origin is allowed
+func (c *CORS) AllowsOrigin(value string) bool {
+	if !c.enabled || value == "" {
+		return false
+	}
+	if c.anyOrigin {
+		return true
+	}
+
+	value = strings.ToLower(value)
+	if value == "null" {
+		return slices.ContainsFunc(c.origins, func(o origin) bool { return o.literal == "null" })
+	}
+	requested, err := url.Parse(value)
+	if err != nil || requested.Host == "" {
+		return false
+	}
+	for _, o := range c.origins {
+		if o.matches(requested) {
+			return true
+		}
+	}
+	return false
+}
+
+// Internal methods
+
+// preflight writes the preflight response headers and reports whether the
+// preflight is allowed
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+	addVary(h, c.preflightVaries)
+
+	requestOrigin := r.Header.Get(HeaderOrigin)
+	if !c.AllowsOrigin(requestOrigin) {
+		return false
+	}
+
+	method := strings.ToUpper(r.Header.Get(HeaderRequestMethod))
+	if !slices.Contains(c.methods, method) && !slices.Contains(safelistedMethods, method) {
+		return false
+	}
+
+	requested := requestedHeaders(r)
+	if !c.anyHeader {
+		for _, header := range requested {
+			if !slices.Contains(c.headers, header) && !slices.Contains(safelistedHeaders, header) {
+				return false
+			}
+		}
+	}
+
+	c.writeOrigin(h, requestOrigin)
+	h.Set(HeaderAllowMethods, c.allowMethods)
+	switch {
+	case c.anyHeader && len(requested) > 0:
+		// "*" is not honored for credentialed requests, so echo the request
+		h.Set(HeaderAllowHeaders, strings.Join(requested, ", "))
+	case !c.anyHeader && c.allowHeaders != "":
+		h.Set(HeaderAllowHeaders, c.allowHeaders)
+	}
+	if c.maxAge != "" {
+		h.Set(HeaderMaxAge, c.maxAge)
+	}
+	return true
+}
+
+// actual writes the response headers of a non-preflight request
+func (c *CORS) actual(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	addVary(h, HeaderOrigin)
+
+	requestOrigin := r.Header.Get(HeaderOrigin)
+	if !c.AllowsOrigin(requestOrigin) {
+		return
+	}
+
+	c.writeOrigin(h, requestOrigin)
+	if c.exposeHeaders != "" {
+		h.Set(HeaderExposeHeaders, c.exposeHeaders)
+	}
+}
+
+func (c *CORS) writeOrigin(h http.Header, requestOrigin string) {
+	if c.anyOrigin {
+		h.Set(HeaderAllowOrigin, "*")
+	} else {
+		h.Set(HeaderAllowOrigin, requestOrigin)
+	}
+	if c.credentials {
+		h.Set(HeaderAllowCredentials, "true")
+	}
+}
+
+func (o origin) matches(requested *url.URL) bool {
+	if o.literal != "" || requested.Scheme != o.scheme || requested.Port() != o.port {
+		return false
+	}
+
+	host := requested.Hostname()
+	if !o.wildcard {
+		return host == o.host
+	}
+
+	sub, ok := strings.CutSuffix(host, "."+o.host)
+	return ok && sub != "" && strings.Trim(sub, "abcdefghijklmnopqrstuvwxyz0123456789-.") == ""
+}
+
+func parseOrigin(pattern string) (origin, error) {
+	value := strings.ToLower(strings.TrimSuffix(pattern, "/"))
+	if value == "null" {
+		return origin{literal: value}, nil
+	}
+
+	wildcard := strings.Contains(value, "://*.")
+	parsed, err := url.Parse(strings.Replace(value, "://*.", "://", 1))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Path != "" ||
+		parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil ||
+		strings.Contains(parsed.Host, "*") {
+		return origin{}, fmt.Errorf("%w: %q", ErrInvalidOrigin, pattern)
+	}
+
+	return origin{
+		scheme:   parsed.Scheme,
+		host:     parsed.Hostname(),
+		port:     parsed.Port(),
+		wildcard: wildcard,
+	}, nil
+}
+
+// requestedHeaders returns the lowercased Access-Control-Request-Headers list
+func requestedHeaders(r *http.Request) []string {
+	var headers []string
+	for _, value := range r.Header.Values(HeaderRequestHeaders) {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers
+}
+
+// addVary appends names to the Vary header unless already listed
+func addVary(h http.Header, names string) {
+	for _, name := range strings.Split(names, ", ") {
+		present := false
+		for _, value := range h.Values("Vary") {
+			for _, listed := range strings.Split(value, ",") {
+				if strings.EqualFold(strings.TrimSpace(listed), name) {
+					present = true
+				}
+			}
+		}
+		if !present {
+			h.Add("Vary", name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cors_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/cache"
+	"github.com/vzahanych/gochoreo/pkg/cors"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// ExampleCORS demonstrates preflight and actual requests from allowed and
+// rejected origins
+func ExampleCORS() {
+	c, err := cors.New(&apidef.APIDefinition{
+		APIID:      "orders",
+		EnableCORS: true,
+		CORSConfig: &apidef.CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+			AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			ExposedHeaders:   []string{"X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           600,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create cors handler: %v", err)
+	}
+
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "42")
+	}))
+
+	preflight := func(origin, method, headers string) {
+		req := httptest.NewRequest(http.MethodOptions, "/orders/1", nil)
+		req.Header.Set(cors.HeaderOrigin, origin)
+		req.Header.Set(cors.HeaderRequestMethod, method)
+		req.Header.Set(cors.HeaderRequestHeaders, headers)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Println(strings.TrimSpace(fmt.Sprintln("preflight", origin, method, rec.Code,
+			rec.Header().Get(cors.HeaderAllowOrigin), rec.Header().Get(cors.HeaderAllowMethods))))
+	}
+
+	preflight("https://app.example.com", http.MethodPut, "authorization")
+	preflight("https://eu.shop.example.org", http.MethodPut, "content-type")
+	preflight("https://example.org", http.MethodPut, "content-type")
+	preflight("https://app.example.com", http.MethodDelete, "")
+	preflight("https://app.example.com", http.MethodGet, "x-debug")
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set(cors.HeaderOrigin, "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	fmt.Println("actual", rec.Code, rec.Header().Get(cors.HeaderAllowOrigin),
+		rec.Header().Get(cors.HeaderAllowCredentials), rec.Header().Get(cors.HeaderExposeHeaders),
+		rec.Header().Get("Vary"))
+
+	// Output:
+	// preflight https://app.example.com PUT 204 https://app.example.com GET, PUT
+	// preflight https://eu.shop.example.org PUT 204 https://eu.shop.example.org GET, PUT
+	// preflight https://example.org PUT 403
+	// preflight https://app.example.com DELETE 403
+	// preflight https://app.example.com GET 403
+	// actual 200 https://app.example.com true X-Request-ID Origin
+}
+
+// ExampleCORS_cache shows CORS in front of the response cache: a response
+// cached for one origin is served to another with that origin's headers
+func ExampleCORS_cache() {
+	def := &apidef.APIDefinition{
+		APIID:       "catalog",
+		EnableCORS:  true,
+		CORSConfig:  &apidef.CORSConfig{AllowedOrigins: []string{"https://a.example.com", "https://b.example.com"}},
+		CacheConfig: &apidef.CacheConfig{Enabled: true, TTL: time.Minute},
+	}
+
+	c, err := cors.New(def)
+	if err != nil {
+		log.Fatalf("Failed to create cors handler: %v", err)
+	}
+	responses, err := cache.New(def, cache.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	handler := c.Middleware(responses.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "items")
+	})))
+
+	for _, origin := range []string{"https://a.example.com", "https://b.example.com", "https://evil.example.net"} {
+		req := httptest.NewRequest(http.MethodGet, "/catalog/items", nil)
+		req.Header.Set(cors.HeaderOrigin, origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Println(strings.TrimSpace(fmt.Sprintln(rec.Header().Get(cache.HeaderCache),
+			rec.Header().Values("Vary"), rec.Header().Get(cors.HeaderAllowOrigin))))
+	}
+
+	// Output:
+	// MISS [Origin] https://a.example.com
+	// HIT [Origin] https://b.example.com
+	// HIT [Origin]
+}
+
+// ExampleNew_credentials shows that credentials cannot be allowed for every
+// origin, since any website could then read credentialed responses
+func ExampleNew_credentials() {
+	_, err := cors.New(&apidef.APIDefinition{
+		APIID:      "orders",
+		EnableCORS: true,
+		CORSConfig: &apidef.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+	})
+	fmt.Println(errors.Is(err, cors.ErrCredentialsAnyOrigin))
+
+	// Output:
+	// true
+}
@@ -0,0 +1,386 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/balancer"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// Defaults applied to zero-valued HealthCheck fields
+const (
+	DefaultInterval  = 10 * time.Second
+	DefaultTimeout   = 5 * time.Second
+	DefaultMethod    = http.MethodGet
+	DefaultPath      = "/"
+	DefaultThreshold = 1
+
+	// maxBodyBytes limits how much of a probe response is read for ExpectedBody matching
+	maxBodyBytes = 64 * 1024
+)
+
+// ErrNoTargets is returned when a checker is created without targets
+var ErrNoTargets = errors.New("health checker requires at least one target")
+
+// Listener is notified whenever a target transitions between healthy and unhealthy
+type Listener func(target *apidef.UpstreamTarget, healthy bool)
+
+// TargetStatus represents the health status of an upstream target
+type TargetStatus struct {
+	ID                   string        `json:"id"`
+	URL                  string        `json:"url"`
+	Healthy              bool          `json:"healthy"`
+	LastCheck            time.Time     `json:"last_check"`
+	LastStatusCode       int           `json:"last_status_code,omitempty"`
+	LastError            string        `json:"last_error,omitempty"`
+	Latency              time.Duration `json:"latency"`
+	CheckCount           int64         `json:"check_count"`
+	FailureCount         int64         `json:"failure_count"`
+	ConsecutiveSuccesses int           `json:"consecutive_successes"`
+	ConsecutiveFailures  int           `json:"consecutive_failures"`
+}
+
+// targetHealth holds the probe state of one target
+type targetHealth struct {
+	target   *apidef.UpstreamTarget
+	probeURL string
+	mu       sync.RWMutex
+	status   TargetStatus
+}
+
+// Checker actively probes upstream targets according to an apidef.HealthCheck
+// and applies threshold hysteresis before flipping a target's state
+type Checker struct {
+	config    apidef.HealthCheck
+	targets   []*targetHealth
+	client    *http.Client
+	listeners []Listener
+	logger    *logger.Logger
+
+	// Lifecycle
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// Option allows customization of the checker
+type Option func(*Checker)
+
+// WithTransport sets the transport used for probes, e.g. the proxy's upstream transport
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Checker) {
+		c.client.Transport = transport
+	}
+}
+
+// WithListener registers a listener for health transitions
+func WithListener(listener Listener) Option {
+	return func(c *Checker) {
+		c.listeners = append(c.listeners, listener)
+	}
+}
+
+// WithBalancer evicts unhealthy targets from the balancer and readmits them on recovery
+func WithBalancer(b *balancer.Balancer) Option {
+	return WithListener(func(target *apidef.UpstreamTarget, healthy bool) {
+		b.SetHealthy(balancer.TargetKey(target), healthy)
+	})
+}
+
+// WithLogger sets the logger used for health transitions
+func WithLogger(log *logger.Logger) Option {
+	return func(c *Checker) {
+		c.logger = log
+	}
+}
+
+// New creates a new health checker. Targets start out healthy so traffic
+// flows until the first probes complete.
+func New(config *apidef.HealthCheck, targets []*apidef.UpstreamTarget, options ...Option) (*Checker, error) {
+	if config == nil {
+		return nil, fmt.Errorf("health check config cannot be nil")
+	}
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	c := &Checker{
+		config: withDefaults(*config),
+		client: &http.Client{
+			// Probes judge the response they get, never a redirect target
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	for _, target := range targets {
+		probeURL, err := buildProbeURL(target.URL, c.config.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %s: %w", balancer.TargetKey(target), err)
+		}
+		c.targets = append(c.targets, &targetHealth{
+			target:   target,
+			probeURL: probeURL,
+			status: TargetStatus{
+				ID:      balancer.TargetKey(target),
+				URL:     target.URL,
+				Healthy: true,
+			},
+		})
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.logger == nil {
+		c.logger = logger.GetGlobalLogger()
+	}
+	c.logger = c.logger.WithComponent("healthcheck")
+
+	c.client.Timeout = c.config.Timeout
+	return c, nil
+}
+
+// Start begins probing targets on the configured interval
+func (c *Checker) Start(ctx context.Context) error {
+	c.startOnce.Do(func() {
+		c.ctx, c.cancel = context.WithCancel(ctx)
+
+		c.wg.Add(1)
+		go c.run()
+	})
+	return nil
+}
+
+// Stop stops probing and waits for in-flight probes to finish
+func (c *Checker) Stop() error {
+	c.stopOnce.Do(func() {
+		if c.cancel != nil {
+			c.cancel()
+		}
+		c.wg.Wait()
+	})
+	return nil
+}
+
+// CheckNow probes every target once and waits for the results
+func (c *Checker) CheckNow(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, th := range c.targets {
+		wg.Add(1)
+		go func(th *targetHealth) {
+			defer wg.Done()
+			c.probe(ctx, th)
+		}(th)
+	}
+	wg.Wait()
+}
+
+// Status returns the current status of every target
+func (c *Checker) Status() []TargetStatus {
+	statuses := make([]TargetStatus, len(c.targets))
+	for i, th := range c.targets {
+		th.mu.RLock()
+		statuses[i] = th.status
+		th.mu.RUnlock()
+	}
+	return statuses
+}
+
+// IsHealthy reports whether the target with the given key is healthy
+func (c *Checker) IsHealthy(key string) bool {
+	for _, th := range c.targets {
+		if th.status.ID == key {
+			th.mu.RLock()
+			defer th.mu.RUnlock()
+			return th.status.Healthy
+		}
+	}
+	return false
+}
+
+// Internal methods
+
+func (c *Checker) run() {
+	defer c.wg.Done()
+
+	// Probe right away so bad targets are evicted before the first interval
+	c.CheckNow(c.ctx)
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckNow(c.ctx)
+		}
+	}
+}
+
+// probe runs a single check against a target and records the outcome
+func (c *Checker) probe(ctx context.Context, th *targetHealth) {
+	start := time.Now()
+	statusCode, err := c.execute(ctx, th.probeURL)
+	latency := time.Since(start)
+
+	// Shutdown is not a verdict on the target
+	if ctx.Err() != nil {
+		return
+	}
+
+	th.mu.Lock()
+	status := &th.status
+	status.LastCheck = start
+	status.Latency = latency
+	status.LastStatusCode = statusCode
+	status.CheckCount++
+
+	transitioned := false
+	if err != nil {
+		status.LastError = err.Error()
+		status.FailureCount++
+		status.ConsecutiveFailures++
+		status.ConsecutiveSuccesses = 0
+		if status.Healthy && status.ConsecutiveFailures >= c.config.UnhealthyThreshold {
+			status.Healthy = false
+			transitioned = true
+		}
+	} else {
+		status.LastError = ""
+		status.ConsecutiveSuccesses++
+		status.ConsecutiveFailures = 0
+		if !status.Healthy && status.ConsecutiveSuccesses >= c.config.HealthyThreshold {
+			status.Healthy = true
+			transitioned = true
+		}
+	}
+	healthy := status.Healthy
+	th.mu.Unlock()
+
+	if !transitioned {
+		return
+	}
+
+	if healthy {
+		c.logger.Info("Upstream target is healthy again",
+			zap.String("target", th.status.ID),
+			zap.String("url", th.target.URL),
+		)
+	} else {
+		c.logger.Warn("Upstream target marked unhealthy",
+			zap.String("target", th.status.ID),
+			zap.String("url", th.target.URL),
+			zap.Error(err),
+		)
+	}
+
+	for _, listener := range c.listeners {
+		listener(th.target, healthy)
+	}
+}
+
+// execute sends the probe request and validates status and body
+func (c *Checker) execute(ctx context.Context, probeURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, c.config.Method, probeURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "gochoreo-healthcheck")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if !c.statusExpected(resp.StatusCode) {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodyBytes))
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if c.config.ExpectedBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+		if err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to read body: %w", err)
+		}
+		if !strings.Contains(string(body), c.config.ExpectedBody) {
+			return resp.StatusCode, fmt.Errorf("response body does not contain %q", c.config.ExpectedBody)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (c *Checker) statusExpected(statusCode int) bool {
+	if len(c.config.ExpectedStatus) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, expected := range c.config.ExpectedStatus {
+		if statusCode == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// withDefaults fills zero-valued fields with sensible defaults
+func withDefaults(config apidef.HealthCheck) apidef.HealthCheck {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Method == "" {
+		config.Method = DefaultMethod
+	}
+	if config.Path == "" {
+		config.Path = DefaultPath
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = DefaultThreshold
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = DefaultThreshold
+	}
+	return config
+}
+
+// buildProbeURL appends the health check path to the target URL
+func buildProbeURL(targetURL, path string) (string, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("target URL must be absolute")
+	}
+
+	probe, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid health check path: %w", err)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(probe.Path, "/")
+	u.RawPath = ""
+	u.RawQuery = probe.RawQuery
+	return u.String(), nil
+}
@@ -0,0 +1,86 @@
+package healthcheck_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/balancer"
+	"github.com/vzahanych/gochoreo/pkg/healthcheck"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// ExampleChecker demonstrates threshold hysteresis feeding a balancer
+func ExampleChecker() {
+	var down atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer flaky.Close()
+
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer stable.Close()
+
+	lb, err := balancer.New([]apidef.UpstreamTarget{
+		{ID: "flaky", URL: flaky.URL},
+		{ID: "stable", URL: stable.URL},
+	}, apidef.LoadBalanceRoundRobin)
+	if err != nil {
+		log.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	checker, err := healthcheck.New(&apidef.HealthCheck{
+		Enabled:            true,
+		Path:               "/healthz",
+		Timeout:            time.Second,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+		ExpectedBody:       `"ok"`,
+	}, lb.Targets(),
+		healthcheck.WithBalancer(lb),
+		healthcheck.WithLogger(&logger.Logger{Logger: zap.NewNop()}),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create checker: %v", err)
+	}
+
+	ctx := context.Background()
+	down.Store(true)
+
+	checker.CheckNow(ctx)
+	fmt.Println("after 1 failure:", lb.IsHealthy("flaky"))
+	checker.CheckNow(ctx)
+	fmt.Println("after 2 failures:", lb.IsHealthy("flaky"))
+
+	down.Store(false)
+	checker.CheckNow(ctx)
+	fmt.Println("after 1 success:", lb.IsHealthy("flaky"))
+	checker.CheckNow(ctx)
+	fmt.Println("after 2 successes:", lb.IsHealthy("flaky"))
+
+	for _, status := range checker.Status() {
+		fmt.Printf("%s healthy=%t checks=%d failures=%d\n",
+			status.ID, status.Healthy, status.CheckCount, status.FailureCount)
+	}
+
+	// Output:
+	// after 1 failure: true
+	// after 2 failures: false
+	// after 1 success: false
+	// after 2 successes: true
+	// flaky healthy=true checks=4 failures=2
+	// stable healthy=true checks=4 failures=0
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned by ReadBody for bodies over the limit
+var ErrBodyTooLarge = errors.New("body exceeds the size limit")
+
+// ReadBody reads a body of at most limit bytes
+func ReadBody(body io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+// ResponseBuffer holds a response until it is complete, so that middleware
+// can rewrite it before it is written out. A response that grows over the
+// limit or is flushed is streamed through from then on, untouched.
+type ResponseBuffer struct {
+	http.ResponseWriter
+	limit       int64
+	overflow    func()
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+	streaming   bool
+}
+
+// NewResponseBuffer creates a buffer of at most limit bytes over w.
+// overflow, when not nil, is called if the response exceeds the limit.
+func NewResponseBuffer(w http.ResponseWriter, limit int64, overflow func()) *ResponseBuffer {
+	return &ResponseBuffer{ResponseWriter: w, limit: limit, overflow: overflow, status: http.StatusOK}
+}
+
+// WriteHeader implements http.ResponseWriter. Informational responses are
+// passed through.
+func (b *ResponseBuffer) WriteHeader(status int) {
+	if b.streaming {
+		b.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if b.wroteHeader {
+		return
+	}
+	if status >= 100 && status < 200 {
+		b.ResponseWriter.WriteHeader(status)
+		return
+	}
+	b.wroteHeader = true
+	b.status = status
+}
+
+// Write implements http.ResponseWriter
+func (b *ResponseBuffer) Write(p []byte) (int, error) {
+	if !b.wroteHeader {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.streaming {
+		return b.ResponseWriter.Write(p)
+	}
+	if int64(b.body.Len()+len(p)) > b.limit {
+		if b.overflow != nil {
+			b.overflow()
+		}
+		if err := b.stream(); err != nil {
+			return 0, err
+		}
+		return b.ResponseWriter.Write(p)
+	}
+	return b.body.Write(p)
+}
+
+// Flush implements http.Flusher, streaming the rest of the response
+func (b *ResponseBuffer) Flush() {
+	if !b.streaming {
+		if !b.wroteHeader {
+			b.WriteHeader(http.StatusOK)
+		}
+		if err := b.stream(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (b *ResponseBuffer) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
+
+// Buffered returns the held response, or false when it was streamed and
+// has already been written out
+func (b *ResponseBuffer) Buffered() (status int, body []byte, ok bool) {
+	if b.streaming {
+		return 0, nil, false
+	}
+	return b.status, b.body.Bytes(), true
+}
+
+// stream writes out what was buffered and passes the rest through
+func (b *ResponseBuffer) stream() error {
+	b.streaming = true
+	b.ResponseWriter.WriteHeader(b.status)
+	_, err := b.ResponseWriter.Write(b.body.Bytes())
+	b.body = bytes.Buffer{}
+	return err
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Chain is the ordered middleware of an API definition
+type Chain struct {
+	phases map[Phase][]Middleware
+}
+
+// Phase returns the middlewares of a phase, outermost first
+func (c *Chain) Phase(phase Phase) []Middleware {
+	return c.phases[phase]
+}
+
+// Len returns the number of middlewares across all phases
+func (c *Chain) Len() int {
+	n := 0
+	for _, middlewares := range c.phases {
+		n += len(middlewares)
+	}
+	return n
+}
+
+// Then wraps handler so requests pass through the phases in order, Pre
+// outermost and Response closest to handler. When handler or handlers the
+// middlewares built have a Close method, as router.Closer, the returned
+// handler has one closing each of them, outermost first.
+func (c *Chain) Then(handler http.Handler) http.Handler {
+	var closers []closer
+	collect := func(h http.Handler) {
+		if cl, ok := h.(closer); ok && !slices.ContainsFunc(closers, func(other closer) bool { return same(cl, other) }) {
+			closers = append(closers, cl)
+		}
+	}
+
+	collect(handler)
+	for i := len(Phases) - 1; i >= 0; i-- {
+		middlewares := c.phases[Phases[i]]
+		for j := len(middlewares) - 1; j >= 0; j-- {
+			handler = middlewares[j](handler)
+			collect(handler)
+		}
+	}
+	if len(closers) == 0 {
+		return handler
+	}
+	return &closingHandler{Handler: handler, closers: closers}
+}
+
+// closer is implemented by handlers holding resources
+type closer interface {
+	Close()
+}
+
+// closingHandler is a chain holding the handlers to close with it
+type closingHandler struct {
+	http.Handler
+	closers []closer
+	once    sync.Once
+}
+
+// Close closes the handlers of the chain
+func (h *closingHandler) Close() {
+	h.once.Do(func() {
+		for i := len(h.closers) - 1; i >= 0; i-- {
+			h.closers[i].Close()
+		}
+	})
+}
+
+// same reports whether two closers are the same handler, as when a
+// middleware returns the handler it wraps
+func same(a, b closer) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Validator is implemented by config structs that check their own values
+type Validator interface {
+	Validate() error
+}
+
+// Defaulter is implemented by config structs that set default values
+// before a spec's Config is decoded over them
+type Defaulter interface {
+	SetDefaults()
+}
+
+// ConfigError lists every problem found in a spec's Config
+type ConfigError struct {
+	Errors []string
+}
+
+// Error implements error
+func (e *ConfigError) Error() string {
+	return "invalid middleware config: " + strings.Join(e.Errors, "; ")
+}
+
+// Decode decodes a spec's Config into config, a pointer to a struct using
+// mapstructure tags. Unknown keys are rejected, strings are converted to
+// durations and weakly typed values are accepted. When config implements
+// Validator it is validated after decoding.
+func Decode(input map[string]interface{}, config interface{}) error {
+	if defaulter, ok := config.(Defaulter); ok {
+		defaulter.SetDefaults()
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           config,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid middleware config type: %w", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		var decodeErr *mapstructure.Error
+		if errors.As(err, &decodeErr) {
+			return &ConfigError{Errors: decodeErr.Errors}
+		}
+		return &ConfigError{Errors: []string{err.Error()}}
+	}
+
+	if validator, ok := config.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return &ConfigError{Errors: []string{err.Error()}}
+		}
+	}
+	return nil
+}
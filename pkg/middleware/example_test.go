@@ -0,0 +1,158 @@
+package middleware_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+)
+
+// TraceConfig is the typed config of the example "trace" middleware
+type TraceConfig struct {
+	Header  string        `mapstructure:"header"`
+	Label   string        `mapstructure:"label"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// SetDefaults implements middleware.Defaulter
+func (c *TraceConfig) SetDefaults() {
+	c.Header = "X-Trace"
+}
+
+// Validate implements middleware.Validator
+func (c *TraceConfig) Validate() error {
+	if c.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+	return nil
+}
+
+func newRegistry() *middleware.Registry {
+	registry := middleware.NewRegistry()
+
+	// trace appends its label to a header, revealing the chain order
+	err := middleware.Register(registry, "trace", func(def *apidef.APIDefinition, config *TraceConfig) (middleware.Middleware, error) {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Add(config.Header, config.Label)
+				next.ServeHTTP(w, r)
+			})
+		}, nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to register middleware: %v", err)
+	}
+	return registry
+}
+
+func trace(label string, priority int) apidef.MiddlewareSpec {
+	return apidef.MiddlewareSpec{
+		Name:     "trace",
+		Enabled:  true,
+		Priority: priority,
+		Config:   map[string]interface{}{"label": label},
+	}
+}
+
+// ExampleRegistry_Build demonstrates phase and priority ordering
+func ExampleRegistry_Build() {
+	disabled := trace("disabled", 100)
+	disabled.Enabled = false
+
+	chain, err := newRegistry().Build(&apidef.APIDefinition{
+		APIID: "orders",
+		Middleware: apidef.MiddlewareConfig{
+			Response: []apidef.MiddlewareSpec{trace("response", 0)},
+			PostAuth: []apidef.MiddlewareSpec{trace("post-auth-low", 1), trace("post-auth-high", 5)},
+			Pre:      []apidef.MiddlewareSpec{trace("pre-a", 0), disabled, trace("pre-b", 0)},
+			Auth:     []apidef.MiddlewareSpec{trace("auth", 0)},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to build middleware chain: %v", err)
+	}
+
+	handler := chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println(strings.Join(r.Header.Values("X-Trace"), " > "))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	fmt.Println(chain.Len(), "middlewares")
+
+	// Output:
+	// pre-a > pre-b > auth > post-auth-high > post-auth-low > response
+	// 6 middlewares
+}
+
+// pool is a handler holding a resource released by Close
+type pool struct {
+	http.Handler
+	name string
+}
+
+func (p *pool) Close() {
+	fmt.Println("closed", p.name)
+}
+
+// ExampleChain_Then shows the handler of a chain closing the handlers it
+// wraps, as the router does once their definition is replaced or removed
+func ExampleChain_Then() {
+	registry := middleware.NewRegistry()
+	registry.Register("pool", func(def *apidef.APIDefinition, spec *apidef.MiddlewareSpec) (middleware.Middleware, error) {
+		return func(next http.Handler) http.Handler {
+			return &pool{Handler: next, name: spec.Config["name"].(string)}
+		}, nil
+	})
+	// passthrough returns the handler it wraps, which is closed only once
+	registry.Register("passthrough", func(def *apidef.APIDefinition, spec *apidef.MiddlewareSpec) (middleware.Middleware, error) {
+		return func(next http.Handler) http.Handler { return next }, nil
+	})
+
+	chain, err := registry.Build(&apidef.APIDefinition{
+		APIID: "orders",
+		Middleware: apidef.MiddlewareConfig{
+			Pre: []apidef.MiddlewareSpec{
+				{Name: "pool", Enabled: true, Config: map[string]interface{}{"name": "outer"}},
+				{Name: "passthrough", Enabled: true},
+			},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to build middleware chain: %v", err)
+	}
+
+	handler := chain.Then(&pool{Handler: http.NotFoundHandler(), name: "upstream"})
+	handler.(interface{ Close() }).Close()
+
+	// Output:
+	// closed outer
+	// closed upstream
+}
+
+// ExampleDecode shows the validation errors reported for invalid specs
+func ExampleDecode() {
+	_, err := newRegistry().Build(&apidef.APIDefinition{
+		APIID: "orders",
+		Middleware: apidef.MiddlewareConfig{
+			Pre: []apidef.MiddlewareSpec{
+				{Name: "trace", Enabled: true, Config: map[string]interface{}{"label": "a", "timeout": "soon", "colour": "red"}},
+				{Name: "trace", Enabled: true},
+			},
+			Post: []apidef.MiddlewareSpec{
+				{Name: "gzip", Enabled: true},
+				{Name: "auditor", Type: middleware.TypePlugin, Enabled: true},
+			},
+		},
+	})
+	fmt.Println(err)
+
+	// Output:
+	// middleware "trace" at pre[0]: invalid middleware config: error decoding 'timeout': time: invalid duration "soon"; '' has invalid keys: colour
+	// middleware "trace" at pre[1]: invalid middleware config: label is required
+	// middleware "gzip" at post[0]: middleware not registered: gzip
+	// middleware "auditor" at post[1]: unsupported middleware type: plugin
+}
@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Middleware wraps a handler
+type Middleware func(http.Handler) http.Handler
+
+// Factory builds the middleware described by a spec for an API definition
+type Factory func(def *apidef.APIDefinition, spec *apidef.MiddlewareSpec) (Middleware, error)
+
+// Phase is a stage of the middleware chain
+type Phase string
+
+// Chain phases, outermost first
+const (
+	PhasePre      Phase = "pre"
+	PhaseAuth     Phase = "auth"
+	PhasePostAuth Phase = "post_auth"
+	PhasePost     Phase = "post"
+	PhaseResponse Phase = "response"
+)
+
+// Phases lists the phases in the order requests pass through them
+var Phases = []Phase{PhasePre, PhaseAuth, PhasePostAuth, PhasePost, PhaseResponse}
+
+// Values accepted in apidef.MiddlewareSpec.Type
+const (
+	TypeBuiltin = "built-in"
+	TypePlugin  = "plugin"
+	TypeScript  = "script"
+)
+
+// Common registry errors
+var (
+	ErrAlreadyRegistered = errors.New("middleware already registered")
+	ErrNotRegistered     = errors.New("middleware not registered")
+	ErrUnsupportedType   = errors.New("unsupported middleware type")
+)
+
+// Registry resolves middleware specs to middlewares. Built-in middlewares
+// are registered by name; plugin and script specs are resolved by the
+// factory registered for their type.
+type Registry struct {
+	mu       sync.RWMutex
+	builtins map[string]Factory
+	types    map[string]Factory
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		builtins: make(map[string]Factory),
+		types:    make(map[string]Factory),
+	}
+}
+
+// Register adds a built-in middleware
+func (r *Registry) Register(name string, factory Factory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("middleware name and factory are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.builtins[name]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyRegistered, name)
+	}
+	r.builtins[name] = factory
+	return nil
+}
+
+// Register adds a built-in middleware whose spec Config is decoded into a
+// *C and validated before build is called
+func Register[C any](r *Registry, name string, build func(def *apidef.APIDefinition, config *C) (Middleware, error)) error {
+	return r.Register(name, func(def *apidef.APIDefinition, spec *apidef.MiddlewareSpec) (Middleware, error) {
+		config := new(C)
+		if err := Decode(spec.Config, config); err != nil {
+			return nil, err
+		}
+		return build(def, config)
+	})
+}
+
+// RegisterType sets the factory of every spec of a non built-in type, such
+// as plugin or script
+func (r *Registry) RegisterType(specType string, factory Factory) error {
+	if specType == "" || specType == TypeBuiltin || factory == nil {
+		return fmt.Errorf("a non built-in middleware type and factory are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.types[specType]; ok {
+		return fmt.Errorf("%w: type %s", ErrAlreadyRegistered, specType)
+	}
+	r.types[specType] = factory
+	return nil
+}
+
+// Names returns the registered built-in middlewares, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.builtins))
+	for name := range r.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build resolves every enabled middleware spec of an API definition. Each
+// phase is ordered by Priority, highest first, with ties kept in
+// declaration order. All spec errors are reported together.
+func (r *Registry) Build(def *apidef.APIDefinition) (*Chain, error) {
+	if def == nil {
+		return nil, fmt.Errorf("api definition cannot be nil")
+	}
+
+	chain := &Chain{phases: make(map[Phase][]Middleware)}
+
+	var errs []error
+	for _, phase := range Phases {
+		specs := phaseSpecs(&def.Middleware, phase)
+
+		order := make([]int, 0, len(specs))
+		for i := range specs {
+			if specs[i].Enabled {
+				order = append(order, i)
+			}
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return specs[order[a]].Priority > specs[order[b]].Priority
+		})
+
+		for _, i := range order {
+			spec := &specs[i]
+			m, err := r.build(def, spec)
+			if err != nil {
+				errs = append(errs, &SpecError{Phase: phase, Index: i, Name: spec.Name, Err: err})
+				continue
+			}
+			chain.phases[phase] = append(chain.phases[phase], m)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return chain, nil
+}
+
+// Internal methods
+
+func (r *Registry) build(def *apidef.APIDefinition, spec *apidef.MiddlewareSpec) (Middleware, error) {
+	factory, err := r.factory(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := factory(def, spec)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("factory returned no middleware")
+	}
+	return m, nil
+}
+
+func (r *Registry) factory(spec *apidef.MiddlewareSpec) (Factory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch specType := strings.ToLower(spec.Type); specType {
+	case "", TypeBuiltin, "builtin":
+		if factory, ok := r.builtins[spec.Name]; ok {
+			return factory, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotRegistered, spec.Name)
+	default:
+		if factory, ok := r.types[specType]; ok {
+			return factory, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, spec.Type)
+	}
+}
+
+func phaseSpecs(config *apidef.MiddlewareConfig, phase Phase) []apidef.MiddlewareSpec {
+	switch phase {
+	case PhasePre:
+		return config.Pre
+	case PhaseAuth:
+		return config.Auth
+	case PhasePostAuth:
+		return config.PostAuth
+	case PhasePost:
+		return config.Post
+	case PhaseResponse:
+		return config.Response
+	}
+	return nil
+}
+
+// SpecError locates a spec that could not be built
+type SpecError struct {
+	Phase Phase
+	Index int
+	Name  string
+	Err   error
+}
+
+// Error implements error
+func (e *SpecError) Error() string {
+	return fmt.Sprintf("middleware %q at %s[%d]: %v", e.Name, e.Phase, e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *SpecError) Unwrap() error {
+	return e.Err
+}
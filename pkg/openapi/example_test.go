@@ -0,0 +1,206 @@
+package openapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/openapi"
+)
+
+func describe(def *apidef.APIDefinition) {
+	fmt.Println(def.APIID, def.ListenPath, def.Version, def.Status)
+	for _, target := range def.Proxy.Targets {
+		fmt.Println(" target", target.ID, target.URL, target.Weight)
+	}
+	printAuth(" ", def.AuthConfig)
+}
+
+func printAuth(indent string, config apidef.AuthConfig) {
+	switch config.Type {
+	case apidef.AuthMulti:
+		fmt.Println(indent, "multi", config.MultiMode)
+		for _, nested := range config.MultiConfig {
+			printAuth(indent+" ", nested)
+		}
+	case apidef.AuthAPIKey:
+		fmt.Println(indent, "api_key", config.APIKeyConfig.Location, config.APIKeyConfig.ParamName)
+	case apidef.AuthOAuth2:
+		fmt.Println(indent, "oauth2", config.OAuth2Config.TokenURL, config.OAuth2Config.Scopes, config.OAuth2Config.RequiredScopes)
+	case apidef.AuthJWT:
+		fmt.Println(indent, "jwt", config.JWTConfig.SigningMethod, config.JWTConfig.SigningKey)
+	default:
+		fmt.Println(indent, config.Type)
+	}
+}
+
+func importFile(name string, options ...openapi.Option) *apidef.APIDefinition {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", name, err)
+	}
+	def, err := openapi.Import(context.Background(), data, options...)
+	if err != nil {
+		log.Fatalf("Failed to import %s: %v", name, err)
+	}
+	return def
+}
+
+// ExampleImport maps servers, security schemes and info of sample
+// documents onto API definitions
+func ExampleImport() {
+	jwt := openapi.WithJWTConfig(&apidef.JWTConfig{
+		SigningMethod: "RS256",
+		SigningKey:    "https://auth.example.com/.well-known/jwks.json",
+	})
+
+	describe(importFile("petstore.yaml"))
+	describe(importFile("payments.json"))
+	describe(importFile("ledger.yaml", jwt))
+
+	// Output:
+	// swagger-petstore /swagger-petstore 1.0.7 draft
+	//  target server-1 https://petstore.example.com/v1 1
+	//  target server-2 https://petstore-eu.example.com/v1 1
+	//   api_key header X-API-Key
+	// payments /payments 2024-06-01 draft
+	//  target server-1 https://payments.internal:8443 1
+	//   multi any
+	//    oauth2 https://auth.example.com/token [payments:read payments:write] [payments:write]
+	//    multi all
+	//     api_key query sig
+	//     basic
+	// ledger-v3 /ledger 3.1.0 draft
+	//  target ledger-a http://ledger-a:8080 3
+	//  target ledger-b http://ledger-b:8080 1
+	//   jwt RS256 https://auth.example.com/.well-known/jwks.json
+}
+
+// ExampleImport_mixedSecurity shows an import refused because operations
+// require different schemes, which one definition cannot enforce
+func ExampleImport_mixedSecurity() {
+	_, err := openapi.Import(context.Background(), []byte(`
+openapi: 3.0.3
+info:
+  title: Inventory
+  version: "1.0"
+servers:
+  - url: https://inventory.example.com
+paths:
+  /items:
+    get:
+      security:
+        - api_key: []
+      responses:
+        "200":
+          description: Items
+    post:
+      security:
+        - basic: []
+      responses:
+        "201":
+          description: Item created
+components:
+  securitySchemes:
+    api_key:
+      type: apiKey
+      name: X-API-Key
+      in: header
+    basic:
+      type: http
+      scheme: basic
+`))
+	fmt.Println(errors.Is(err, openapi.ErrMixedSecurity), err)
+
+	// Output:
+	// true operations require different security: GET /items and POST /items
+}
+
+// ExampleExport produces the OpenAPI skeleton of a definition, and checks
+// every sample document survives an import, export and import round trip
+func ExampleExport() {
+	def := &apidef.APIDefinition{
+		APIID:      "orders",
+		Name:       "Orders",
+		Version:    "2.0.0",
+		ListenPath: "/orders",
+		Proxy: apidef.ProxyConfig{
+			Targets: []apidef.UpstreamTarget{{ID: "primary", URL: "http://orders:8080", Weight: 2}},
+		},
+		AuthConfig: apidef.AuthConfig{
+			Type:         apidef.AuthAPIKey,
+			APIKeyConfig: &apidef.APIKeyConfig{Location: "header", ParamName: "X-API-Key"},
+		},
+	}
+
+	doc, err := openapi.Export(def)
+	if err != nil {
+		log.Fatalf("Failed to export: %v", err)
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode: %v", err)
+	}
+	fmt.Println(string(data))
+
+	jwt := openapi.WithJWTConfig(&apidef.JWTConfig{SigningMethod: "HS256", SigningKey: "secret"})
+	for _, name := range []string{"petstore.yaml", "payments.json", "ledger.yaml"} {
+		imported := importFile(name, jwt)
+
+		doc, err := openapi.Export(imported)
+		if err != nil {
+			log.Fatalf("Failed to export %s: %v", name, err)
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			log.Fatalf("Failed to encode %s: %v", name, err)
+		}
+		reimported, err := openapi.Import(context.Background(), data, jwt)
+		if err != nil {
+			log.Fatalf("Failed to import exported %s: %v", name, err)
+		}
+		fmt.Println(name, "round trip equal:", reflect.DeepEqual(imported, reimported))
+	}
+
+	// Output:
+	// {
+	//   "components": {
+	//     "securitySchemes": {
+	//       "apiKey": {
+	//         "in": "header",
+	//         "name": "X-API-Key",
+	//         "type": "apiKey"
+	//       }
+	//     }
+	//   },
+	//   "info": {
+	//     "title": "Orders",
+	//     "version": "2.0.0"
+	//   },
+	//   "openapi": "3.0.3",
+	//   "paths": {},
+	//   "security": [
+	//     {
+	//       "apiKey": []
+	//     }
+	//   ],
+	//   "servers": [
+	//     {
+	//       "url": "http://orders:8080",
+	//       "x-gochoreo-target-id": "primary",
+	//       "x-gochoreo-weight": 2
+	//     }
+	//   ],
+	//   "x-gochoreo-api-id": "orders",
+	//   "x-gochoreo-listen-path": "/orders"
+	// }
+	// petstore.yaml round trip equal: true
+	// payments.json round trip equal: true
+	// ledger.yaml round trip equal: true
+}
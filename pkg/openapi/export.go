@@ -0,0 +1,198 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Version is the OpenAPI version of exported documents
+const Version = "3.0.3"
+
+// exporter names the security schemes of an export
+type exporter struct {
+	schemes openapi3.SecuritySchemes
+}
+
+// Export produces an OpenAPI skeleton of a definition: its info, its proxy
+// targets as servers and its auth config as security schemes and
+// requirements. Paths are left empty for the service to describe. Secrets
+// such as JWT signing keys and OAuth2 client credentials are not exported.
+func Export(def *apidef.APIDefinition) (*openapi3.T, error) {
+	version := def.Version
+	if version == "" {
+		// Required by OpenAPI
+		version = "0.0.0"
+	}
+
+	doc := &openapi3.T{
+		OpenAPI: Version,
+		Info: &openapi3.Info{
+			Title:       def.Name,
+			Description: def.Description,
+			Version:     version,
+		},
+		Paths: openapi3.NewPaths(),
+		Extensions: map[string]any{
+			ExtensionAPIID:      def.APIID,
+			ExtensionListenPath: def.ListenPath,
+		},
+	}
+
+	doc.Servers = exportServers(def)
+
+	if !def.UseKeylessAccess && def.AuthConfig.Type != "" && def.AuthConfig.Type != apidef.AuthNone {
+		e := &exporter{schemes: openapi3.SecuritySchemes{}}
+		requirements, err := e.exportAuth(&def.AuthConfig)
+		if err != nil {
+			return nil, err
+		}
+		doc.Security = requirements
+		doc.Components = &openapi3.Components{SecuritySchemes: e.schemes}
+	}
+
+	return doc, nil
+}
+
+// Internal methods
+
+func exportServers(def *apidef.APIDefinition) openapi3.Servers {
+	targets := def.Proxy.Targets
+	if len(targets) == 0 && def.Proxy.TargetURL != "" {
+		targets = []apidef.UpstreamTarget{{URL: def.Proxy.TargetURL, Weight: 1}}
+	}
+
+	servers := make(openapi3.Servers, 0, len(targets))
+	for _, target := range targets {
+		server := &openapi3.Server{URL: target.URL, Extensions: map[string]any{}}
+		if target.ID != "" {
+			server.Extensions[ExtensionTargetID] = target.ID
+		}
+		if target.Weight != 1 {
+			server.Extensions[ExtensionWeight] = target.Weight
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// exportAuth returns the requirement alternatives satisfying config
+func (e *exporter) exportAuth(config *apidef.AuthConfig) (openapi3.SecurityRequirements, error) {
+	if config.Type != apidef.AuthMulti {
+		requirement, err := e.exportRequired([]apidef.AuthConfig{*config})
+		if err != nil {
+			return nil, err
+		}
+		return openapi3.SecurityRequirements{requirement}, nil
+	}
+
+	if config.MultiMode == apidef.MultiAuthAll {
+		requirement, err := e.exportRequired(config.MultiConfig)
+		if err != nil {
+			return nil, err
+		}
+		return openapi3.SecurityRequirements{requirement}, nil
+	}
+
+	var requirements openapi3.SecurityRequirements
+	for i := range config.MultiConfig {
+		alternative := &config.MultiConfig[i]
+		required := []apidef.AuthConfig{*alternative}
+		if alternative.Type == apidef.AuthMulti {
+			if alternative.MultiMode != apidef.MultiAuthAll {
+				return nil, fmt.Errorf("%w: nested multi auth must use mode all", ErrUnsupportedAuth)
+			}
+			required = alternative.MultiConfig
+		}
+		requirement, err := e.exportRequired(required)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements, nil
+}
+
+// exportRequired returns the requirement of schemes all required together
+func (e *exporter) exportRequired(configs []apidef.AuthConfig) (openapi3.SecurityRequirement, error) {
+	requirement := openapi3.SecurityRequirement{}
+	for i := range configs {
+		name, scopes, err := e.exportScheme(&configs[i])
+		if err != nil {
+			return nil, err
+		}
+		requirement[name] = scopes
+	}
+	return requirement, nil
+}
+
+func (e *exporter) exportScheme(config *apidef.AuthConfig) (string, []string, error) {
+	scopes := []string{}
+
+	var name string
+	var scheme *openapi3.SecurityScheme
+	switch config.Type {
+	case apidef.AuthAPIKey:
+		if config.APIKeyConfig == nil {
+			return "", nil, fmt.Errorf("%w: api_key_config is missing", ErrUnsupportedAuth)
+		}
+		location := strings.ToLower(config.APIKeyConfig.Location)
+		if location != "header" && location != "query" {
+			return "", nil, fmt.Errorf("%w: api keys passed in %q", ErrUnsupportedAuth, config.APIKeyConfig.Location)
+		}
+		name = "apiKey"
+		scheme = openapi3.NewSecurityScheme()
+		scheme.Type = "apiKey"
+		scheme.In = location
+		scheme.Name = config.APIKeyConfig.ParamName
+
+	case apidef.AuthBasic:
+		name = "basicAuth"
+		scheme = openapi3.NewSecurityScheme()
+		scheme.Type = "http"
+		scheme.Scheme = "basic"
+
+	case apidef.AuthJWT:
+		name = "bearerAuth"
+		scheme = openapi3.NewJWTSecurityScheme()
+
+	case apidef.AuthOAuth2:
+		if config.OAuth2Config == nil || config.OAuth2Config.TokenURL == "" {
+			return "", nil, fmt.Errorf("%w: oauth2 needs a token_url", ErrUnsupportedAuth)
+		}
+		flowScopes := openapi3.StringMap{}
+		for _, scope := range config.OAuth2Config.Scopes {
+			flowScopes[scope] = ""
+		}
+		for _, scope := range config.OAuth2Config.RequiredScopes {
+			flowScopes[scope] = ""
+		}
+		name = "oauth2"
+		scheme = openapi3.NewSecurityScheme()
+		scheme.Type = "oauth2"
+		scheme.Flows = &openapi3.OAuthFlows{
+			ClientCredentials: &openapi3.OAuthFlow{TokenURL: config.OAuth2Config.TokenURL, Scopes: flowScopes},
+		}
+		scopes = append(scopes, config.OAuth2Config.RequiredScopes...)
+		sort.Strings(scopes)
+
+	default:
+		return "", nil, fmt.Errorf("%w: %s authentication", ErrUnsupportedAuth, config.Type)
+	}
+
+	return e.add(name, scheme), scopes, nil
+}
+
+// add registers a scheme under name, suffixed when the name is taken
+func (e *exporter) add(name string, scheme *openapi3.SecurityScheme) string {
+	unique := name
+	for n := 2; e.schemes[unique] != nil; n++ {
+		unique = fmt.Sprintf("%s%d", name, n)
+	}
+	e.schemes[unique] = &openapi3.SecuritySchemeRef{Value: scheme}
+	return unique
+}
@@ -0,0 +1,408 @@
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// importer holds the settings of an import
+type importer struct {
+	apiID      string
+	listenPath string
+	jwt        *apidef.JWTConfig
+	oauth2     *apidef.OAuth2Config
+}
+
+// Option allows customization of an import
+type Option func(*importer)
+
+// WithAPIID sets the API ID, which otherwise comes from the document's
+// x-gochoreo-api-id or its title
+func WithAPIID(apiID string) Option {
+	return func(i *importer) {
+		i.apiID = apiID
+	}
+}
+
+// WithListenPath sets the listen path, which otherwise comes from the
+// document's x-gochoreo-listen-path or is /<api id>
+func WithListenPath(listenPath string) Option {
+	return func(i *importer) {
+		i.listenPath = listenPath
+	}
+}
+
+// WithJWTConfig sets the JWT settings of bearer schemes, whose signing
+// method and key OpenAPI cannot express
+func WithJWTConfig(config *apidef.JWTConfig) Option {
+	return func(i *importer) {
+		i.jwt = config
+	}
+}
+
+// WithOAuth2Config sets the OAuth2 settings OpenAPI cannot express, such as
+// the introspection endpoint and client credentials. Token URL and scopes
+// come from the document.
+func WithOAuth2Config(config *apidef.OAuth2Config) Option {
+	return func(i *importer) {
+		i.oauth2 = config
+	}
+}
+
+// Import creates a draft API definition from an OpenAPI 3 document:
+//
+//   - info title, description and version become the definition's
+//   - absolute http(s) servers become the proxy targets, their variables
+//     set to their defaults
+//   - the security requirements become the auth config: alternatives are
+//     combined with multi auth mode any and schemes required together with
+//     mode all
+//
+// Definitions authenticate the whole API, so every operation must require
+// the same security, whether its own or the document's; ErrMixedSecurity is
+// returned otherwise. Operations open to anonymous callers get the
+// requirements of the others, and the API is keyless only when no
+// operation requires any. Bearer schemes map to JWT authentication and
+// need WithJWTConfig to be complete.
+func Import(ctx context.Context, data []byte, options ...Option) (*apidef.APIDefinition, error) {
+	doc, err := Load(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return ImportDocument(doc, options...)
+}
+
+// ImportDocument creates a draft API definition from a loaded document, as
+// Import does
+func ImportDocument(doc *openapi3.T, options ...Option) (*apidef.APIDefinition, error) {
+	i := &importer{}
+	for _, option := range options {
+		option(i)
+	}
+
+	if doc.Info == nil {
+		return nil, fmt.Errorf("openapi document has no info")
+	}
+	def := &apidef.APIDefinition{
+		Name:            doc.Info.Title,
+		Description:     doc.Info.Description,
+		Version:         doc.Info.Version,
+		Status:          apidef.StatusDraft,
+		StripListenPath: true,
+	}
+
+	def.APIID = firstNonEmpty(i.apiID, stringExtension(doc.Extensions, ExtensionAPIID), slug(doc.Info.Title))
+	if def.APIID == "" {
+		return nil, fmt.Errorf("openapi document needs a title or %s to derive the API ID from", ExtensionAPIID)
+	}
+	def.ListenPath = firstNonEmpty(i.listenPath, stringExtension(doc.Extensions, ExtensionListenPath), "/"+def.APIID)
+
+	targets, err := importServers(doc.Servers)
+	if err != nil {
+		return nil, err
+	}
+	def.Proxy.Targets = targets
+
+	auth, keyless, err := i.importSecurity(doc)
+	if err != nil {
+		return nil, err
+	}
+	def.AuthConfig = auth
+	def.UseKeylessAccess = keyless
+
+	return def, nil
+}
+
+// Internal methods
+
+func importServers(servers openapi3.Servers) ([]apidef.UpstreamTarget, error) {
+	var targets []apidef.UpstreamTarget
+	for index, server := range servers {
+		raw := server.URL
+		for name, variable := range server.Variables {
+			raw = strings.ReplaceAll(raw, "{"+name+"}", variable.Default)
+		}
+
+		// Relative servers are relative to where the document is served
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+
+		target := apidef.UpstreamTarget{
+			ID:     firstNonEmpty(stringExtension(server.Extensions, ExtensionTargetID), fmt.Sprintf("server-%d", index+1)),
+			URL:    strings.TrimSuffix(raw, "/"),
+			Weight: 1,
+		}
+		if weight, ok := intExtension(server.Extensions, ExtensionWeight); ok {
+			target.Weight = weight
+		}
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 {
+		return nil, ErrNoServers
+	}
+	return targets, nil
+}
+
+func (i *importer) importSecurity(doc *openapi3.T) (apidef.AuthConfig, bool, error) {
+	requirements, err := commonSecurity(doc)
+	if err != nil {
+		return apidef.AuthConfig{}, false, err
+	}
+	if len(requirements) == 0 {
+		return apidef.AuthConfig{Type: apidef.AuthNone}, true, nil
+	}
+
+	var schemes openapi3.SecuritySchemes
+	if doc.Components != nil {
+		schemes = doc.Components.SecuritySchemes
+	}
+
+	var alternatives []apidef.AuthConfig
+	for _, requirement := range requirements {
+		names := make([]string, 0, len(requirement))
+		for name := range requirement {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var required []apidef.AuthConfig
+		for _, name := range names {
+			ref, ok := schemes[name]
+			if !ok || ref.Value == nil {
+				return apidef.AuthConfig{}, false, fmt.Errorf("%w: %s", ErrUnknownScheme, name)
+			}
+			config, err := i.importScheme(doc, name, ref.Value, requirement[name])
+			if err != nil {
+				return apidef.AuthConfig{}, false, err
+			}
+			required = append(required, config)
+		}
+		// Scheme names do not survive an export, so order by type
+		sort.SliceStable(required, func(a, b int) bool {
+			return required[a].Type < required[b].Type
+		})
+
+		if len(required) == 1 {
+			alternatives = append(alternatives, required[0])
+		} else {
+			alternatives = append(alternatives, apidef.AuthConfig{
+				Type:        apidef.AuthMulti,
+				MultiMode:   apidef.MultiAuthAll,
+				MultiConfig: required,
+			})
+		}
+	}
+
+	if len(alternatives) == 1 {
+		return alternatives[0], false, nil
+	}
+	return apidef.AuthConfig{
+		Type:        apidef.AuthMulti,
+		MultiMode:   apidef.MultiAuthAny,
+		MultiConfig: alternatives,
+	}, false, nil
+}
+
+func (i *importer) importScheme(doc *openapi3.T, name string, scheme *openapi3.SecurityScheme, scopes []string) (apidef.AuthConfig, error) {
+	switch strings.ToLower(scheme.Type) {
+	case "apikey":
+		switch strings.ToLower(scheme.In) {
+		case "header", "query":
+		default:
+			return apidef.AuthConfig{}, fmt.Errorf("%w: %s passes its key in %q", ErrUnsupportedScheme, name, scheme.In)
+		}
+		return apidef.AuthConfig{
+			Type:         apidef.AuthAPIKey,
+			APIKeyConfig: &apidef.APIKeyConfig{Location: strings.ToLower(scheme.In), ParamName: scheme.Name},
+		}, nil
+
+	case "http":
+		switch strings.ToLower(scheme.Scheme) {
+		case "basic":
+			return apidef.AuthConfig{
+				Type:        apidef.AuthBasic,
+				BasicConfig: &apidef.BasicAuthConfig{Realm: doc.Info.Title},
+			}, nil
+		case "bearer":
+			config := &apidef.JWTConfig{}
+			if i.jwt != nil {
+				*config = *i.jwt
+			}
+			return apidef.AuthConfig{Type: apidef.AuthJWT, JWTConfig: config}, nil
+		default:
+			return apidef.AuthConfig{}, fmt.Errorf("%w: %s uses http scheme %q", ErrUnsupportedScheme, name, scheme.Scheme)
+		}
+
+	case "oauth2":
+		flow := oauthFlow(scheme.Flows)
+		if flow == nil {
+			return apidef.AuthConfig{}, fmt.Errorf("%w: %s has no flow with a token url", ErrUnsupportedScheme, name)
+		}
+		config := &apidef.OAuth2Config{}
+		if i.oauth2 != nil {
+			*config = *i.oauth2
+		}
+		config.TokenURL = flow.TokenURL
+		config.Scopes = sortedKeys(flow.Scopes)
+		config.RequiredScopes = append([]string(nil), scopes...)
+		if config.TokenLocation == "" {
+			config.TokenLocation = "header"
+		}
+		return apidef.AuthConfig{Type: apidef.AuthOAuth2, OAuth2Config: config}, nil
+
+	default:
+		return apidef.AuthConfig{}, fmt.Errorf("%w: %s has type %q", ErrUnsupportedScheme, name, scheme.Type)
+	}
+}
+
+// oauthFlow returns the flow whose token URL the gateway uses, preferring
+// client credentials
+func oauthFlow(flows *openapi3.OAuthFlows) *openapi3.OAuthFlow {
+	if flows == nil {
+		return nil
+	}
+	for _, flow := range []*openapi3.OAuthFlow{flows.ClientCredentials, flows.AuthorizationCode, flows.Password} {
+		if flow != nil && flow.TokenURL != "" {
+			return flow
+		}
+	}
+	return nil
+}
+
+// commonSecurity returns the security requirements of the document's
+// operations, an operation's own requirements replacing the document's.
+// Definitions authenticate the whole API, so operations requiring different
+// schemes fail the import. Anonymous alternatives are dropped: operations
+// open to anyone are authenticated like the others, and the API is keyless
+// only when all of them are open.
+func commonSecurity(doc *openapi3.T) (openapi3.SecurityRequirements, error) {
+	var common openapi3.SecurityRequirements
+	var commonKey, commonAt string
+	check := func(at string, requirements openapi3.SecurityRequirements) error {
+		var authenticated openapi3.SecurityRequirements
+		for _, requirement := range requirements {
+			if len(requirement) > 0 {
+				authenticated = append(authenticated, requirement)
+			}
+		}
+		if len(authenticated) == 0 {
+			return nil
+		}
+
+		key := requirementsKey(authenticated)
+		if common == nil {
+			common, commonKey, commonAt = authenticated, key, at
+			return nil
+		}
+		if key != commonKey {
+			return fmt.Errorf("%w: %s and %s", ErrMixedSecurity, commonAt, at)
+		}
+		return nil
+	}
+
+	var paths []string
+	if doc.Paths != nil {
+		paths = doc.Paths.InMatchingOrder()
+		sort.Strings(paths)
+	}
+
+	operations := 0
+	for _, path := range paths {
+		item := doc.Paths.Value(path)
+		methods := make([]string, 0, len(item.Operations()))
+		for method := range item.Operations() {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operations++
+			requirements := doc.Security
+			if operation := item.GetOperation(method); operation.Security != nil {
+				requirements = *operation.Security
+			}
+			if err := check(method+" "+path, requirements); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if operations == 0 {
+		if err := check("the document", doc.Security); err != nil {
+			return nil, err
+		}
+	}
+	return common, nil
+}
+
+// requirementsKey identifies a set of alternative requirements, whatever
+// their order
+func requirementsKey(requirements openapi3.SecurityRequirements) string {
+	keys := make([]string, len(requirements))
+	for i, requirement := range requirements {
+		keys[i] = requirementKey(requirement)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "|")
+}
+
+func requirementKey(requirement openapi3.SecurityRequirement) string {
+	names := make([]string, 0, len(requirement))
+	for name, scopes := range requirement {
+		names = append(names, name+":"+strings.Join(scopes, ","))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+func slug(title string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func stringExtension(extensions map[string]any, name string) string {
+	value, _ := extensions[name].(string)
+	return value
+}
+
+func intExtension(extensions map[string]any, name string) (int, bool) {
+	switch value := extensions[name].(type) {
+	case float64:
+		return int(value), value == float64(int(value))
+	case int:
+		return value, true
+	}
+	return 0, false
+}
+
+func sortedKeys(m map[string]string) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
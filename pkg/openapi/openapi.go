@@ -0,0 +1,48 @@
+package openapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Extensions carrying gateway settings OpenAPI has no field for. Export
+// writes them so exported documents import back to the same definition.
+const (
+	ExtensionAPIID      = "x-gochoreo-api-id"
+	ExtensionListenPath = "x-gochoreo-listen-path"
+	ExtensionTargetID   = "x-gochoreo-target-id"
+	ExtensionWeight     = "x-gochoreo-weight"
+)
+
+// Common OpenAPI errors
+var (
+	ErrUnsupportedVersion = errors.New("unsupported openapi version")
+	ErrNoServers          = errors.New("openapi document has no absolute http(s) server url")
+	ErrUnsupportedScheme  = errors.New("unsupported security scheme")
+	ErrUnknownScheme      = errors.New("security requirement references an undefined scheme")
+	ErrUnsupportedAuth    = errors.New("authentication cannot be expressed in openapi")
+	ErrMixedSecurity      = errors.New("operations require different security")
+)
+
+// Load parses and validates an OpenAPI 3 document in JSON or YAML.
+// References to other files or URLs are not followed.
+func Load(ctx context.Context, data []byte) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse openapi document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedVersion, doc.OpenAPI)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,170 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+	"github.com/vzahanych/gochoreo/pkg/openapi/validation"
+)
+
+const ordersSpec = `
+openapi: 3.0.3
+info:
+  title: Orders
+  version: 1.0.0
+paths:
+  /orders/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema: {type: integer, minimum: 1}
+    get:
+      operationId: getOrder
+      parameters:
+        - name: X-Tenant
+          in: header
+          required: true
+          schema: {type: string}
+      responses:
+        "200":
+          description: An order
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id, total]
+                properties:
+                  id: {type: integer}
+                  total: {type: number}
+  /orders:
+    post:
+      operationId: createOrder
+      parameters:
+        - name: dry_run
+          in: query
+          schema: {type: boolean}
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [sku, quantity]
+              properties:
+                sku: {type: string, pattern: "^[A-Z]{3}-[0-9]+$"}
+                quantity: {type: integer, minimum: 1}
+                items:
+                  type: array
+                  items: {type: string}
+      responses:
+        "201":
+          description: Created
+`
+
+// ExampleValidator rejects requests that do not match their operation,
+// listing every violation, and logs responses that do not match
+func ExampleValidator() {
+	core, logs := observer.New(zap.WarnLevel)
+	validator := validation.NewValidator(validation.WithLogger(&logger.Logger{Logger: zap.New(core)}))
+
+	registry := middleware.NewRegistry()
+	if err := validator.Register(registry); err != nil {
+		log.Fatalf("Failed to register validator: %v", err)
+	}
+
+	chain, err := registry.Build(&apidef.APIDefinition{
+		APIID:           "orders",
+		ListenPath:      "/shop",
+		StripListenPath: true,
+		Middleware: apidef.MiddlewareConfig{
+			Pre: []apidef.MiddlewareSpec{{
+				Name:    validation.MiddlewareName,
+				Enabled: true,
+				Config: map[string]interface{}{
+					"spec":               ordersSpec,
+					"validate_responses": true,
+				},
+			}},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to build middleware chain: %v", err)
+	}
+
+	handler := chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		fmt.Fprint(w, `{"id": 7, "total": "12.50"}`)
+	}))
+
+	send := func(method, target, body string, header http.Header) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		fmt.Println(w.Code, w.Header().Get("Content-Type"))
+		if w.Code >= 400 {
+			problem := &validation.Problem{}
+			data, _ := io.ReadAll(w.Body)
+			if err := json.Unmarshal(data, problem); err != nil {
+				log.Fatalf("Failed to decode problem: %v", err)
+			}
+			fmt.Println(" ", problem.ErrorCode, problem.Detail)
+			for _, violation := range problem.Violations {
+				fmt.Println("  -", violation)
+			}
+		}
+	}
+
+	send(http.MethodPost, "/orders?dry_run=maybe", `{"sku": "abc", "quantity": 0, "items": [1]}`, nil)
+	send(http.MethodPost, "/orders", `{"sku": "ABC-1", "quantity": 2}`, nil)
+	send(http.MethodGet, "/orders/0", "", nil)
+	send(http.MethodDelete, "/orders/7", "", nil)
+	send(http.MethodGet, "/customers", "", nil)
+
+	// Response violations are only logged
+	send(http.MethodGet, "/orders/7", "", http.Header{"X-Tenant": {"acme"}})
+	for _, entry := range logs.All() {
+		fmt.Println(entry.Message, entry.ContextMap()["violations"])
+	}
+
+	// Output:
+	// 400 application/problem+json
+	//   VALIDATION_FAILED request does not match the createOrder operation
+	//   - query dry_run: an invalid boolean: invalid syntax
+	//   - body /items/0: value must be a string
+	//   - body /quantity: number must be at least 1
+	//   - body /sku: string doesn't match the regular expression "^[A-Z]{3}-[0-9]+$"
+	// 201 application/json
+	// 400 application/problem+json
+	//   VALIDATION_FAILED request does not match the getOrder operation
+	//   - path id: number must be at least 1
+	//   - header X-Tenant: value is required but missing
+	// 405 application/problem+json
+	//   METHOD_NOT_ALLOWED DELETE is not an operation of /orders/7
+	// 404 application/problem+json
+	//   OPERATION_NOT_FOUND no operation matches /customers
+	// 200 application/json
+	// Response does not match its openapi operation [response /total: value must be a number]
+}
@@ -0,0 +1,202 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// ProblemContentType is the media type of problem details (RFC 9457)
+const ProblemContentType = "application/problem+json"
+
+// Error codes of validation problems
+const (
+	CodeValidationFailed  = "VALIDATION_FAILED"
+	CodeOperationNotFound = "OPERATION_NOT_FOUND"
+	CodeMethodNotAllowed  = "METHOD_NOT_ALLOWED"
+	CodeBodyTooLarge      = "REQUEST_BODY_TOO_LARGE"
+)
+
+// Violation is a single way in which traffic does not match its operation
+type Violation struct {
+	// In is where the violation is: path, query, header, cookie, body or
+	// response
+	In string `json:"in"`
+	// Name is the parameter violated
+	Name string `json:"name,omitempty"`
+	// Pointer is the JSON pointer of the offending value within a body or
+	// parameter value
+	Pointer string `json:"pointer,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats a violation for logs
+func (v Violation) String() string {
+	location := v.In
+	if v.Name != "" {
+		location += " " + v.Name
+	}
+	if v.Pointer != "" {
+		location += " " + v.Pointer
+	}
+	return location + ": " + v.Message
+}
+
+// Problem is a problem details body listing every violation of a request
+type Problem struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail,omitempty"`
+	Instance   string      `json:"instance,omitempty"`
+	ErrorCode  string      `json:"error_code"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// writeProblem writes a problem details response
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string, violations []Violation) {
+	problem := Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     detail,
+		Instance:   r.URL.Path,
+		ErrorCode:  code,
+		Violations: violations,
+	}
+	body, _ := json.Marshal(problem)
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Violations flattens the errors of request or response validation
+func Violations(err error) []Violation {
+	var violations []Violation
+	collect(err, Violation{}, &violations)
+	return violations
+}
+
+func collect(err error, base Violation, violations *[]Violation) {
+	if multi, ok := err.(openapi3.MultiError); ok {
+		for _, e := range multi {
+			collect(e, base, violations)
+		}
+		return
+	}
+
+	switch e := err.(type) {
+	case *openapi3filter.RequestError:
+		v := base
+		switch {
+		case e.Parameter != nil:
+			v.In, v.Name = e.Parameter.In, e.Parameter.Name
+		case e.RequestBody != nil:
+			v.In = "body"
+		default:
+			v.In = "request"
+		}
+		if detailed(e.Err) {
+			collect(e.Err, v, violations)
+			return
+		}
+		v.Message = e.Error()
+		if e.Parameter != nil || e.RequestBody != nil {
+			// Location is reported in its own fields
+			v.Message = reason(e.Reason, e.Err)
+		}
+		*violations = append(*violations, v)
+
+	case *openapi3filter.ResponseError:
+		v := base
+		v.In = "response"
+		if detailed(e.Err) {
+			collect(e.Err, v, violations)
+			return
+		}
+		v.Message = e.Error()
+		*violations = append(*violations, v)
+
+	case *openapi3.SchemaError:
+		v := base
+		v.Pointer = pointer(e.JSONPointer())
+		v.Message = e.Reason
+		*violations = append(*violations, v)
+
+	case *openapi3filter.ParseError:
+		v := base
+		path := make([]string, 0, len(e.Path()))
+		for _, segment := range e.Path() {
+			path = append(path, fmt.Sprint(segment))
+		}
+		v.Pointer = pointer(path)
+		v.Message = parseMessage(e)
+		*violations = append(*violations, v)
+
+	default:
+		v := base
+		if v.In == "" {
+			v.In = "request"
+		}
+		v.Message = err.Error()
+		*violations = append(*violations, v)
+	}
+}
+
+// detailed reports whether err carries errors locating the violation
+func detailed(err error) bool {
+	switch err.(type) {
+	case openapi3.MultiError, *openapi3.SchemaError, *openapi3filter.ParseError:
+		return true
+	}
+	return false
+}
+
+// parseMessage describes a parse error without echoing the value
+func parseMessage(e *openapi3filter.ParseError) string {
+	var parts []string
+	for {
+		if e.Reason != "" {
+			parts = append(parts, e.Reason)
+		}
+		cause, ok := e.Cause.(*openapi3filter.ParseError)
+		if !ok {
+			break
+		}
+		e = cause
+	}
+	if e.Cause != nil {
+		parts = append(parts, e.Cause.Error())
+	}
+	return strings.Join(parts, ": ")
+}
+
+func reason(reason string, err error) string {
+	if err == nil {
+		return reason
+	}
+	if reason == "" || reason == err.Error() {
+		return err.Error()
+	}
+	return reason + ": " + err.Error()
+}
+
+func pointer(path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	var b strings.Builder
+	for _, segment := range path {
+		b.WriteString("/")
+		b.WriteString(escaper.Replace(segment))
+	}
+	return b.String()
+}
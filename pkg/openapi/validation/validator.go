@@ -0,0 +1,361 @@
+package validation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+	"github.com/vzahanych/gochoreo/pkg/openapi"
+)
+
+// MiddlewareName is the name of the built-in validation middleware
+const MiddlewareName = "openapi_validation"
+
+// DefaultMaxBodySize is the largest body validated
+const DefaultMaxBodySize = 1 << 20
+
+// Common validation errors
+var ErrEmptySpec = errors.New("openapi validation needs a spec")
+
+// Config is the Config of openapi_validation middleware specs
+type Config struct {
+	// Spec is an OpenAPI 3 document, or the path of a .json, .yaml or .yml
+	// file holding one. Its paths are matched against requests as the
+	// upstream sees them, below the listen path when it is stripped.
+	Spec string `mapstructure:"spec"`
+	// ValidateResponses checks responses too. Responses are never changed:
+	// violations are only logged.
+	ValidateResponses bool `mapstructure:"validate_responses"`
+	// AllowUnknown passes requests matching no operation of the spec,
+	// which are rejected otherwise
+	AllowUnknown bool `mapstructure:"allow_unknown"`
+	// MaxBodySize is the largest body validated; larger requests are
+	// rejected and larger responses are not validated
+	MaxBodySize int `mapstructure:"max_body_size"`
+}
+
+// SetDefaults implements middleware.Defaulter
+func (c *Config) SetDefaults() {
+	c.MaxBodySize = DefaultMaxBodySize
+}
+
+// Validate implements middleware.Validator
+func (c *Config) Validate() error {
+	if strings.TrimSpace(c.Spec) == "" {
+		return ErrEmptySpec
+	}
+	if c.MaxBodySize <= 0 {
+		return fmt.Errorf("max_body_size must be positive")
+	}
+	return nil
+}
+
+// Validator builds middlewares validating requests, and optionally
+// responses, against the operations of an OpenAPI document. Documents are
+// compiled once per API and content, so rebuilding routes on definition
+// changes is cheap.
+type Validator struct {
+	logger *logger.Logger
+
+	mu       sync.Mutex
+	compiled map[specKey]*compiledSpec
+}
+
+type specKey struct {
+	apiID string
+	hash  [sha256.Size]byte
+}
+
+// compiledSpec routes requests to the operations of a document
+type compiledSpec struct {
+	router routers.Router
+}
+
+// Option allows customization of the validator
+type Option func(*Validator)
+
+// WithLogger sets the logger of response violations
+func WithLogger(log *logger.Logger) Option {
+	return func(v *Validator) {
+		v.logger = log
+	}
+}
+
+// NewValidator creates a validator
+func NewValidator(options ...Option) *Validator {
+	v := &Validator{compiled: make(map[specKey]*compiledSpec)}
+	for _, option := range options {
+		option(v)
+	}
+	if v.logger == nil {
+		v.logger = logger.GetGlobalLogger()
+	}
+	v.logger = v.logger.WithComponent("openapi_validation")
+	return v
+}
+
+// Register adds the openapi_validation built-in middleware to registry
+func (v *Validator) Register(registry *middleware.Registry) error {
+	return middleware.Register(registry, MiddlewareName, v.Build)
+}
+
+// Build creates the validation middleware of an API definition
+func (v *Validator) Build(def *apidef.APIDefinition, config *Config) (middleware.Middleware, error) {
+	source, err := loadSpec(config.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	base := ""
+	if !def.StripListenPath {
+		base = strings.TrimSuffix(def.GetListenPath(), "/")
+	}
+	spec, err := v.compile(def.APIID, source, base)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &handler{
+		apiID:  def.APIID,
+		spec:   spec,
+		config: config,
+		logger: v.logger,
+	}
+	return h.middleware, nil
+}
+
+// Internal methods
+
+func (v *Validator) compile(apiID string, source []byte, base string) (*compiledSpec, error) {
+	key := specKey{apiID: apiID, hash: sha256.Sum256(append([]byte(base+"\x00"), source...))}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if spec, ok := v.compiled[key]; ok {
+		return spec, nil
+	}
+
+	doc, err := openapi.Load(context.Background(), source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests are matched on their path alone, whatever the servers say
+	routing := *doc
+	routing.Servers = openapi3.Servers{{URL: base}}
+	router, err := gorillamux.NewRouter(&routing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to route openapi operations: %w", err)
+	}
+
+	// A definition uses one spec at a time
+	for k := range v.compiled {
+		if k.apiID == apiID {
+			delete(v.compiled, k)
+		}
+	}
+	spec := &compiledSpec{router: router}
+	v.compiled[key] = spec
+	return spec, nil
+}
+
+func loadSpec(spec string) ([]byte, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, ErrEmptySpec
+	}
+
+	if !strings.ContainsAny(spec, "\n\r") {
+		for _, ext := range []string{".json", ".yaml", ".yml"} {
+			if strings.HasSuffix(spec, ext) {
+				data, err := os.ReadFile(spec)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read openapi spec: %w", err)
+				}
+				return data, nil
+			}
+		}
+	}
+	return []byte(spec), nil
+}
+
+// handler validates the traffic of one API definition
+type handler struct {
+	apiID  string
+	spec   *compiledSpec
+	config *Config
+	logger *logger.Logger
+}
+
+func (h *handler) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := h.spec.router.FindRoute(r)
+		switch {
+		case err == nil:
+		case h.config.AllowUnknown:
+			next.ServeHTTP(w, r)
+			return
+		case errors.Is(err, routers.ErrMethodNotAllowed):
+			writeProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+				fmt.Sprintf("%s is not an operation of %s", r.Method, r.URL.Path), nil)
+			return
+		default:
+			writeProblem(w, r, http.StatusNotFound, CodeOperationNotFound,
+				"no operation matches "+r.URL.Path, nil)
+			return
+		}
+
+		if r.Body != nil && r.Body != http.NoBody {
+			body, err := io.ReadAll(io.LimitReader(r.Body, int64(h.config.MaxBodySize)+1))
+			r.Body.Close()
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, CodeValidationFailed, "failed to read request body", nil)
+				return
+			}
+			if len(body) > h.config.MaxBodySize {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+					fmt.Sprintf("request body exceeds %d bytes", h.config.MaxBodySize), nil)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError: true,
+				// Authentication is the gateway's
+				AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+				SkipSettingDefaults: true,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeValidationFailed,
+				"request does not match the "+operationName(route)+" operation", Violations(err))
+			return
+		}
+
+		if !h.config.ValidateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		capture := &captureWriter{ResponseWriter: w, maxBodySize: h.config.MaxBodySize, capturing: true}
+		next.ServeHTTP(capture, r)
+		h.validateResponse(r.Context(), input, capture)
+	})
+}
+
+// validateResponse logs how a response violates its operation
+func (h *handler) validateResponse(ctx context.Context, input *openapi3filter.RequestValidationInput, capture *captureWriter) {
+	if !capture.wroteHeader {
+		capture.status = http.StatusOK
+		capture.header = capture.Header().Clone()
+	}
+
+	options := &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true}
+	encoding := capture.header.Get("Content-Encoding")
+	if !capture.capturing || (encoding != "" && encoding != "identity") {
+		options.ExcludeResponseBody = true
+	}
+
+	response := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 capture.status,
+		Header:                 capture.header,
+		Options:                options,
+	}
+	response.SetBodyBytes(capture.body.Bytes())
+
+	if err := openapi3filter.ValidateResponse(ctx, response); err != nil {
+		violations := Violations(err)
+		messages := make([]string, len(violations))
+		for i, violation := range violations {
+			messages[i] = violation.String()
+		}
+		h.logger.Warn("Response does not match its openapi operation",
+			zap.String("api_id", h.apiID),
+			zap.String("operation", operationName(input.Route)),
+			zap.Int("status", capture.status),
+			zap.Strings("violations", messages),
+		)
+	}
+}
+
+func operationName(route *routers.Route) string {
+	if route.Operation != nil && route.Operation.OperationID != "" {
+		return route.Operation.OperationID
+	}
+	return route.Method + " " + route.Path
+}
+
+// captureWriter streams the response to the client while keeping a copy
+// to validate
+type captureWriter struct {
+	http.ResponseWriter
+	maxBodySize int
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+	capturing   bool
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.wroteHeader = true
+	w.status = status
+	w.header = w.Header().Clone()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.capturing {
+		if w.body.Len()+len(p) > w.maxBodySize {
+			w.capturing = false
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
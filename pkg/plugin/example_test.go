@@ -0,0 +1,130 @@
+package plugin_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+	"github.com/vzahanych/gochoreo/pkg/plugin"
+)
+
+func build(loader *plugin.Loader, path, funcName string) http.Handler {
+	registry := middleware.NewRegistry()
+	if err := loader.Register(registry); err != nil {
+		log.Fatalf("Failed to register plugin loader: %v", err)
+	}
+
+	chain, err := registry.Build(&apidef.APIDefinition{
+		APIID: "orders",
+		Middleware: apidef.MiddlewareConfig{
+			Pre: []apidef.MiddlewareSpec{{
+				Name:       "teapot",
+				Type:       middleware.TypePlugin,
+				Enabled:    true,
+				PluginPath: path,
+				FuncName:   funcName,
+			}},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to build middleware chain: %v", err)
+	}
+
+	return chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "upstream %s %s", r.URL.Path, r.Header.Get("X-Plugin"))
+	}))
+}
+
+func send(handler http.Handler) string {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	body, _ := io.ReadAll(w.Body)
+	return fmt.Sprint(w.Code, " ", strings.TrimSpace(string(body)))
+}
+
+// ExampleLoader runs WebAssembly plugin functions that rewrite requests,
+// short-circuit them, trap and loop forever
+func ExampleLoader() {
+	loader, err := plugin.NewLoader(
+		plugin.WithTimeout(50*time.Millisecond),
+		plugin.WithLogger(&logger.Logger{Logger: zap.NewNop()}),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create plugin loader: %v", err)
+	}
+	defer loader.Close()
+
+	for _, funcName := range []string{"rewrite", "handle", "crash", "spin"} {
+		fmt.Println(funcName, send(build(loader, "testdata/teapot.wasm", funcName)))
+	}
+
+	// Output:
+	// rewrite 200 upstream /v2/orders teapot
+	// handle 418 short and stout
+	// crash 500 {"error":"plugin failed","error_code":"PLUGIN_FAILED"}
+	// spin 500 {"error":"plugin failed","error_code":"PLUGIN_FAILED"}
+}
+
+// ExampleLoader_Reload shows plugins replaced when their file changes, and
+// a replacement rejected by the ABI check
+func ExampleLoader_Reload() {
+	dir, err := os.MkdirTemp("", "plugins")
+	if err != nil {
+		log.Fatalf("Failed to create plugin directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "teapot.wasm")
+	install := func(name string) {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			log.Fatalf("Failed to read plugin: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			log.Fatalf("Failed to install plugin: %v", err)
+		}
+	}
+	install("teapot.wasm")
+
+	loader, err := plugin.NewLoader(
+		plugin.WithReloadDelay(10*time.Millisecond),
+		plugin.WithLogger(&logger.Logger{Logger: zap.NewNop()}),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create plugin loader: %v", err)
+	}
+	defer loader.Close()
+
+	handler := build(loader, path, "handle")
+	fmt.Println(send(handler))
+
+	install("future.wasm")
+	fmt.Println(loader.Reload(path))
+	fmt.Println(send(handler))
+
+	// The watcher picks up the new version
+	install("coffee.wasm")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if strings.HasPrefix(send(handler), "200") {
+			break
+		}
+	}
+	fmt.Println(send(handler))
+
+	// Output:
+	// 418 short and stout
+	// plugin ABI version mismatch: plugin implements 2, loader 1
+	// 418 short and stout
+	// 200 coffee
+}
@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	goplugin "plugin"
+	"runtime/debug"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// GoFactory is the type of Go plugin functions named by FuncName. It is
+// given the spec's Config and returns the middleware. Plugins declare it
+// without importing this package.
+type GoFactory = func(config map[string]interface{}) (func(http.Handler) http.Handler, error)
+
+// goABISymbol is the int variable holding a Go plugin's ABI version
+const goABISymbol = "ABIVersion"
+
+// goPlugin is an opened Go plugin. Go plugins share the gateway's address
+// space: panics are recovered per request, but a plugin crashing the
+// runtime or corrupting memory takes the gateway down, and replaced
+// versions stay loaded.
+type goPlugin struct {
+	plugin *goplugin.Plugin
+}
+
+// openGoPlugin opens a Go plugin from a copy named after its contents, as
+// the Go runtime returns the already loaded plugin when a path is opened
+// twice. Rebuilt plugins must also differ in their plugin path, which go
+// build derives from their sources. The copy is written to the loader's
+// private directory and hashed again right before it is opened.
+func openGoPlugin(dir, hash string, data []byte) (*goPlugin, error) {
+	path := filepath.Join(dir, hash+".so")
+	if err := writePlugin(dir, path, data); err != nil {
+		return nil, fmt.Errorf("failed to copy plugin: %w", err)
+	}
+
+	copied, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin copy: %w", err)
+	}
+	if sum := sha256.Sum256(copied); hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("%w: %s", ErrPluginModified, path)
+	}
+
+	p, err := goplugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin: %w", err)
+	}
+
+	symbol, err := p.Lookup(goABISymbol)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, goABISymbol)
+	}
+	abi, ok := symbol.(*int)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is a %T, not an int", ErrABIMismatch, goABISymbol, symbol)
+	}
+	if *abi != ABIVersion {
+		return nil, fmt.Errorf("%w: plugin implements %d, loader %d", ErrABIMismatch, *abi, ABIVersion)
+	}
+	return &goPlugin{plugin: p}, nil
+}
+
+// writePlugin writes a plugin copy through a temporary file, replacing a
+// copy of the same contents left by an earlier version
+func writePlugin(dir, path string, data []byte) error {
+	f, err := os.CreateTemp(dir, "plugin-*.so")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o500)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (p *goPlugin) factory(funcName string) (GoFactory, error) {
+	symbol, err := p.plugin.Lookup(funcName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, funcName)
+	}
+	switch factory := symbol.(type) {
+	case GoFactory:
+		return factory, nil
+	case *GoFactory:
+		return *factory, nil
+	default:
+		return nil, fmt.Errorf("%w: %s is a %T, not a %T", ErrABIMismatch, funcName, symbol, GoFactory(nil))
+	}
+}
+
+// downstreamPanic carries a panic raised after a Go plugin handed the
+// request on, so it is not blamed on the plugin
+type downstreamPanic struct {
+	value interface{}
+}
+
+// goHandler is a Go plugin's handler around next, built once per version
+type goHandler struct {
+	mu      sync.Mutex
+	version *version
+	handler http.Handler
+}
+
+func (b *binding) serveGo(built *goHandler, v *version, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		if downstream, ok := value.(downstreamPanic); ok {
+			panic(downstream.value)
+		}
+		if value == http.ErrAbortHandler {
+			panic(value)
+		}
+		b.loader.logger.Error("Plugin panicked",
+			zap.String("api_id", b.apiID),
+			zap.String("path", b.module.path),
+			zap.String("func_name", b.funcName),
+			zap.Any("panic", value),
+			zap.ByteString("stack", debug.Stack()),
+		)
+		writeError(w, http.StatusInternalServerError, "plugin failed")
+	}()
+
+	handler, err := b.buildGo(built, v, next)
+	if err != nil {
+		b.fail(w, err)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+func (b *binding) buildGo(built *goHandler, v *version, next http.Handler) (http.Handler, error) {
+	built.mu.Lock()
+	defer built.mu.Unlock()
+
+	if built.version == v {
+		return built.handler, nil
+	}
+
+	factory, err := v.goPlugin.factory(b.funcName)
+	if err != nil {
+		return nil, err
+	}
+	middleware, err := callFactory(factory, b.config)
+	if err != nil {
+		return nil, err
+	}
+
+	built.version = v
+	built.handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if value := recover(); value != nil {
+				panic(downstreamPanic{value: value})
+			}
+		}()
+		next.ServeHTTP(w, r)
+	}))
+	return built.handler, nil
+}
+
+func callFactory(factory GoFactory, config map[string]interface{}) (middleware func(http.Handler) http.Handler, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = fmt.Errorf("plugin factory panicked: %v", value)
+		}
+	}()
+
+	middleware, err = factory(config)
+	if err == nil && middleware == nil {
+		err = errors.New("plugin factory returned no middleware")
+	}
+	return middleware, err
+}
@@ -0,0 +1,533 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+)
+
+// ABIVersion is the plugin ABI implemented by the loader. Go plugins export
+// it as an int variable named ABIVersion and WebAssembly modules return it
+// from gochoreo_abi_version.
+const ABIVersion = 1
+
+// Default loader limits
+const (
+	DefaultTimeout     = 100 * time.Millisecond
+	DefaultMemoryLimit = 16 << 20
+	DefaultMaxBodySize = 1 << 20
+	DefaultReloadDelay = 200 * time.Millisecond
+)
+
+// Common plugin errors
+var (
+	ErrABIMismatch     = errors.New("plugin ABI version mismatch")
+	ErrSymbolNotFound  = errors.New("plugin symbol not found")
+	ErrUnknownFormat   = errors.New("unknown plugin format")
+	ErrPluginNotLoaded = errors.New("plugin not loaded")
+	ErrLoaderClosed    = errors.New("plugin loader closed")
+	ErrTimeout         = errors.New("plugin exceeded its time limit")
+	ErrPluginModified  = errors.New("plugin copy modified before it was opened")
+)
+
+// Loader builds middlewares from plugin specs: Go plugins (.so) and
+// WebAssembly modules. Each file is loaded once and shared by the specs
+// naming it; when it changes on disk it is reloaded and the specs switch
+// to the new version, provided it passes the same checks. A file failing
+// them leaves the previous version in place.
+type Loader struct {
+	mu      sync.Mutex
+	modules map[string]*module
+	runtime wazero.Runtime
+	watcher *fsnotify.Watcher
+	watched map[string]bool
+	closed  bool
+	done    chan struct{}
+
+	dirMu sync.Mutex
+	dir   string
+
+	timeout     time.Duration
+	memoryLimit int
+	maxBodySize int
+	reloadDelay time.Duration
+	watch       bool
+	logger      *logger.Logger
+}
+
+// Option allows customization of the loader
+type Option func(*Loader)
+
+// WithTimeout bounds the time a WebAssembly plugin may run for a request
+func WithTimeout(timeout time.Duration) Option {
+	return func(l *Loader) {
+		l.timeout = timeout
+	}
+}
+
+// WithMemoryLimit caps the linear memory of WebAssembly plugin instances,
+// rounded down to 64KiB pages
+func WithMemoryLimit(bytes int) Option {
+	return func(l *Loader) {
+		l.memoryLimit = bytes
+	}
+}
+
+// WithMaxBodySize sets the largest request body passed to WebAssembly
+// plugins
+func WithMaxBodySize(size int) Option {
+	return func(l *Loader) {
+		l.maxBodySize = size
+	}
+}
+
+// WithWatch enables or disables reloading plugins when their files change
+func WithWatch(enabled bool) Option {
+	return func(l *Loader) {
+		l.watch = enabled
+	}
+}
+
+// WithReloadDelay sets how long a changed file must stay unchanged before
+// it is reloaded, so partially written files are not loaded
+func WithReloadDelay(delay time.Duration) Option {
+	return func(l *Loader) {
+		l.reloadDelay = delay
+	}
+}
+
+// WithLogger sets the logger used to report plugin failures and reloads
+func WithLogger(log *logger.Logger) Option {
+	return func(l *Loader) {
+		l.logger = log
+	}
+}
+
+// NewLoader creates a loader. Close releases its WebAssembly runtime and
+// file watcher.
+func NewLoader(options ...Option) (*Loader, error) {
+	l := &Loader{
+		modules:     make(map[string]*module),
+		watched:     make(map[string]bool),
+		done:        make(chan struct{}),
+		timeout:     DefaultTimeout,
+		memoryLimit: DefaultMemoryLimit,
+		maxBodySize: DefaultMaxBodySize,
+		reloadDelay: DefaultReloadDelay,
+		watch:       true,
+	}
+	for _, option := range options {
+		option(l)
+	}
+	if l.logger == nil {
+		l.logger = logger.GetGlobalLogger()
+	}
+	l.logger = l.logger.WithComponent("plugin")
+
+	pages := uint32(l.memoryLimit / wasmPageSize)
+	if pages == 0 {
+		return nil, fmt.Errorf("memory limit must be at least %d bytes", wasmPageSize)
+	}
+	ctx := context.Background()
+	l.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, l.runtime); err != nil {
+		l.runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate wasi: %w", err)
+	}
+
+	if l.watch {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			l.runtime.Close(ctx)
+			return nil, fmt.Errorf("failed to create file watcher: %w", err)
+		}
+		l.watcher = watcher
+		go l.watchLoop()
+	}
+	return l, nil
+}
+
+// Register makes the loader the factory of plugin specs in registry
+func (l *Loader) Register(registry *middleware.Registry) error {
+	return registry.RegisterType(middleware.TypePlugin, l.Factory)
+}
+
+// Factory implements middleware.Factory. spec.PluginPath names a Go plugin
+// or WebAssembly module and spec.FuncName the function building, or
+// handling, requests; spec.Config is passed to the plugin.
+func (l *Loader) Factory(def *apidef.APIDefinition, spec *apidef.MiddlewareSpec) (middleware.Middleware, error) {
+	if spec.PluginPath == "" || spec.FuncName == "" {
+		return nil, fmt.Errorf("plugin_path and func_name are required")
+	}
+
+	m, err := l.open(spec.PluginPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.bind(spec.FuncName); err != nil {
+		return nil, err
+	}
+
+	b := &binding{
+		loader:   l,
+		module:   m,
+		apiID:    def.APIID,
+		funcName: spec.FuncName,
+		config:   spec.Config,
+	}
+	return b.middleware, nil
+}
+
+// Reload loads the current contents of a plugin file, as done when the
+// file changes
+func (l *Loader) Reload(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	m, ok := l.modules[path]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPluginNotLoaded, path)
+	}
+	return m.reload()
+}
+
+// Close stops watching plugin files and releases WebAssembly modules. Go
+// plugins cannot be unloaded.
+func (l *Loader) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	l.mu.Unlock()
+
+	var errs []error
+	if l.watcher != nil {
+		errs = append(errs, l.watcher.Close())
+	}
+	errs = append(errs, l.runtime.Close(context.Background()))
+
+	l.dirMu.Lock()
+	if l.dir != "" {
+		errs = append(errs, os.RemoveAll(l.dir))
+		l.dir = ""
+	}
+	l.dirMu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Internal methods
+
+// pluginDir returns the loader's private directory for Go plugin copies,
+// creating it on first use
+func (l *Loader) pluginDir() (string, error) {
+	l.dirMu.Lock()
+	defer l.dirMu.Unlock()
+
+	if l.dir == "" {
+		dir, err := os.MkdirTemp("", "gochoreo-plugins-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create plugin directory: %w", err)
+		}
+		l.dir = dir
+	}
+	return l.dir, nil
+}
+
+// open returns the loaded module of a file, loading it on first use
+func (l *Loader) open(path string) (*module, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, ErrLoaderClosed
+	}
+	if m, ok := l.modules[path]; ok {
+		return m, nil
+	}
+
+	m := &module{loader: l, path: path, funcs: make(map[string]bool)}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	l.modules[path] = m
+
+	if l.watcher != nil {
+		dir := filepath.Dir(path)
+		if !l.watched[dir] {
+			// Directories are watched so files replaced by a rename are seen
+			if err := l.watcher.Add(dir); err != nil {
+				l.logger.Warn("Failed to watch plugin directory, changes will not be reloaded",
+					zap.String("dir", dir),
+					zap.Error(err),
+				)
+			} else {
+				l.watched[dir] = true
+			}
+		}
+	}
+	return m, nil
+}
+
+func (l *Loader) watchLoop() {
+	timers := make(map[string]*time.Timer)
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case err, ok := <-l.watcher.Errors:
+			if !ok {
+				return
+			}
+			l.logger.Warn("Plugin watcher error", zap.Error(err))
+		case event, ok := <-l.watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+
+			l.mu.Lock()
+			m, loaded := l.modules[event.Name]
+			l.mu.Unlock()
+			if !loaded {
+				continue
+			}
+
+			if timer, ok := timers[m.path]; ok {
+				timer.Reset(l.reloadDelay)
+				continue
+			}
+			timers[m.path] = time.AfterFunc(l.reloadDelay, func() {
+				if err := m.reload(); err != nil {
+					l.logger.Error("Plugin reload failed, keeping the previous version",
+						zap.String("path", m.path),
+						zap.Error(err),
+					)
+				}
+			})
+		}
+	}
+}
+
+// module is a plugin file and its current version
+type module struct {
+	loader  *Loader
+	path    string
+	current atomic.Pointer[version]
+
+	// mu serializes reloads and guards funcs, the functions bound by specs
+	// which every new version must provide
+	mu    sync.Mutex
+	funcs map[string]bool
+}
+
+// version is one loaded revision of a plugin file
+type version struct {
+	generation uint64
+	hash       string
+	goPlugin   *goPlugin
+	wasm       *wasmModule
+
+	// refs counts the requests using the version; a replaced version is
+	// closed once the last of them finished
+	refs      atomic.Int64
+	retired   atomic.Bool
+	closeOnce sync.Once
+}
+
+// lookup checks a version provides a plugin function
+func (v *version) lookup(funcName string) error {
+	if v.goPlugin != nil {
+		_, err := v.goPlugin.factory(funcName)
+		return err
+	}
+	return v.wasm.check(funcName)
+}
+
+func (m *module) bind(funcName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.current.Load().lookup(funcName); err != nil {
+		return err
+	}
+	m.funcs[funcName] = true
+	return nil
+}
+
+// reload loads the file unless its contents are unchanged, and makes it the
+// current version once it passed the ABI check and provides every bound
+// function
+func (m *module) reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("failed to read plugin: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	previous := m.current.Load()
+	if previous != nil && previous.hash == hash {
+		return nil
+	}
+
+	next := &version{hash: hash}
+	if previous != nil {
+		next.generation = previous.generation + 1
+	}
+
+	switch {
+	case isWasm(data):
+		next.wasm, err = m.loader.compileWasm(data)
+	case strings.HasSuffix(m.path, ".so"):
+		var dir string
+		if dir, err = m.loader.pluginDir(); err == nil {
+			next.goPlugin, err = openGoPlugin(dir, hash, data)
+		}
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownFormat, m.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	for funcName := range m.funcs {
+		if err := next.lookup(funcName); err != nil {
+			next.close()
+			return err
+		}
+	}
+
+	m.current.Store(next)
+	if previous != nil {
+		previous.retire()
+		m.loader.logger.Info("Plugin reloaded",
+			zap.String("path", m.path),
+			zap.Uint64("generation", next.generation),
+		)
+	}
+	return nil
+}
+
+// acquire returns the current version, which stays open until released
+func (m *module) acquire() *version {
+	for {
+		v := m.current.Load()
+		v.refs.Add(1)
+		// a version replaced before it was counted may already be closed
+		if m.current.Load() == v {
+			return v
+		}
+		v.release()
+	}
+}
+
+// release ends a request's use of the version
+func (v *version) release() {
+	if v.refs.Add(-1) == 0 && v.retired.Load() {
+		v.close()
+	}
+}
+
+// retire marks a replaced version, closing it when no request uses it
+func (v *version) retire() {
+	v.retired.Store(true)
+	if v.refs.Load() == 0 {
+		v.close()
+	}
+}
+
+// close releases a version
+func (v *version) close() {
+	v.closeOnce.Do(func() {
+		if v.wasm != nil {
+			v.wasm.compiled.Close(context.Background())
+		}
+	})
+}
+
+// binding is a spec's use of a plugin function
+type binding struct {
+	loader   *Loader
+	module   *module
+	apiID    string
+	funcName string
+	config   map[string]interface{}
+}
+
+func (b *binding) middleware(next http.Handler) http.Handler {
+	built := &goHandler{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := b.module.acquire()
+		defer v.release()
+		if v.wasm != nil {
+			b.serveWasm(v.wasm, w, r, next)
+			return
+		}
+		b.serveGo(built, v, w, r, next)
+	})
+}
+
+func (b *binding) fail(w http.ResponseWriter, err error) {
+	b.loader.logger.Error("Plugin failed",
+		zap.String("api_id", b.apiID),
+		zap.String("path", b.module.path),
+		zap.String("func_name", b.funcName),
+		zap.Error(err),
+	)
+	writeError(w, http.StatusInternalServerError, "plugin failed")
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":      message,
+		"error_code": "PLUGIN_FAILED",
+	})
+}
@@ -0,0 +1,35 @@
+;; Source of teapot.wasm. coffee.wasm is the same module with handle
+;; answering 200 "coffee", and future.wasm the same module implementing ABI
+;; version 2. Response bodies are base64 encoded.
+(module
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 4096))
+
+  (data (i32.const 1024) "{\"response\":{\"status\":418,\"headers\":{\"Content-Type\":[\"text/plain\"]},\"body\":\"c2hvcnQgYW5kIHN0b3V0\"}}")
+  (data (i32.const 2048) "{\"request\":{\"path\":\"/v2/orders\",\"headers\":{\"X-Plugin\":[\"teapot\"]}}}")
+
+  (func (export "gochoreo_abi_version") (result i32)
+    i32.const 1)
+
+  ;; bump allocator, growing memory when needed
+  (func (export "gochoreo_alloc") (param $size i32) (result i32)
+    (if (i32.gt_u (i32.add (global.get $next) (local.get $size))
+                  (i32.shl (memory.size) (i32.const 16)))
+      (then (drop (memory.grow (i32.add (i32.shr_u (local.get $size) (i32.const 16)) (i32.const 1))))))
+    (global.get $next)
+    (global.set $next (i32.add (global.get $next) (local.get $size))))
+
+  ;; short-circuits every request with a 418
+  (func (export "handle") (param i32 i32) (result i64)
+    i64.const 0x0000040000000063) ;; 1024 << 32 | 99
+
+  ;; rewrites the path and replaces the headers
+  (func (export "rewrite") (param i32 i32) (result i64)
+    i64.const 0x0000080000000043) ;; 2048 << 32 | 67
+
+  (func (export "crash") (param i32 i32) (result i64)
+    unreachable)
+
+  (func (export "spin") (param i32 i32) (result i64)
+    (loop $forever (br $forever))
+    unreachable))
@@ -0,0 +1,360 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/auth"
+)
+
+// WebAssembly ABI exports. Besides these and its memory, a module exports
+// the functions named by FuncName, taking the pointer and length of a JSON
+// encoded WasmInput and returning the pointer and length of a JSON encoded
+// WasmOutput packed into an i64, pointer in the high 32 bits.
+const (
+	WasmABIExport    = "gochoreo_abi_version" // () -> i32
+	WasmAllocExport  = "gochoreo_alloc"       // (size i32) -> i32
+	WasmMemoryExport = "memory"
+)
+
+const wasmPageSize = 65536
+
+var wasmMagic = []byte("\x00asm")
+
+// WasmInput is passed to WebAssembly plugin functions
+type WasmInput struct {
+	Config    map[string]interface{} `json:"config,omitempty"`
+	Request   WasmRequest            `json:"request"`
+	Principal *auth.Principal        `json:"principal,omitempty"`
+}
+
+// WasmRequest describes the request being handled. Body is base64 encoded.
+type WasmRequest struct {
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Query      string      `json:"query,omitempty"`
+	Host       string      `json:"host,omitempty"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+// WasmOutput is returned by WebAssembly plugin functions. A Response
+// short-circuits the request; otherwise the Request fields set replace the
+// request's before it is passed on.
+type WasmOutput struct {
+	Request  *WasmRequestChanges `json:"request,omitempty"`
+	Response *WasmResponse       `json:"response,omitempty"`
+}
+
+// WasmRequestChanges lists the request fields a plugin replaces. Headers
+// replaces every header.
+type WasmRequestChanges struct {
+	Method  *string     `json:"method,omitempty"`
+	Path    *string     `json:"path,omitempty"`
+	Query   *string     `json:"query,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    *[]byte     `json:"body,omitempty"`
+}
+
+// WasmResponse is a response written instead of passing the request on
+type WasmResponse struct {
+	Status  int         `json:"status,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// wasmModule is a compiled WebAssembly plugin. Every request runs in a
+// fresh instance with its own linear memory, bounded by the loader's memory
+// limit and timeout, and with WASI but no file system, network or
+// environment. Traps, exhausted memory and timeouts fail the request only.
+type wasmModule struct {
+	loader   *Loader
+	compiled wazero.CompiledModule
+}
+
+func isWasm(data []byte) bool {
+	return bytes.HasPrefix(data, wasmMagic)
+}
+
+// compileWasm compiles a module and checks its ABI exports and version
+func (l *Loader) compileWasm(data []byte) (*wasmModule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	compiled, err := l.runtime.CompileModule(context.Background(), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile plugin: %w", err)
+	}
+	m := &wasmModule{loader: l, compiled: compiled}
+
+	checks := []struct {
+		name    string
+		params  []api.ValueType
+		results []api.ValueType
+	}{
+		{WasmABIExport, nil, []api.ValueType{api.ValueTypeI32}},
+		{WasmAllocExport, []api.ValueType{api.ValueTypeI32}, []api.ValueType{api.ValueTypeI32}},
+	}
+	for _, check := range checks {
+		if err := m.signature(check.name, check.params, check.results); err != nil {
+			compiled.Close(ctx)
+			return nil, err
+		}
+	}
+	if _, ok := compiled.ExportedMemories()[WasmMemoryExport]; !ok {
+		compiled.Close(ctx)
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, WasmMemoryExport)
+	}
+
+	instance, err := m.instantiate(ctx, io.Discard)
+	if err != nil {
+		compiled.Close(ctx)
+		return nil, err
+	}
+	defer instance.Close(context.Background())
+
+	results, err := instance.ExportedFunction(WasmABIExport).Call(ctx)
+	if err != nil {
+		compiled.Close(ctx)
+		return nil, fmt.Errorf("failed to read plugin ABI version: %w", err)
+	}
+	if abi := api.DecodeI32(results[0]); abi != ABIVersion {
+		compiled.Close(ctx)
+		return nil, fmt.Errorf("%w: plugin implements %d, loader %d", ErrABIMismatch, abi, ABIVersion)
+	}
+	return m, nil
+}
+
+// check verifies a plugin function is exported with the ABI signature
+func (m *wasmModule) check(funcName string) error {
+	return m.signature(funcName,
+		[]api.ValueType{api.ValueTypeI32, api.ValueTypeI32},
+		[]api.ValueType{api.ValueTypeI64},
+	)
+}
+
+func (m *wasmModule) signature(name string, params, results []api.ValueType) error {
+	definition, ok := m.compiled.ExportedFunctions()[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSymbolNotFound, name)
+	}
+	if !bytes.Equal(definition.ParamTypes(), params) || !bytes.Equal(definition.ResultTypes(), results) {
+		return fmt.Errorf("%w: %s has signature (%s) -> (%s)", ErrABIMismatch, name,
+			valueTypes(definition.ParamTypes()), valueTypes(definition.ResultTypes()))
+	}
+	return nil
+}
+
+func (m *wasmModule) instantiate(ctx context.Context, stderr io.Writer) (api.Module, error) {
+	// Anonymous instances can run concurrently; reactor modules built with
+	// WASI initialize in _initialize
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStdout(stderr).
+		WithStderr(stderr)
+
+	instance, err := m.loader.runtime.InstantiateModule(ctx, m.compiled, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate plugin: %w", err)
+	}
+	return instance, nil
+}
+
+// call runs a plugin function over input in a new instance
+func (m *wasmModule) call(ctx context.Context, funcName string, input []byte, stderr io.Writer) (*WasmOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.loader.timeout)
+	defer cancel()
+
+	output, err := m.invoke(ctx, funcName, input, stderr)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w of %s", ErrTimeout, m.loader.timeout)
+	}
+	return output, err
+}
+
+func (m *wasmModule) invoke(ctx context.Context, funcName string, input []byte, stderr io.Writer) (*WasmOutput, error) {
+	instance, err := m.instantiate(ctx, stderr)
+	if err != nil {
+		return nil, err
+	}
+	defer instance.Close(context.Background())
+
+	results, err := instance.ExportedFunction(WasmAllocExport).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate plugin input: %w", err)
+	}
+	ptr := api.DecodeU32(results[0])
+	if !instance.Memory().Write(ptr, input) {
+		return nil, fmt.Errorf("plugin allocated input out of memory bounds")
+	}
+
+	results, err = instance.ExportedFunction(funcName).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	data, ok := instance.Memory().Read(uint32(results[0]>>32), uint32(results[0]))
+	if !ok {
+		return nil, fmt.Errorf("plugin returned output out of memory bounds")
+	}
+
+	output := &WasmOutput{}
+	if err := json.Unmarshal(data, output); err != nil {
+		return nil, fmt.Errorf("invalid plugin output: %w", err)
+	}
+	return output, nil
+}
+
+func (b *binding) serveWasm(m *wasmModule, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		data, err := io.ReadAll(io.LimitReader(r.Body, int64(b.loader.maxBodySize)+1))
+		r.Body.Close()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		if len(data) > b.loader.maxBodySize {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body exceeds the plugin size limit")
+			return
+		}
+		body = data
+	}
+
+	input := WasmInput{
+		Config: b.config,
+		Request: WasmRequest{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Host:       r.Host,
+			RemoteAddr: r.RemoteAddr,
+			Headers:    r.Header,
+			Body:       body,
+		},
+	}
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		input.Principal = principal
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		b.fail(w, err)
+		return
+	}
+
+	output, err := m.call(r.Context(), b.funcName, data, &outputWriter{binding: b})
+	if err != nil {
+		b.fail(w, err)
+		return
+	}
+
+	if output.Response != nil {
+		if err := writeResponse(w, output.Response); err != nil {
+			b.fail(w, err)
+		}
+		return
+	}
+	if err := applyChanges(r, output.Request, body); err != nil {
+		b.fail(w, err)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// applyChanges replaces the request fields set by a plugin, and restores
+// the body read for it otherwise
+func applyChanges(r *http.Request, changes *WasmRequestChanges, body []byte) error {
+	if changes == nil {
+		changes = &WasmRequestChanges{}
+	}
+
+	if changes.Method != nil && *changes.Method != "" {
+		r.Method = strings.ToUpper(*changes.Method)
+	}
+	if changes.Path != nil {
+		if !strings.HasPrefix(*changes.Path, "/") {
+			return fmt.Errorf("request path %q must start with /", *changes.Path)
+		}
+		r.URL.Path = *changes.Path
+		r.URL.RawPath = ""
+	}
+	if changes.Query != nil {
+		r.URL.RawQuery = *changes.Query
+	}
+	if changes.Headers != nil {
+		for key := range r.Header {
+			delete(r.Header, key)
+		}
+		for key, values := range changes.Headers {
+			r.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+
+	if changes.Body == nil {
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		return nil
+	}
+	data := *changes.Body
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.Header.Del("Content-Length")
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+func writeResponse(w http.ResponseWriter, response *WasmResponse) error {
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status < 200 || status > 599 {
+		return fmt.Errorf("invalid response status %d", status)
+	}
+
+	header := w.Header()
+	for key, values := range response.Headers {
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+	header.Set("Content-Length", strconv.Itoa(len(response.Body)))
+	w.WriteHeader(status)
+	w.Write(response.Body)
+	return nil
+}
+
+// outputWriter logs what a plugin writes to stdout and stderr
+type outputWriter struct {
+	binding *binding
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	o.binding.loader.logger.Info("Plugin output",
+		zap.String("api_id", o.binding.apiID),
+		zap.String("path", o.binding.module.path),
+		zap.String("output", strings.TrimRight(string(p), "\n")),
+	)
+	return len(p), nil
+}
+
+func valueTypes(types []api.ValueType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = api.ValueTypeName(t)
+	}
+	return strings.Join(names, ", ")
+}
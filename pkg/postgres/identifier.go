@@ -0,0 +1,20 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+
+// ValidTableName reports whether name is a plain, optionally schema
+// qualified, table name that is safe to interpolate into queries
+func ValidTableName(name string) bool {
+	return tableNamePattern.MatchString(name)
+}
+
+// UnqualifiedName strips the schema from a possibly schema qualified name,
+// for example to derive index names from a table name
+func UnqualifiedName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
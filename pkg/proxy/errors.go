@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vzahanych/gochoreo/pkg/balancer"
+)
+
+// Common proxy errors
+var (
+	ErrNilConfig       = errors.New("proxy config cannot be nil")
+	ErrNoTargets       = errors.New("either target_url or targets must be specified")
+	ErrNoHealthyTarget = balancer.ErrNoHealthyTarget
+
+	ErrHealthCheckSelector = errors.New("health checks need target_url or the built-in balancer, not a custom selector")
+)
+
+// TargetError represents an invalid upstream target
+type TargetError struct {
+	URL   string
+	Cause error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("invalid upstream target %q: %v", e.URL, e.Cause)
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Cause
+}
+
+// UpstreamError represents a failed exchange with an upstream target
+type UpstreamError struct {
+	Target   string
+	Attempts int
+	Cause    error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream %s failed after %d attempt(s): %v", e.Target, e.Attempts, e.Cause)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Cause
+}
@@ -0,0 +1,134 @@
+package proxy_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/proxy"
+)
+
+// ExampleProxy demonstrates forwarding with static headers and host rewriting
+func ExampleProxy() {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "path=%s query=%s env=%s host-rewritten=%t",
+			r.URL.Path, r.URL.RawQuery, r.Header.Get("X-Env"), r.Host != "api.example.com")
+	}))
+	defer upstream.Close()
+
+	p, err := proxy.New(&apidef.ProxyConfig{
+		TargetURL:       upstream.URL + "/v1?source=gateway",
+		ConnectTimeout:  time.Second,
+		ResponseTimeout: 2 * time.Second,
+		Headers:         map[string]string{"X-Env": "staging"},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create proxy: %v", err)
+	}
+	defer p.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com/users?id=7", nil)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+
+	fmt.Println(rec.Code, rec.Body.String())
+	// Output: 200 path=/v1/users query=source=gateway&id=7 env=staging host-rewritten=true
+}
+
+// ExampleProxy_retries demonstrates retrying idempotent requests with a replayed body
+func ExampleProxy_retries() {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "attempt %d got %q", calls.Load(), body)
+	}))
+	defer upstream.Close()
+
+	p, err := proxy.New(&apidef.ProxyConfig{
+		Targets:            []apidef.UpstreamTarget{{ID: "primary", URL: upstream.URL, Weight: 1}},
+		RetryAttempts:      2,
+		RetryBackoff:       10 * time.Millisecond,
+		PreserveHostHeader: true,
+	}, proxy.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create proxy: %v", err)
+	}
+	defer p.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/items/1", strings.NewReader(`{"name":"widget"}`))
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+
+	fmt.Println(rec.Code, rec.Body.String())
+	// Output: 200 attempt 3 got "{\"name\":\"widget\"}"
+}
+
+// ExampleProxy_healthCheck demonstrates active health checks of a single
+// target_url, which is taken out of service while its probes fail
+func ExampleProxy_healthCheck() {
+	var healthy atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer upstream.Close()
+
+	p, err := proxy.New(&apidef.ProxyConfig{
+		TargetURL:   upstream.URL,
+		HealthCheck: &apidef.HealthCheck{Enabled: true, Path: "/healthz"},
+	}, proxy.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create proxy: %v", err)
+	}
+	defer p.Close()
+
+	send := func() {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		fmt.Println(rec.Code)
+	}
+
+	p.HealthChecker().CheckNow(context.Background())
+	send()
+
+	healthy.Store(true)
+	p.HealthChecker().CheckNow(context.Background())
+	send()
+
+	// Output:
+	// 503
+	// 200
+}
+
+// ExampleBuildTLSConfig demonstrates upstream TLS version parsing
+func ExampleBuildTLSConfig() {
+	tlsConfig, err := proxy.BuildTLSConfig(&apidef.TLSConfig{
+		Enabled:    true,
+		ServerName: "backend.internal",
+		MinVersion: "TLS1.2",
+		MaxVersion: "1.3",
+	})
+	if err != nil {
+		log.Fatalf("Failed to build TLS config: %v", err)
+	}
+
+	fmt.Printf("server=%s min=%x max=%x\n", tlsConfig.ServerName, tlsConfig.MinVersion, tlsConfig.MaxVersion)
+	// Output: server=backend.internal min=303 max=304
+}
@@ -0,0 +1,378 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/balancer"
+	"github.com/vzahanych/gochoreo/pkg/circuitbreaker"
+	"github.com/vzahanych/gochoreo/pkg/healthcheck"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/otel"
+)
+
+// maxReplayBodyBytes is the largest request body buffered for retries.
+// Larger bodies are streamed and the request is not retried.
+const maxReplayBodyBytes = 1 << 20 // 1 MB
+
+// Selector chooses the upstream target for each attempt of a request
+type Selector interface {
+	// Select returns the target that should receive the request
+	Select(r *http.Request) (*apidef.UpstreamTarget, error)
+
+	// Release reports the outcome of an attempt against a selected target.
+	// statusCode is zero when err is non-nil. Release is called once the
+	// upstream response body has been closed.
+	Release(target *apidef.UpstreamTarget, statusCode int, err error)
+}
+
+// Proxy forwards requests to the upstream targets described by a ProxyConfig
+type Proxy struct {
+	config    *apidef.ProxyConfig
+	selector  Selector
+	transport *http.Transport
+	handler   *httputil.ReverseProxy
+	checker   *healthcheck.Checker
+	breaker   *circuitbreaker.Selector
+	telemetry *otel.Client
+	logger    *logger.Logger
+}
+
+// Option allows customization of the proxy
+type Option func(*Proxy)
+
+// WithSelector sets the upstream target selector
+func WithSelector(selector Selector) Option {
+	return func(p *Proxy) {
+		p.selector = selector
+	}
+}
+
+// WithLogger sets the logger used for upstream errors
+func WithLogger(log *logger.Logger) Option {
+	return func(p *Proxy) {
+		p.logger = log
+	}
+}
+
+// WithMetrics reports upstream circuit breaker metrics through the given OpenTelemetry client
+func WithMetrics(client *otel.Client) Option {
+	return func(p *Proxy) {
+		p.telemetry = client
+	}
+}
+
+// New creates a new reverse proxy from the given configuration
+func New(config *apidef.ProxyConfig, options ...Option) (*Proxy, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+
+	targets, err := parseTargets(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport: %w", err)
+	}
+
+	p := &Proxy{
+		config:    config,
+		transport: transport,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	if p.logger == nil {
+		p.logger = logger.GetGlobalLogger()
+	}
+	p.logger = p.logger.WithComponent("proxy")
+
+	if p.selector == nil {
+		if p.selector, err = defaultSelector(config); err != nil {
+			return nil, err
+		}
+	}
+
+	// Active health checks feed target state back into the selector
+	if config.HealthCheck != nil && config.HealthCheck.Enabled {
+		var targets []*apidef.UpstreamTarget
+		var listener healthcheck.Option
+		switch selector := p.selector.(type) {
+		case *balancer.Balancer:
+			targets, listener = selector.Targets(), healthcheck.WithBalancer(selector)
+		case *staticSelector:
+			targets, listener = []*apidef.UpstreamTarget{selector.target}, healthcheck.WithListener(selector.setHealthy)
+		default:
+			return nil, ErrHealthCheckSelector
+		}
+		p.checker, err = healthcheck.New(config.HealthCheck, targets,
+			healthcheck.WithTransport(transport),
+			listener,
+			healthcheck.WithLogger(p.logger),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create health checker: %w", err)
+		}
+	}
+
+	// Passive health checks wrap the selector with per-target circuit breakers
+	if config.CircuitBreaker != nil && config.CircuitBreaker.Enabled {
+		breakerOptions := []circuitbreaker.Option{circuitbreaker.WithLogger(p.logger)}
+		if p.telemetry != nil {
+			breakerOptions = append(breakerOptions, circuitbreaker.WithMetrics(p.telemetry))
+		}
+		p.breaker, err = circuitbreaker.New(config.CircuitBreaker, p.selector, breakerOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create circuit breaker: %w", err)
+		}
+		p.selector = p.breaker
+	}
+
+	p.handler = &httputil.ReverseProxy{
+		Rewrite: p.rewrite,
+		Transport: &retryTransport{
+			base:         transport,
+			selector:     p.selector,
+			targets:      targets,
+			retries:      config.RetryAttempts,
+			backoff:      config.RetryBackoff,
+			preserveHost: config.PreserveHostHeader,
+		},
+		ErrorHandler: p.handleError,
+	}
+
+	return p, nil
+}
+
+// NewTransport builds an HTTP transport honoring the timeouts and TLS settings of the config
+func NewTransport(config *apidef.ProxyConfig) (*http.Transport, error) {
+	tlsConfig, err := BuildTLSConfig(config.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   config.ConnectTimeout,
+		KeepAlive: defaultKeepAlive,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.ResponseHeaderTimeout = config.ResponseTimeout
+	if config.ConnectTimeout > 0 {
+		transport.TLSHandshakeTimeout = config.ConnectTimeout
+	}
+	if config.IdleTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleTimeout
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+// ServeHTTP implements http.Handler
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.config.RetryAttempts > 0 && isIdempotent(r.Method) && hasBody(r) && r.GetBody == nil {
+		r = bufferBody(r)
+	}
+	p.handler.ServeHTTP(w, r)
+}
+
+// Transport returns the underlying upstream transport
+func (p *Proxy) Transport() *http.Transport {
+	return p.transport
+}
+
+// Selector returns the upstream target selector
+func (p *Proxy) Selector() Selector {
+	return p.selector
+}
+
+// HealthChecker returns the active health checker, or nil when health checks are disabled
+func (p *Proxy) HealthChecker() *healthcheck.Checker {
+	return p.checker
+}
+
+// CircuitBreaker returns the passive health checker, or nil when circuit breaking is disabled
+func (p *Proxy) CircuitBreaker() *circuitbreaker.Selector {
+	return p.breaker
+}
+
+// Start starts background upstream health checks, if configured
+func (p *Proxy) Start(ctx context.Context) error {
+	if p.checker == nil {
+		return nil
+	}
+	return p.checker.Start(ctx)
+}
+
+// Close stops health checks and releases idle upstream connections
+func (p *Proxy) Close() {
+	if p.checker != nil {
+		p.checker.Stop()
+	}
+	if p.breaker != nil {
+		p.breaker.Close()
+	}
+	p.transport.CloseIdleConnections()
+}
+
+// Internal methods
+
+func (p *Proxy) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetXForwarded()
+	for name, value := range p.config.Headers {
+		pr.Out.Header.Set(name, value)
+	}
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	// The client went away, there is nobody to answer
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		p.logger.Debug("Client cancelled upstream request", zap.String("path", r.URL.Path))
+		return
+	}
+
+	status := http.StatusBadGateway
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrNoHealthyTarget), errors.Is(err, circuitbreaker.ErrCircuitOpen):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		status = http.StatusGatewayTimeout
+	}
+
+	p.logger.Warn("Upstream request failed",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status_code", status),
+		zap.Error(err),
+	)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// defaultSelector uses the single target_url when set, otherwise balances
+// across targets with the configured strategy
+func defaultSelector(config *apidef.ProxyConfig) (Selector, error) {
+	if config.TargetURL != "" {
+		return &staticSelector{target: &apidef.UpstreamTarget{ID: "default", URL: config.TargetURL, Weight: 1}}, nil
+	}
+
+	lb, err := balancer.New(config.Targets, config.LoadBalancing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create balancer: %w", err)
+	}
+	return lb, nil
+}
+
+// staticSelector always returns the same target, unless health checks
+// found it down
+type staticSelector struct {
+	target *apidef.UpstreamTarget
+	down   atomic.Bool
+}
+
+func (s *staticSelector) Select(r *http.Request) (*apidef.UpstreamTarget, error) {
+	if s.down.Load() {
+		return nil, ErrNoHealthyTarget
+	}
+	return s.target, nil
+}
+
+func (s *staticSelector) setHealthy(target *apidef.UpstreamTarget, healthy bool) {
+	s.down.Store(!healthy)
+}
+
+func (s *staticSelector) Release(target *apidef.UpstreamTarget, statusCode int, err error) {}
+
+// parseTargets validates every configured target and indexes it by URL
+func parseTargets(config *apidef.ProxyConfig) (map[string]*url.URL, error) {
+	raw := make([]string, 0, len(config.Targets)+1)
+	if config.TargetURL != "" {
+		raw = append(raw, config.TargetURL)
+	}
+	for _, target := range config.Targets {
+		raw = append(raw, target.URL)
+	}
+	if len(raw) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	targets := make(map[string]*url.URL, len(raw))
+	for _, rawURL := range raw {
+		u, err := parseTargetURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		targets[rawURL] = u
+	}
+	return targets, nil
+}
+
+func parseTargetURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, &TargetError{URL: rawURL, Cause: err}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, &TargetError{URL: rawURL, Cause: fmt.Errorf("unsupported scheme %q", u.Scheme)}
+	}
+	if u.Host == "" {
+		return nil, &TargetError{URL: rawURL, Cause: fmt.Errorf("missing host")}
+	}
+	return u, nil
+}
+
+// isIdempotent reports whether requests with the method can be safely retried
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody
+}
+
+// bufferBody makes the request body replayable so the request can be retried.
+// Bodies above maxReplayBodyBytes are left streaming and GetBody stays nil.
+func bufferBody(r *http.Request) *http.Request {
+	prefix, err := io.ReadAll(io.LimitReader(r.Body, maxReplayBodyBytes+1))
+	if err != nil || len(prefix) > maxReplayBodyBytes {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+		return r
+	}
+	r.Body.Close()
+
+	r.Body = io.NopCloser(bytes.NewReader(prefix))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(prefix)), nil
+	}
+	r.ContentLength = int64(len(prefix))
+	return r
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// BuildTLSConfig converts an upstream TLS configuration into a crypto/tls config.
+// Certificates and keys may be given either as PEM content or as file paths.
+func BuildTLSConfig(cfg *apidef.TLSConfig) (*tls.Config, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+
+	if cfg.MinVersion != "" {
+		version, err := ParseTLSVersion(cfg.MinVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_version: %w", err)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.MaxVersion != "" {
+		version, err := ParseTLSVersion(cfg.MaxVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_version: %w", err)
+		}
+		tlsConfig.MaxVersion = version
+	}
+
+	if tlsConfig.MinVersion != 0 && tlsConfig.MaxVersion != 0 && tlsConfig.MinVersion > tlsConfig.MaxVersion {
+		return nil, fmt.Errorf("min_version %s is greater than max_version %s", cfg.MinVersion, cfg.MaxVersion)
+	}
+
+	if cfg.CACert != "" {
+		caPEM, err := loadPEM(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ca_cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("ca_cert contains no valid certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be specified together")
+		}
+		certPEM, err := loadPEM(cfg.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client_cert: %w", err)
+		}
+		keyPEM, err := loadPEM(cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client_key: %w", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client key pair: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// ParseTLSVersion parses versions such as "1.2", "TLS1.2" or "tls13"
+func ParseTLSVersion(version string) (uint16, error) {
+	normalized := strings.ToLower(strings.TrimSpace(version))
+	normalized = strings.TrimPrefix(normalized, "tls")
+	normalized = strings.TrimPrefix(normalized, "v")
+	normalized = strings.ReplaceAll(normalized, "_", ".")
+
+	switch normalized {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version: %s", version)
+	}
+}
+
+// loadPEM returns inline PEM content as-is, otherwise reads it from a file
+func loadPEM(value string) ([]byte, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
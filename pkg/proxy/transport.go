@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+const defaultKeepAlive = 30 * time.Second
+
+// retryTransport selects an upstream target for every attempt and retries
+// idempotent requests on transport errors and gateway-class responses
+type retryTransport struct {
+	base         http.RoundTripper
+	selector     Selector
+	targets      map[string]*url.URL
+	retries      int
+	backoff      time.Duration
+	preserveHost bool
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	maxAttempts := 1
+	if t.retries > 0 && isIdempotent(req.Method) && (!hasBody(req) || req.GetBody != nil) {
+		maxAttempts += t.retries
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			if err := t.wait(req, attempt); err != nil {
+				return nil, err
+			}
+		}
+
+		target, err := t.selector.Select(req)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := t.prepare(req, target, attempt)
+		if err != nil {
+			t.selector.Release(target, 0, err)
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(out)
+		if err != nil {
+			t.selector.Release(target, 0, err)
+			lastErr = &UpstreamError{Target: target.URL, Attempts: attempt, Cause: err}
+			if req.Context().Err() != nil {
+				return nil, lastErr
+			}
+			continue
+		}
+
+		if attempt < maxAttempts && isRetryableStatus(resp.StatusCode) {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			t.selector.Release(target, resp.StatusCode, nil)
+			continue
+		}
+
+		resp.Body = &releaseOnClose{
+			ReadCloser: resp.Body,
+			release: func() {
+				t.selector.Release(target, resp.StatusCode, nil)
+			},
+		}
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+// prepare clones the request and points it at the selected target
+func (t *retryTransport) prepare(req *http.Request, target *apidef.UpstreamTarget, attempt int) (*http.Request, error) {
+	targetURL, ok := t.targets[target.URL]
+	if !ok {
+		var err error
+		if targetURL, err = parseTargetURL(target.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	out := req.Clone(req.Context())
+	out.URL.Scheme = targetURL.Scheme
+	out.URL.Host = targetURL.Host
+	out.URL.Path, out.URL.RawPath = joinURLPath(targetURL, req.URL)
+	if targetURL.RawQuery == "" || req.URL.RawQuery == "" {
+		out.URL.RawQuery = targetURL.RawQuery + req.URL.RawQuery
+	} else {
+		out.URL.RawQuery = targetURL.RawQuery + "&" + req.URL.RawQuery
+	}
+
+	if !t.preserveHost {
+		out.Host = targetURL.Host
+	}
+
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = body
+	}
+
+	return out, nil
+}
+
+// wait sleeps for the exponential backoff of the given attempt
+func (t *retryTransport) wait(req *http.Request, attempt int) error {
+	if t.backoff <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(t.backoff * time.Duration(1<<(attempt-2)))
+	defer timer.Stop()
+
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryableStatus reports whether an upstream response indicates a
+// transient failure worth retrying against another attempt
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseOnClose reports the attempt outcome once the response body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// URL path helpers, mirroring net/http/httputil
+
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
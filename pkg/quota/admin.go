@@ -0,0 +1,64 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// AdminHandler serves the quota admin API:
+//
+//	GET    /quotas/{api_id}             usage of every subject of an API
+//	GET    /quotas/{api_id}/{subject}   usage of one subject
+//	DELETE /quotas/{api_id}/{subject}   reset a subject's usage
+//
+// Mount it behind the admin listener's authentication, using
+// http.StripPrefix when it is not served from the root.
+func (s *Service) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /quotas/{api_id}", func(w http.ResponseWriter, r *http.Request) {
+		usages, err := s.List(r.Context(), r.PathValue("api_id"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		if usages == nil {
+			usages = []*Usage{}
+		}
+		writeJSON(w, http.StatusOK, usages)
+	})
+
+	mux.HandleFunc("GET /quotas/{api_id}/{subject...}", func(w http.ResponseWriter, r *http.Request) {
+		usage, err := s.Get(r.Context(), r.PathValue("api_id"), r.PathValue("subject"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, usage)
+	})
+
+	mux.HandleFunc("DELETE /quotas/{api_id}/{subject...}", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Reset(r.Context(), r.PathValue("api_id"), r.PathValue("subject")); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrUsageNotFound) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,93 @@
+package quota_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+	"github.com/vzahanych/gochoreo/pkg/quota"
+	"github.com/vzahanych/gochoreo/pkg/ratelimit"
+)
+
+// ExamplePeriodBounds shows how quotas renewing on period start are aligned
+func ExamplePeriodBounds() {
+	now := time.Date(2024, time.February, 14, 15, 30, 0, 0, time.UTC) // a Wednesday
+
+	for _, period := range []time.Duration{
+		time.Hour,
+		24 * time.Hour,
+		7 * 24 * time.Hour,
+		30 * 24 * time.Hour,
+		365 * 24 * time.Hour,
+	} {
+		start, end := quota.PeriodBounds(now, period)
+		fmt.Println(start.Format(time.DateTime), "-", end.Format(time.DateTime))
+	}
+
+	// Output:
+	// 2024-02-14 15:00:00 - 2024-02-14 16:00:00
+	// 2024-02-14 00:00:00 - 2024-02-15 00:00:00
+	// 2024-02-12 00:00:00 - 2024-02-19 00:00:00
+	// 2024-02-01 00:00:00 - 2024-03-01 00:00:00
+	// 2024-01-01 00:00:00 - 2025-01-01 00:00:00
+}
+
+// ExampleNewService shows a monthly per-key quota counted in Dragonfly,
+// snapshotted to Postgres and managed through the admin API
+func ExampleNewService() {
+	ctx := context.Background()
+
+	client, err := dragonfly.NewClient(dragonfly.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to dragonfly: %v", err)
+	}
+	defer client.Stop()
+
+	if err := client.Start(ctx); err != nil {
+		log.Fatalf("Failed to start dragonfly client: %v", err)
+	}
+
+	db, err := postgres.New(ctx, postgres.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	defer db.Close()
+
+	service, err := quota.NewService(client, db)
+	if err != nil {
+		log.Fatalf("Failed to create quota service: %v", err)
+	}
+	if err := service.CreateSchema(ctx); err != nil {
+		log.Fatalf("Failed to create quota schema: %v", err)
+	}
+
+	// Recover open periods after Dragonfly lost its data
+	if _, err := service.Restore(ctx); err != nil {
+		log.Fatalf("Failed to restore quota usage: %v", err)
+	}
+	if err := service.Start(ctx); err != nil {
+		log.Fatalf("Failed to start quota snapshots: %v", err)
+	}
+	defer service.Stop()
+
+	enforcer, err := quota.NewEnforcer(service, &apidef.APIDefinition{
+		APIID: "orders",
+		GlobalQuota: &apidef.Quota{
+			Max:                10000,
+			Period:             30 * 24 * time.Hour,
+			RenewOnPeriodStart: true,
+			Per:                ratelimit.PerKey,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create quota enforcer: %v", err)
+	}
+
+	http.Handle("/orders/", enforcer.Middleware(http.NotFoundHandler()))
+	http.Handle("/admin/quotas/", http.StripPrefix("/admin", service.AdminHandler()))
+}
@@ -0,0 +1,90 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/ratelimit"
+)
+
+// Quota response headers
+const (
+	HeaderLimit     = "X-Quota-Limit"
+	HeaderRemaining = "X-Quota-Remaining"
+	HeaderReset     = "X-Quota-Reset"
+)
+
+// Enforcer applies an API definition's GlobalQuota
+type Enforcer struct {
+	service *Service
+	apiID   string
+	quota   *apidef.Quota
+	per     string
+}
+
+// NewEnforcer creates an enforcer for an API definition. Quota.Per accepts
+// the rules of ratelimit.ParsePer and defaults to key.
+func NewEnforcer(service *Service, def *apidef.APIDefinition) (*Enforcer, error) {
+	if service == nil {
+		return nil, fmt.Errorf("quota service cannot be nil")
+	}
+	if def == nil || def.GlobalQuota == nil {
+		return nil, fmt.Errorf("api definition has no quota")
+	}
+	if def.GlobalQuota.Max <= 0 || def.GlobalQuota.Period <= 0 {
+		return nil, ErrInvalidQuota
+	}
+
+	per, err := ratelimit.ParsePer(def.GlobalQuota.Per, ratelimit.PerKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quota: %w", err)
+	}
+
+	return &Enforcer{
+		service: service,
+		apiID:   def.APIID,
+		quota:   def.GlobalQuota,
+		per:     per,
+	}, nil
+}
+
+// Middleware counts requests against the quota, reports the remaining
+// quota in response headers and rejects requests once it is exhausted.
+// Dragonfly failures fail open.
+func (e *Enforcer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		usage, allowed, err := e.service.Consume(r.Context(), e.apiID, ratelimit.Subject(e.per, r), e.quota)
+		if err != nil {
+			e.service.logger.Warn("Quota service unavailable, allowing request",
+				zap.String("api_id", e.apiID),
+				zap.Error(err),
+			)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reset := time.Until(usage.PeriodEnd)
+		h := w.Header()
+		h.Set(HeaderLimit, strconv.FormatInt(usage.Max, 10))
+		h.Set(HeaderRemaining, strconv.FormatInt(usage.Remaining, 10))
+		h.Set(HeaderReset, ratelimit.FormatSeconds(reset))
+
+		if !allowed {
+			h.Set("Retry-After", ratelimit.FormatSeconds(reset))
+			h.Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":      "quota exceeded",
+				"error_code": "QUOTA_EXCEEDED",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
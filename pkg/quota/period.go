@@ -0,0 +1,31 @@
+package quota
+
+import "time"
+
+const day = 24 * time.Hour
+
+// PeriodBounds returns the calendar-aligned period containing now, in UTC.
+// Weekly periods start on Monday, periods of 28 to 31 days follow calendar
+// months and periods of 365 or 366 days follow calendar years; any other
+// period is aligned to multiples of itself, so daily
+// quotas renew at midnight and hourly quotas on the hour.
+func PeriodBounds(now time.Time, period time.Duration) (time.Time, time.Time) {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch {
+	case period == 7*day:
+		offset := (int(now.Weekday()) + 6) % 7 // days since Monday
+		start := midnight.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7)
+	case period >= 28*day && period <= 31*day:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	case period == 365*day || period == 366*day:
+		start := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := now.Truncate(period)
+		return start, start.Add(period)
+	}
+}
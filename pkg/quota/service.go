@@ -0,0 +1,376 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+)
+
+// Service defaults
+const (
+	DefaultKeyPrefix        = "quota:"
+	DefaultSnapshotInterval = time.Minute
+	DefaultRetention        = time.Hour
+	DefaultTable            = "quota_usage"
+)
+
+// Common quota errors
+var (
+	ErrUsageNotFound = errors.New("quota usage not found")
+	ErrInvalidQuota  = errors.New("quota max and period must be greater than 0")
+)
+
+// Usage is the consumption of a quota by one subject in one period
+type Usage struct {
+	APIID       string    `json:"api_id"`
+	Subject     string    `json:"subject"`
+	Used        int64     `json:"used"`
+	Max         int64     `json:"max"`
+	Remaining   int64     `json:"remaining"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	// CountedSince is when Used started counting: the period start, or
+	// the last reset within the period. Billing a period sums the usage
+	// counted since each reset.
+	CountedSince time.Time `json:"counted_since"`
+}
+
+// consumeScript atomically counts a request against a subject's quota.
+// Usage lives in a hash per subject; when a period rolls over the closed
+// period is queued for the snapshotter so no billed usage is lost.
+//
+//	KEYS[1] usage hash, KEYS[2] index set, KEYS[3] closed period list
+//	ARGV[1] max, ARGV[2] period ms, ARGV[3] aligned start ms (0 = rolling),
+//	ARGV[4] aligned end ms, ARGV[5] api id, ARGV[6] subject, ARGV[7] retention ms
+//	returns {allowed, used, start ms, end ms, since ms}
+var consumeScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local aligned_start = tonumber(ARGV[3])
+local aligned_end = tonumber(ARGV[4])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'start', 'end', 'used', 'since')
+local start = tonumber(state[1])
+local finish = tonumber(state[2])
+local used = tonumber(state[3]) or 0
+local since = tonumber(state[4]) or start
+
+local expired
+if aligned_start > 0 then
+  -- Only move forward, so a node with a lagging clock cannot reopen a closed period
+  expired = not start or aligned_start > start
+else
+  expired = not start or now >= finish
+end
+
+if expired then
+  if start and used > 0 then
+    redis.call('RPUSH', KEYS[3], cjson.encode({
+      api = ARGV[5], subject = ARGV[6], start = start, ['end'] = finish, since = since, used = used, max = max
+    }))
+  end
+  if aligned_start > 0 then
+    start = aligned_start
+    finish = aligned_end
+  else
+    start = now
+    finish = now + period
+  end
+  since = start
+  used = 0
+end
+
+if used + 1 > max then
+  return {0, used, start, finish, since}
+end
+
+used = used + 1
+redis.call('HSET', KEYS[1], 'api', ARGV[5], 'subject', ARGV[6], 'max', max,
+  'start', string.format('%d', start), 'end', string.format('%d', finish),
+  'since', string.format('%d', since), 'used', used)
+redis.call('PEXPIREAT', KEYS[1], string.format('%d', finish + tonumber(ARGV[7])))
+redis.call('SADD', KEYS[2], KEYS[1])
+return {1, used, start, finish, since}
+`)
+
+// resetScript zeroes a subject's usage within its current period. The usage
+// counted so far is queued as closed, so it is still billed, and counting
+// restarts under a new since so snapshots of it are kept apart.
+//
+//	KEYS[1] usage hash, KEYS[2] closed period list
+//	returns 1, or 0 when there is no usage
+var resetScript = redis.NewScript(`
+local state = redis.call('HMGET', KEYS[1], 'api', 'subject', 'start', 'end', 'used', 'max', 'since')
+local start = tonumber(state[3])
+if not start then
+  return 0
+end
+local used = tonumber(state[5]) or 0
+local since = tonumber(state[7]) or start
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+if now <= since then
+  now = since + 1
+end
+
+if used > 0 then
+  redis.call('RPUSH', KEYS[2], cjson.encode({
+    api = state[1], subject = state[2], start = start, ['end'] = tonumber(state[4]),
+    since = since, used = used, max = tonumber(state[6])
+  }))
+end
+redis.call('HSET', KEYS[1], 'used', 0, 'since', string.format('%d', now))
+return 1
+`)
+
+// Service tracks quota usage in Dragonfly and snapshots it to Postgres
+type Service struct {
+	client    *dragonfly.Client
+	db        *postgres.Client
+	prefix    string
+	table     string
+	interval  time.Duration
+	retention time.Duration
+	logger    *logger.Logger
+
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// Option allows customization of the service
+type Option func(*Service)
+
+// WithKeyPrefix sets the prefix of the Dragonfly keys
+func WithKeyPrefix(prefix string) Option {
+	return func(s *Service) {
+		s.prefix = prefix
+	}
+}
+
+// WithTable sets the Postgres table holding snapshots
+func WithTable(table string) Option {
+	return func(s *Service) {
+		s.table = table
+	}
+}
+
+// WithSnapshotInterval sets how often usage is written to Postgres
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(s *Service) {
+		s.interval = interval
+	}
+}
+
+// WithRetention sets how long usage stays in Dragonfly after its period
+// ends, which must exceed the snapshot interval
+func WithRetention(retention time.Duration) Option {
+	return func(s *Service) {
+		s.retention = retention
+	}
+}
+
+// WithLogger sets the logger
+func WithLogger(log *logger.Logger) Option {
+	return func(s *Service) {
+		s.logger = log
+	}
+}
+
+// NewService creates a quota service. db may be nil, in which case usage
+// is only kept in Dragonfly.
+func NewService(client *dragonfly.Client, db *postgres.Client, options ...Option) (*Service, error) {
+	if client == nil {
+		return nil, fmt.Errorf("dragonfly client cannot be nil")
+	}
+
+	s := &Service{
+		client:    client,
+		db:        db,
+		prefix:    DefaultKeyPrefix,
+		table:     DefaultTable,
+		interval:  DefaultSnapshotInterval,
+		retention: DefaultRetention,
+		stopCh:    make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	if !postgres.ValidTableName(s.table) {
+		return nil, fmt.Errorf("invalid quota table name: %q", s.table)
+	}
+	if s.retention <= s.interval {
+		return nil, fmt.Errorf("quota retention %s must exceed the snapshot interval %s", s.retention, s.interval)
+	}
+	if s.logger == nil {
+		s.logger = logger.GetGlobalLogger()
+	}
+	s.logger = s.logger.WithComponent("quota")
+
+	return s, nil
+}
+
+// Consume counts one request against a subject's quota and reports
+// whether it is within the quota
+func (s *Service) Consume(ctx context.Context, apiID, subject string, q *apidef.Quota) (*Usage, bool, error) {
+	if q == nil || q.Max <= 0 || q.Period <= 0 {
+		return nil, false, ErrInvalidQuota
+	}
+
+	var alignedStart, alignedEnd int64
+	if q.RenewOnPeriodStart {
+		start, end := PeriodBounds(time.Now(), q.Period)
+		alignedStart, alignedEnd = start.UnixMilli(), end.UnixMilli()
+	}
+
+	result, err := consumeScript.Run(ctx, s.client.Client(),
+		[]string{s.usageKey(apiID, subject), s.indexKey(), s.closedKey()},
+		q.Max, q.Period.Milliseconds(), alignedStart, alignedEnd, apiID, subject, s.retention.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return nil, false, dragonfly.WrapError(err, "failed to consume quota")
+	}
+	if len(result) != 5 {
+		return nil, false, fmt.Errorf("unexpected quota script reply: %v", result)
+	}
+
+	usage := newUsage(apiID, subject, result[1], int64(q.Max), result[2], result[3], result[4])
+	return usage, result[0] == 1, nil
+}
+
+// Get returns the current usage of a subject
+func (s *Service) Get(ctx context.Context, apiID, subject string) (*Usage, error) {
+	usage, err := s.read(ctx, s.usageKey(apiID, subject))
+	if err != nil {
+		return nil, err
+	}
+	if usage == nil || !time.Now().Before(usage.PeriodEnd) {
+		return nil, ErrUsageNotFound
+	}
+	return usage, nil
+}
+
+// List returns the current usage of every subject of an API
+func (s *Service) List(ctx context.Context, apiID string) ([]*Usage, error) {
+	var usages []*Usage
+	now := time.Now()
+	err := s.scanIndex(ctx, func(usage *Usage) {
+		if usage.APIID == apiID && now.Before(usage.PeriodEnd) {
+			usages = append(usages, usage)
+		}
+	})
+	return usages, err
+}
+
+// Reset clears a subject's usage so its quota is fully available again
+// for the rest of the period. The usage counted before the reset is still
+// snapshotted, and Restore does not bring it back.
+func (s *Service) Reset(ctx context.Context, apiID, subject string) error {
+	reset, err := resetScript.Run(ctx, s.client.Client(),
+		[]string{s.usageKey(apiID, subject), s.closedKey()},
+	).Int()
+	if err != nil {
+		return dragonfly.WrapError(err, "failed to reset quota")
+	}
+	if reset == 0 {
+		return ErrUsageNotFound
+	}
+	return nil
+}
+
+// Internal methods
+
+// read loads a usage hash, returning nil when it does not exist
+func (s *Service) read(ctx context.Context, key string) (*Usage, error) {
+	fields, err := s.client.Client().HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to read quota usage")
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	used, _ := strconv.ParseInt(fields["used"], 10, 64)
+	limit, _ := strconv.ParseInt(fields["max"], 10, 64)
+	start, _ := strconv.ParseInt(fields["start"], 10, 64)
+	end, _ := strconv.ParseInt(fields["end"], 10, 64)
+	since, err := strconv.ParseInt(fields["since"], 10, 64)
+	if err != nil {
+		since = start
+	}
+	return newUsage(fields["api"], fields["subject"], used, limit, start, end, since), nil
+}
+
+// scanIndex visits every live usage hash, pruning expired index entries
+func (s *Service) scanIndex(ctx context.Context, visit func(*Usage)) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Client().SScan(ctx, s.indexKey(), cursor, "", 500).Result()
+		if err != nil {
+			return dragonfly.WrapError(err, "failed to scan quota index")
+		}
+
+		for _, key := range keys {
+			usage, err := s.read(ctx, key)
+			if err != nil {
+				return err
+			}
+			if usage == nil {
+				s.client.Client().SRem(ctx, s.indexKey(), key)
+				continue
+			}
+			visit(usage)
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (s *Service) usageKey(apiID, subject string) string {
+	return s.prefix + "usage:" + apiID + ":" + subject
+}
+
+func (s *Service) indexKey() string {
+	return s.prefix + "index"
+}
+
+func (s *Service) closedKey() string {
+	return s.prefix + "closed"
+}
+
+func newUsage(apiID, subject string, used, limit, startMs, endMs, sinceMs int64) *Usage {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &Usage{
+		APIID:       apiID,
+		Subject:     subject,
+		Used:        used,
+		Max:         limit,
+		Remaining:   remaining,
+		PeriodStart: time.UnixMilli(startMs).UTC(),
+		PeriodEnd:   time.UnixMilli(endMs).UTC(),
+
+		CountedSince: time.UnixMilli(sinceMs).UTC(),
+	}
+}
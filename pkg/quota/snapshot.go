@@ -0,0 +1,273 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+)
+
+const snapshotBatchSize = 500
+
+// restoreScript recreates a usage hash from a snapshot unless live usage exists
+//
+//	KEYS[1] usage hash, KEYS[2] index set
+//	ARGV[1] api id, ARGV[2] subject, ARGV[3] max, ARGV[4] start ms,
+//	ARGV[5] end ms, ARGV[6] used, ARGV[7] expire at ms, ARGV[8] since ms
+var restoreScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'api', ARGV[1], 'subject', ARGV[2], 'max', ARGV[3],
+  'start', ARGV[4], 'end', ARGV[5], 'used', ARGV[6], 'since', ARGV[8])
+redis.call('PEXPIREAT', KEYS[1], ARGV[7])
+redis.call('SADD', KEYS[2], KEYS[1])
+return 1
+`)
+
+// closedPeriod is usage queued by the consume script when its period
+// rolled over, or by a reset
+type closedPeriod struct {
+	APIID   string `json:"api"`
+	Subject string `json:"subject"`
+	Start   int64  `json:"start"`
+	End     int64  `json:"end"`
+	Since   int64  `json:"since"`
+	Used    int64  `json:"used"`
+	Max     int64  `json:"max"`
+}
+
+// CreateSchema creates the snapshot table if it does not exist. A period
+// has a row per reset, keyed by counted_since; its billed usage is their sum.
+func (s *Service) CreateSchema(ctx context.Context) error {
+	if s.db == nil {
+		return fmt.Errorf("quota snapshots require a postgres client")
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		api_id       TEXT NOT NULL,
+		subject      TEXT NOT NULL,
+		period_start TIMESTAMPTZ NOT NULL,
+		period_end    TIMESTAMPTZ NOT NULL,
+		counted_since TIMESTAMPTZ NOT NULL,
+		used          BIGINT NOT NULL,
+		quota_max     BIGINT NOT NULL,
+		updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (api_id, subject, period_start, counted_since)
+	)`, s.table)
+
+	if _, err := s.db.Execute(ctx, query); err != nil {
+		return fmt.Errorf("failed to create quota table: %w", err)
+	}
+
+	index := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_period_end_idx ON %s (period_end)`, postgres.UnqualifiedName(s.table), s.table)
+	if _, err := s.db.Execute(ctx, index); err != nil {
+		return fmt.Errorf("failed to create quota index: %w", err)
+	}
+	return nil
+}
+
+// Start snapshots usage to Postgres every snapshot interval until Stop
+func (s *Service) Start(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Snapshot(ctx); err != nil {
+					s.logger.Warn("Failed to snapshot quota usage", zap.Error(err))
+				}
+			case <-s.stopCh:
+				// Persist what was counted since the last tick
+				if err := s.Snapshot(context.Background()); err != nil {
+					s.logger.Warn("Failed to snapshot quota usage on shutdown", zap.Error(err))
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop takes a final snapshot and stops the background snapshotter
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	s.wg.Wait()
+}
+
+// Snapshot writes closed periods and current usage to Postgres
+func (s *Service) Snapshot(ctx context.Context) error {
+	if s.db == nil {
+		return fmt.Errorf("quota snapshots require a postgres client")
+	}
+
+	if err := s.snapshotClosed(ctx); err != nil {
+		return err
+	}
+
+	var live []*Usage
+	if err := s.scanIndex(ctx, func(usage *Usage) {
+		live = append(live, usage)
+	}); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(live); i += snapshotBatchSize {
+		end := min(i+snapshotBatchSize, len(live))
+		if err := s.upsert(ctx, live[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore reloads usage of periods that are still open from Postgres,
+// for example after Dragonfly lost its data. Only the usage counted since
+// the last reset of a period is restored, and live usage is never
+// overwritten.
+func (s *Service) Restore(ctx context.Context) (int, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("quota snapshots require a postgres client")
+	}
+
+	rows, err := s.db.Query(ctx, fmt.Sprintf(
+		`SELECT DISTINCT ON (api_id, subject, period_start)
+			api_id, subject, period_start, period_end, counted_since, used, quota_max
+		FROM %s WHERE period_end > NOW()
+		ORDER BY api_id, subject, period_start, counted_since DESC`,
+		s.table,
+	))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load quota snapshots: %w", err)
+	}
+
+	var usages []*Usage
+	for rows.Next() {
+		usage := &Usage{}
+		if err := rows.Scan(&usage.APIID, &usage.Subject, &usage.PeriodStart, &usage.PeriodEnd, &usage.CountedSince, &usage.Used, &usage.Max); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan quota snapshot: %w", err)
+		}
+		usages = append(usages, usage)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to load quota snapshots: %w", err)
+	}
+
+	restored := 0
+	for _, usage := range usages {
+		created, err := restoreScript.Run(ctx, s.client.Client(),
+			[]string{s.usageKey(usage.APIID, usage.Subject), s.indexKey()},
+			usage.APIID, usage.Subject, usage.Max,
+			usage.PeriodStart.UnixMilli(), usage.PeriodEnd.UnixMilli(), usage.Used,
+			usage.PeriodEnd.Add(s.retention).UnixMilli(), usage.CountedSince.UnixMilli(),
+		).Int()
+		if err != nil {
+			return restored, fmt.Errorf("failed to restore quota usage: %w", err)
+		}
+		restored += created
+	}
+	return restored, nil
+}
+
+// Internal methods
+
+// snapshotClosed drains the closed period queue, requeueing on failure
+func (s *Service) snapshotClosed(ctx context.Context) error {
+	for {
+		entries, err := s.client.Client().LPopCount(ctx, s.closedKey(), snapshotBatchSize).Result()
+		if errors.Is(err, redis.Nil) || (err == nil && len(entries) == 0) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read closed quota periods: %w", err)
+		}
+
+		usages := make([]*Usage, 0, len(entries))
+		for _, entry := range entries {
+			var closed closedPeriod
+			if err := json.Unmarshal([]byte(entry), &closed); err != nil {
+				s.logger.Warn("Dropping malformed closed quota period", zap.String("entry", entry), zap.Error(err))
+				continue
+			}
+			usages = append(usages, newUsage(closed.APIID, closed.Subject, closed.Used, closed.Max, closed.Start, closed.End, since(closed)))
+		}
+
+		if err := s.upsert(ctx, usages); err != nil {
+			values := make([]interface{}, len(entries))
+			for i, entry := range entries {
+				values[i] = entry
+			}
+			if requeueErr := s.client.Client().RPush(ctx, s.closedKey(), values...).Err(); requeueErr != nil {
+				return fmt.Errorf("%w (requeue failed, %d closed periods lost: %v)", err, len(entries), requeueErr)
+			}
+			return err
+		}
+
+		if len(entries) < snapshotBatchSize {
+			return nil
+		}
+	}
+}
+
+// upsert writes usages, never lowering a count recorded since the same reset
+func (s *Service) upsert(ctx context.Context, usages []*Usage) error {
+	if len(usages) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %[1]s (api_id, subject, period_start, period_end, counted_since, used, quota_max, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (api_id, subject, period_start, counted_since) DO UPDATE SET
+			period_end = EXCLUDED.period_end,
+			used = GREATEST(%[1]s.used, EXCLUDED.used),
+			quota_max = EXCLUDED.quota_max,
+			updated_at = NOW()`, s.table)
+
+	batch := s.db.NewBatch()
+	for _, usage := range usages {
+		batch.Queue(query, usage.APIID, usage.Subject, usage.PeriodStart, usage.PeriodEnd, usage.CountedSince, usage.Used, usage.Max)
+	}
+
+	results, err := batch.SendBatch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot quota usage: %w", err)
+	}
+	defer results.Close()
+
+	for range usages {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to snapshot quota usage: %w", err)
+		}
+	}
+	return nil
+}
+
+// since returns when closed usage started counting; entries queued before
+// resets were tracked count from the period start
+func since(closed closedPeriod) int64 {
+	if closed.Since == 0 {
+		return closed.Start
+	}
+	return closed.Since
+}
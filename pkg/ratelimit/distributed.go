@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+)
+
+// DefaultKeyPrefix is the prefix of every key written by the distributed limiters
+const DefaultKeyPrefix = "ratelimit:"
+
+// gcraScript implements the generic cell rate algorithm. Only the
+// theoretical arrival time (TAT) is stored per key, and the server clock
+// is used so gateway nodes with skewed clocks agree.
+//
+//	KEYS[1] bucket key
+//	ARGV[1] burst, ARGV[2] emission interval in microseconds
+//	returns {allowed, remaining, retry_after_us, reset_after_us}
+var gcraScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - burst * interval
+local diff = now - allow_at
+
+if diff < 0 then
+  return {0, 0, -diff, tat - now}
+end
+
+local reset_after = new_tat - now
+redis.call('SET', KEYS[1], string.format('%d', new_tat), 'PX', math.ceil(reset_after / 1000))
+return {1, math.floor(diff / interval), 0, reset_after}
+`)
+
+// slidingWindowScript approximates a sliding window from the counts of the
+// current and previous fixed windows, kept in a single hash so the script
+// only touches its declared key.
+//
+//	KEYS[1] window hash
+//	ARGV[1] limit, ARGV[2] window in milliseconds
+//	returns {allowed, remaining, retry_after_ms, reset_after_ms}
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local current = math.floor(now / window)
+local elapsed = now - current * window
+
+local state = redis.call('HMGET', KEYS[1], 'window', 'current', 'previous')
+local stored = tonumber(state[1])
+local count = tonumber(state[2]) or 0
+local previous = tonumber(state[3]) or 0
+
+if stored ~= current then
+  if stored == current - 1 then
+    previous = count
+  else
+    previous = 0
+  end
+  count = 0
+end
+
+local weight = (window - elapsed) / window
+local estimated = previous * weight + count
+
+if estimated + 1 > limit then
+  local retry = window - elapsed
+  local headroom = limit - count - 1
+  if previous > 0 and headroom >= 0 then
+    retry = math.max(1, math.ceil((window - elapsed) - headroom * window / previous))
+  end
+  return {0, 0, retry, window - elapsed}
+end
+
+count = count + 1
+redis.call('HSET', KEYS[1], 'window', current, 'current', count, 'previous', previous)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {1, math.floor(limit - estimated - 1), 0, window - elapsed}
+`)
+
+// GCRALimiter enforces a limit shared by every gateway node using GCRA,
+// which behaves like a token bucket of Burst tokens refilled at Rate per Period
+type GCRALimiter struct {
+	client   *dragonfly.Client
+	prefix   string
+	burst    int
+	interval time.Duration
+}
+
+// NewGCRALimiter creates a distributed GCRA limiter
+func NewGCRALimiter(config *apidef.RateLimit, client *dragonfly.Client, prefix string) (*GCRALimiter, error) {
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrDragonflyRequired
+	}
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+
+	interval := config.Period / time.Duration(config.Rate)
+	if interval < time.Microsecond {
+		return nil, fmt.Errorf("rate limit of %d per %s is finer than the limiter resolution", config.Rate, config.Period)
+	}
+
+	return &GCRALimiter{
+		client:   client,
+		prefix:   prefix + "gcra:",
+		burst:    burstOf(config),
+		interval: interval,
+	}, nil
+}
+
+// Allow implements Limiter
+func (l *GCRALimiter) Allow(ctx context.Context, key string) (*Decision, error) {
+	result, err := gcraScript.Run(ctx, l.client.Client(), []string{l.prefix + key},
+		l.burst, l.interval.Microseconds()).Int64Slice()
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to evaluate gcra rate limit")
+	}
+	return decisionFrom(result, l.burst, time.Microsecond)
+}
+
+// SlidingWindowLimiter enforces at most Rate requests in any Period,
+// shared by every gateway node. Burst is not used by this algorithm.
+type SlidingWindowLimiter struct {
+	client *dragonfly.Client
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// NewSlidingWindowLimiter creates a distributed sliding window limiter
+func NewSlidingWindowLimiter(config *apidef.RateLimit, client *dragonfly.Client, prefix string) (*SlidingWindowLimiter, error) {
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrDragonflyRequired
+	}
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	if config.Period < time.Millisecond {
+		return nil, fmt.Errorf("rate limit period %s is finer than the limiter resolution", config.Period)
+	}
+
+	return &SlidingWindowLimiter{
+		client: client,
+		prefix: prefix + "sw:",
+		limit:  config.Rate,
+		window: config.Period,
+	}, nil
+}
+
+// Allow implements Limiter
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, key string) (*Decision, error) {
+	result, err := slidingWindowScript.Run(ctx, l.client.Client(), []string{l.prefix + key},
+		l.limit, l.window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return nil, dragonfly.WrapError(err, "failed to evaluate sliding window rate limit")
+	}
+	return decisionFrom(result, l.limit, time.Millisecond)
+}
+
+// decisionFrom converts a {allowed, remaining, retry_after, reset_after} script reply
+func decisionFrom(result []int64, limit int, unit time.Duration) (*Decision, error) {
+	if len(result) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit script reply: %v", result)
+	}
+	return &Decision{
+		Allowed:    result[0] == 1,
+		Limit:      limit,
+		Remaining:  int(result[1]),
+		RetryAfter: time.Duration(result[2]) * unit,
+		ResetAfter: time.Duration(result[3]) * unit,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/ratelimit"
+)
+
+// ExampleEnforcer demonstrates per-key local limits with rate limit headers.
+// Requests rejected by the per-key limit leave the global budget to others.
+func ExampleEnforcer() {
+	enforcer, err := ratelimit.NewEnforcer(&apidef.APIDefinition{
+		APIID: "orders",
+		GlobalRateLimit: &apidef.RateLimit{
+			Rate:     3,
+			Period:   time.Minute,
+			Strategy: ratelimit.StrategyLocal,
+		},
+		PerKeyRateLimit: &apidef.RateLimit{
+			Rate:     2,
+			Period:   time.Minute,
+			Strategy: ratelimit.StrategyLocal,
+		},
+	}, ratelimit.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create enforcer: %v", err)
+	}
+
+	handler := enforcer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(caller string) {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{ID: caller, Method: apidef.AuthAPIKey}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Printf("%s: %d remaining=%s retry-after=%q\n", caller, rec.Code,
+			rec.Header().Get(ratelimit.HeaderRemaining), rec.Header().Get(ratelimit.HeaderRetryAfter))
+	}
+
+	send("alice")
+	send("alice")
+	send("alice")
+	send("bob")
+
+	// Output:
+	// alice: 200 remaining=1 retry-after=""
+	// alice: 200 remaining=0 retry-after=""
+	// alice: 429 remaining=0 retry-after="30"
+	// bob: 200 remaining=0 retry-after=""
+}
+
+// ExampleNewLocalLimiter demonstrates a token bucket with a burst
+func ExampleNewLocalLimiter() {
+	limiter, err := ratelimit.NewLocalLimiter(&apidef.RateLimit{Rate: 10, Period: time.Second, Burst: 3})
+	if err != nil {
+		log.Fatalf("Failed to create limiter: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		decision, _ := limiter.Allow(context.Background(), "client")
+		fmt.Println(decision.Allowed, decision.Remaining)
+	}
+
+	// Output:
+	// true 2
+	// true 1
+	// true 0
+	// false 0
+}
+
+// ExampleNewEnforcer_distributed shows a global limit shared by every gateway node through Dragonfly
+func ExampleNewEnforcer_distributed() {
+	client, err := dragonfly.NewClient(dragonfly.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to dragonfly: %v", err)
+	}
+	defer client.Stop()
+
+	if err := client.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start dragonfly client: %v", err)
+	}
+
+	enforcer, err := ratelimit.NewEnforcer(&apidef.APIDefinition{
+		APIID: "orders",
+		GlobalRateLimit: &apidef.RateLimit{
+			Rate:     1000,
+			Period:   time.Second,
+			Burst:    200,
+			Strategy: ratelimit.StrategyDistributed,
+		},
+		PerKeyRateLimit: &apidef.RateLimit{
+			Rate:     100,
+			Period:   time.Minute,
+			Strategy: ratelimit.StrategySlidingWindow,
+			Per:      ratelimit.PerIP,
+		},
+	}, ratelimit.WithDragonfly(client))
+	if err != nil {
+		log.Fatalf("Failed to create enforcer: %v", err)
+	}
+
+	http.Handle("/orders/", enforcer.Middleware(http.NotFoundHandler()))
+}
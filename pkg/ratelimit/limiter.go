@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+)
+
+// Rate limiting strategies accepted in apidef.RateLimit.Strategy
+const (
+	StrategyLocal         = "local"
+	StrategyDistributed   = "distributed" // GCRA on Dragonfly
+	StrategyGCRA          = "gcra"
+	StrategySlidingWindow = "sliding_window"
+)
+
+// Common rate limiting errors
+var (
+	ErrInvalidRate        = errors.New("rate limit rate must be greater than 0")
+	ErrInvalidPeriod      = errors.New("rate limit period must be greater than 0")
+	ErrDragonflyRequired  = errors.New("distributed rate limiting requires a dragonfly client")
+	ErrUnsupportedPerRule = errors.New("unsupported rate limit key")
+)
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // time until the limit is fully replenished
+	RetryAfter time.Duration // time until the next request may be allowed, when denied
+}
+
+// Limiter decides whether a request identified by key may proceed
+type Limiter interface {
+	Allow(ctx context.Context, key string) (*Decision, error)
+}
+
+// NewLimiter creates the limiter selected by config.Strategy. The client is
+// only required by the distributed strategies.
+func NewLimiter(config *apidef.RateLimit, client *dragonfly.Client) (Limiter, error) {
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(config.Strategy) {
+	case "", StrategyLocal:
+		return NewLocalLimiter(config)
+	case StrategyDistributed, StrategyGCRA:
+		if client == nil {
+			return nil, ErrDragonflyRequired
+		}
+		return NewGCRALimiter(config, client, "")
+	case StrategySlidingWindow:
+		if client == nil {
+			return nil, ErrDragonflyRequired
+		}
+		return NewSlidingWindowLimiter(config, client, "")
+	default:
+		return nil, fmt.Errorf("unsupported rate limit strategy: %s", config.Strategy)
+	}
+}
+
+func validate(config *apidef.RateLimit) error {
+	if config == nil {
+		return fmt.Errorf("rate limit config cannot be nil")
+	}
+	if config.Rate <= 0 {
+		return ErrInvalidRate
+	}
+	if config.Period <= 0 {
+		return ErrInvalidPeriod
+	}
+	return nil
+}
+
+// burstOf returns the bucket size, which defaults to the rate
+func burstOf(config *apidef.RateLimit) int {
+	if config.Burst > 0 {
+		return config.Burst
+	}
+	return config.Rate
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Buckets idle for longer than this, and long enough to have refilled,
+// are dropped by the local limiter
+const localIdleTimeout = 10 * time.Minute
+
+// LocalLimiter is an in-process token bucket per key. Limits are enforced
+// per gateway node.
+type LocalLimiter struct {
+	limit rate.Limit
+	burst int
+	idle  time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewLocalLimiter creates a token bucket limiter refilling Rate tokens per
+// Period with room for Burst tokens
+func NewLocalLimiter(config *apidef.RateLimit) (*LocalLimiter, error) {
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+
+	l := &LocalLimiter{
+		limit:     rate.Limit(float64(config.Rate) / config.Period.Seconds()),
+		burst:     burstOf(config),
+		idle:      localIdleTimeout,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+
+	// Dropping a bucket before it refills would hand out a fresh burst
+	if refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second)); refill > l.idle {
+		l.idle = refill
+	}
+	return l, nil
+}
+
+// Allow implements Limiter
+func (l *LocalLimiter) Allow(_ context.Context, key string) (*Decision, error) {
+	now := time.Now()
+	limiter := l.bucketFor(key, now)
+
+	decision := &Decision{Limit: l.burst}
+
+	reservation := limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		decision.RetryAfter = delay
+	} else {
+		decision.Allowed = true
+	}
+
+	tokens := limiter.TokensAt(now)
+	decision.Remaining = int(math.Max(0, math.Floor(tokens)))
+	decision.ResetAfter = time.Duration((float64(l.burst) - tokens) / float64(l.limit) * float64(time.Second))
+	return decision, nil
+}
+
+// bucketFor returns the key's bucket, sweeping idle buckets periodically
+func (l *LocalLimiter) bucketFor(key string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > localIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > l.idle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
@@ -0,0 +1,256 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/dragonfly"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// Rate limit response headers
+const (
+	HeaderLimit      = "X-RateLimit-Limit"
+	HeaderRemaining  = "X-RateLimit-Remaining"
+	HeaderReset      = "X-RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// Values accepted in apidef.RateLimit.Per and apidef.Quota.Per
+const (
+	PerGlobal = "global"
+	PerIP     = "ip"
+	PerKey    = "key"  // auth.Principal.Key
+	PerUser   = "user" // auth.Principal.ID
+	perHeader = "header:"
+)
+
+var defaultHeaders = []string{HeaderLimit, HeaderRemaining, HeaderReset}
+
+// Enforcer applies an API definition's GlobalRateLimit and PerKeyRateLimit
+type Enforcer struct {
+	apiID  string
+	rules  []*rule
+	logger *logger.Logger
+	client *dragonfly.Client
+}
+
+type rule struct {
+	name    string
+	per     string
+	headers []string
+	limiter Limiter
+}
+
+// Option allows customization of the enforcer
+type Option func(*Enforcer)
+
+// WithDragonfly sets the client used by distributed strategies
+func WithDragonfly(client *dragonfly.Client) Option {
+	return func(e *Enforcer) {
+		e.client = client
+	}
+}
+
+// WithLogger sets the logger used to report limiter failures
+func WithLogger(log *logger.Logger) Option {
+	return func(e *Enforcer) {
+		e.logger = log
+	}
+}
+
+// NewEnforcer creates an enforcer for an API definition. GlobalRateLimit is
+// shared by all callers unless it sets Per; PerKeyRateLimit defaults to
+// one bucket per authenticated principal.
+func NewEnforcer(def *apidef.APIDefinition, options ...Option) (*Enforcer, error) {
+	if def == nil {
+		return nil, fmt.Errorf("api definition cannot be nil")
+	}
+
+	e := &Enforcer{apiID: def.APIID}
+	for _, option := range options {
+		option(e)
+	}
+	if e.logger == nil {
+		e.logger = logger.GetGlobalLogger()
+	}
+	e.logger = e.logger.WithComponent("ratelimit")
+
+	// per_key is checked first so that requests it rejects do not take
+	// tokens from the budget shared with other callers
+	for _, spec := range []struct {
+		name   string
+		config *apidef.RateLimit
+		per    string
+	}{
+		{"per_key", def.PerKeyRateLimit, PerKey},
+		{"global", def.GlobalRateLimit, PerGlobal},
+	} {
+		if spec.config == nil {
+			continue
+		}
+
+		limiter, err := NewLimiter(spec.config, e.client)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s rate limit: %w", spec.name, err)
+		}
+
+		per, err := ParsePer(spec.config.Per, spec.per)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s rate limit: %w", spec.name, err)
+		}
+
+		headers := spec.config.Headers
+		if len(headers) == 0 {
+			headers = defaultHeaders
+		}
+
+		e.rules = append(e.rules, &rule{
+			name:    spec.name,
+			per:     per,
+			headers: headers,
+			limiter: limiter,
+		})
+	}
+
+	return e, nil
+}
+
+// Middleware rejects requests over either limit with 429 Too Many Requests
+func (e *Enforcer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, rule := e.check(r)
+		if decision == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writeHeaders(w.Header(), decision, rule.headers)
+		if !decision.Allowed {
+			w.Header().Set(HeaderRetryAfter, FormatSeconds(decision.RetryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":      "rate limit exceeded",
+				"error_code": "RATE_LIMITED",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ParsePer normalizes a Per rule of a rate limit or quota: global, ip, key,
+// user or header:<name>. An empty rule becomes fallback.
+func ParsePer(per, fallback string) (string, error) {
+	normalized := strings.ToLower(per)
+	switch {
+	case normalized == "":
+		return fallback, nil
+	case normalized == PerGlobal, normalized == PerIP, normalized == PerKey, normalized == PerUser:
+		return normalized, nil
+	case strings.HasPrefix(normalized, perHeader) && len(normalized) > len(perHeader):
+		return perHeader + per[len(perHeader):], nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedPerRule, per)
+	}
+}
+
+// Subject identifies whom a request counts against under a rule returned
+// by ParsePer. Callers lacking what the rule keys on, such as anonymous
+// callers of a key rule, are counted by address.
+func Subject(per string, r *http.Request) string {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	switch {
+	case per == PerGlobal:
+		return PerGlobal
+	case per == PerKey && principal != nil:
+		return "key:" + principal.Key()
+	case per == PerUser && principal != nil:
+		return "user:" + principal.ID
+	case strings.HasPrefix(per, perHeader):
+		if value := r.Header.Get(per[len(perHeader):]); value != "" {
+			return per + ":" + value
+		}
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// ClientIP returns the address of the peer that sent a request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// FormatSeconds renders a duration as whole seconds, rounding up, as
+// reset and Retry-After headers expect
+func FormatSeconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// Check evaluates every rule and returns the decision to report: the first
+// denial, otherwise the allowance with the fewest remaining requests. It
+// returns nil when no rule applies. Limiter failures fail open.
+func (e *Enforcer) Check(r *http.Request) *Decision {
+	decision, _ := e.check(r)
+	return decision
+}
+
+// Internal methods
+
+func (e *Enforcer) check(r *http.Request) (*Decision, *rule) {
+	var reported *Decision
+	var reportedRule *rule
+
+	for _, rule := range e.rules {
+		decision, err := rule.limiter.Allow(r.Context(), e.keyFor(rule, r))
+		if err != nil {
+			e.logger.Warn("Rate limiter unavailable, allowing request",
+				zap.String("api_id", e.apiID),
+				zap.String("rule", rule.name),
+				zap.Error(err),
+			)
+			continue
+		}
+		if !decision.Allowed {
+			return decision, rule
+		}
+		if reported == nil || decision.Remaining < reported.Remaining {
+			reported, reportedRule = decision, rule
+		}
+	}
+	return reported, reportedRule
+}
+
+// keyFor identifies the bucket a request counts against
+func (e *Enforcer) keyFor(rule *rule, r *http.Request) string {
+	return e.apiID + ":" + rule.name + ":" + Subject(rule.per, r)
+}
+
+func writeHeaders(h http.Header, decision *Decision, names []string) {
+	for _, name := range names {
+		switch http.CanonicalHeaderKey(name) {
+		case http.CanonicalHeaderKey(HeaderLimit):
+			h.Set(HeaderLimit, strconv.Itoa(decision.Limit))
+		case http.CanonicalHeaderKey(HeaderRemaining):
+			h.Set(HeaderRemaining, strconv.Itoa(decision.Remaining))
+		case http.CanonicalHeaderKey(HeaderReset):
+			h.Set(HeaderReset, FormatSeconds(decision.ResetAfter))
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Change operations, named after JSON Patch
+const (
+	ChangeAdd     = "add"
+	ChangeRemove  = "remove"
+	ChangeReplace = "replace"
+)
+
+// Change is a difference between two definitions at a JSON pointer into
+// their JSON encoding. Old is unset for additions, New for removals.
+type Change struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// bookkeeping lists the fields every stored revision changes
+var bookkeeping = []string{"revision", "created_at", "updated_at", "created_by", "updated_by"}
+
+// Diff lists the changes from one definition to another, ordered by path.
+// Fields maintained by the repository are ignored. Arrays are compared by
+// index.
+func Diff(from, to *apidef.APIDefinition) ([]Change, error) {
+	older, err := document(from)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := document(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	diff("", older, newer, &changes)
+	return changes, nil
+}
+
+// Internal methods
+
+func document(def *apidef.APIDefinition) (map[string]interface{}, error) {
+	data, err := json.Marshal(def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode api definition: %w", err)
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode api definition: %w", err)
+	}
+	for _, field := range bookkeeping {
+		delete(doc, field)
+	}
+	return doc, nil
+}
+
+func diff(path string, older, newer interface{}, changes *[]Change) {
+	switch o := older.(type) {
+	case map[string]interface{}:
+		if n, ok := newer.(map[string]interface{}); ok {
+			diffObjects(path, o, n, changes)
+			return
+		}
+	case []interface{}:
+		if n, ok := newer.([]interface{}); ok {
+			diffArrays(path, o, n, changes)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(older, newer) {
+		*changes = append(*changes, Change{Op: ChangeReplace, Path: path, Old: older, New: newer})
+	}
+}
+
+func diffObjects(path string, older, newer map[string]interface{}, changes *[]Change) {
+	keys := make([]string, 0, len(older)+len(newer))
+	for key := range older {
+		keys = append(keys, key)
+	}
+	for key := range newer {
+		if _, ok := older[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child := path + "/" + escape(key)
+		o, inOlder := older[key]
+		n, inNewer := newer[key]
+		switch {
+		case !inNewer:
+			*changes = append(*changes, Change{Op: ChangeRemove, Path: child, Old: o})
+		case !inOlder:
+			*changes = append(*changes, Change{Op: ChangeAdd, Path: child, New: n})
+		default:
+			diff(child, o, n, changes)
+		}
+	}
+}
+
+func diffArrays(path string, older, newer []interface{}, changes *[]Change) {
+	for i := 0; i < len(older) || i < len(newer); i++ {
+		child := path + "/" + strconv.Itoa(i)
+		switch {
+		case i >= len(newer):
+			*changes = append(*changes, Change{Op: ChangeRemove, Path: child, Old: older[i]})
+		case i >= len(older):
+			*changes = append(*changes, Change{Op: ChangeAdd, Path: child, New: newer[i]})
+		default:
+			diff(child, older[i], newer[i], changes)
+		}
+	}
+}
+
+// escape escapes a JSON pointer reference token
+func escape(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
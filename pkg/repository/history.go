@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+)
+
+// Operation is the kind of change a history entry records
+type Operation string
+
+// History operations
+const (
+	OperationCreate   Operation = "created"
+	OperationUpdate   Operation = "updated"
+	OperationDelete   Operation = "deleted"
+	OperationRollback Operation = "rolled_back"
+)
+
+// HistoryEntry is a revision of a definition. Deletions record the
+// definition as it was when deleted.
+type HistoryEntry struct {
+	APIID      string                `json:"api_id"`
+	Revision   int64                 `json:"revision"`
+	Operation  Operation             `json:"operation"`
+	Definition *apidef.APIDefinition `json:"definition"`
+	ChangedBy  string                `json:"changed_by"`
+	ChangedAt  time.Time             `json:"changed_at"`
+}
+
+// HistoryOptions pages History
+type HistoryOptions struct {
+	// Limit is the page size, DefaultPageSize when zero
+	Limit int
+	// Before lists revisions older than it, the latest ones when zero
+	Before int64
+}
+
+// History returns the revisions of an API, newest first. The history of
+// deleted APIs is kept.
+func (r *Repository) History(ctx context.Context, apiID string, options HistoryOptions) ([]*HistoryEntry, error) {
+	limit, err := pageSize(options.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT api_id, revision, operation, definition, changed_by, changed_at
+		FROM %s WHERE api_id = $1`, r.history)
+	args := []interface{}{apiID}
+	if options.Before > 0 {
+		args = append(args, options.Before)
+		query += " AND revision < $2"
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY revision DESC LIMIT $%d", len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api definition history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*HistoryEntry
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api definition history: %w", err)
+	}
+	return entries, nil
+}
+
+// GetRevision returns a single revision of an API
+func (r *Repository) GetRevision(ctx context.Context, apiID string, revision int64) (*HistoryEntry, error) {
+	query := fmt.Sprintf(`SELECT api_id, revision, operation, definition, changed_by, changed_at
+		FROM %s WHERE api_id = $1 AND revision = $2`, r.history)
+
+	entry, err := scanEntry(r.db.QueryRow(ctx, query, apiID, revision))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s revision %d", ErrRevisionNotFound, apiID, revision)
+	}
+	return entry, err
+}
+
+// Diff lists the changes between two revisions of an API
+func (r *Repository) Diff(ctx context.Context, apiID string, from, to int64) ([]Change, error) {
+	older, err := r.GetRevision(ctx, apiID, from)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := r.GetRevision(ctx, apiID, to)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(older.Definition, newer.Definition)
+}
+
+// Rollback restores the definition of an API recorded at toRevision as a
+// new revision. expected is the API's current revision, or the revision of
+// its deletion when restoring a deleted API. The restored definition is
+// returned.
+func (r *Repository) Rollback(ctx context.Context, apiID string, toRevision, expected int64, actor string) (*apidef.APIDefinition, error) {
+	var restored *apidef.APIDefinition
+
+	err := r.db.RunInTransaction(ctx, func(tx *postgres.Transaction) error {
+		target, err := r.revision(ctx, tx, apiID, toRevision)
+		if err != nil {
+			return err
+		}
+		if target.Operation == OperationDelete {
+			return fmt.Errorf("%w: %s revision %d is a deletion", ErrRevisionNotFound, apiID, toRevision)
+		}
+
+		def := target.Definition
+		def.UpdatedAt = r.timestamp()
+		def.UpdatedBy = actor
+
+		current, err := r.lock(ctx, tx, apiID)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// Deleted: restore it after its deletion
+			last, err := r.lastRevision(ctx, tx, apiID)
+			if err != nil {
+				return err
+			}
+			if last != expected {
+				return conflict(apiID, last, expected)
+			}
+			def.Revision = last + 1
+			if err := r.insert(ctx, tx, def); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			if current.Revision != expected {
+				return conflict(apiID, current.Revision, expected)
+			}
+			def.Revision = current.Revision + 1
+			def.CreatedAt = current.CreatedAt
+			def.CreatedBy = current.CreatedBy
+			if err := r.update(ctx, tx, def); err != nil {
+				return err
+			}
+		}
+
+		restored = def
+		return r.appendHistory(ctx, tx, def, OperationRollback, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// Internal methods
+
+func (r *Repository) appendHistory(ctx context.Context, tx *postgres.Transaction, def *apidef.APIDefinition, operation Operation, actor string) error {
+	data, err := encode(def)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (api_id, revision, operation, definition, changed_by, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, r.history)
+
+	_, err = tx.Exec(ctx, query, def.APIID, def.Revision, string(operation), data, actor, def.UpdatedAt)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: %s revision %d was already recorded", ErrConflict, def.APIID, def.Revision)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record api definition history: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) revision(ctx context.Context, tx *postgres.Transaction, apiID string, revision int64) (*HistoryEntry, error) {
+	query := fmt.Sprintf(`SELECT api_id, revision, operation, definition, changed_by, changed_at
+		FROM %s WHERE api_id = $1 AND revision = $2`, r.history)
+
+	entry, err := scanEntry(tx.QueryRow(ctx, query, apiID, revision))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s revision %d", ErrRevisionNotFound, apiID, revision)
+	}
+	return entry, err
+}
+
+func scanEntry(row pgx.Row) (*HistoryEntry, error) {
+	entry := &HistoryEntry{}
+	var operation string
+	var data []byte
+
+	err := row.Scan(&entry.APIID, &entry.Revision, &operation, &data, &entry.ChangedBy, &entry.ChangedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan api definition history: %w", err)
+	}
+
+	entry.Operation = Operation(operation)
+	if entry.Definition, err = decode(data); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
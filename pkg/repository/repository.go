@@ -0,0 +1,442 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/postgres"
+)
+
+// DefaultTable is the table holding current definitions; their history is
+// kept in the same name suffixed with _history
+const DefaultTable = "api_definitions"
+
+// Default and largest page sizes of List and History
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Common repository errors
+var (
+	ErrNotFound          = errors.New("api definition not found")
+	ErrAlreadyExists     = errors.New("api definition already exists")
+	ErrConflict          = errors.New("api definition was changed concurrently")
+	ErrRevisionNotFound  = errors.New("api definition revision not found")
+	ErrInvalidDefinition = errors.New("invalid api definition")
+	ErrInvalidTableName  = errors.New("invalid table name")
+)
+
+// Repository stores API definitions in Postgres. Every change is guarded by
+// the definition's Revision and recorded in an append-only history table
+// from which any revision can be diffed or restored.
+type Repository struct {
+	db      *postgres.Client
+	table   string
+	history string
+	now     func() time.Time
+}
+
+// Option allows customization of the repository
+type Option func(*Repository)
+
+// WithTable sets the table of current definitions, optionally schema
+// qualified
+func WithTable(table string) Option {
+	return func(r *Repository) {
+		r.table = table
+	}
+}
+
+// New creates a repository. CreateSchema creates its tables.
+func New(db *postgres.Client, options ...Option) (*Repository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("postgres client cannot be nil")
+	}
+
+	r := &Repository{
+		db:    db,
+		table: DefaultTable,
+		now:   time.Now,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	if !postgres.ValidTableName(r.table) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTableName, r.table)
+	}
+	r.history = r.table + "_history"
+	return r, nil
+}
+
+// CreateSchema creates the definition and history tables if they do not
+// exist. History rows cannot be updated or deleted.
+func (r *Repository) CreateSchema(ctx context.Context) error {
+	name := postgres.UnqualifiedName(r.table)
+	historyName := postgres.UnqualifiedName(r.history)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			api_id     TEXT PRIMARY KEY,
+			org_id     TEXT NOT NULL DEFAULT '',
+			name       TEXT NOT NULL,
+			status     TEXT NOT NULL DEFAULT '',
+			tags       TEXT[] NOT NULL DEFAULT '{}',
+			revision   BIGINT NOT NULL,
+			definition JSONB NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL,
+			created_by TEXT NOT NULL DEFAULT '',
+			updated_by TEXT NOT NULL DEFAULT ''
+		)`, r.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_org_id_idx ON %s (org_id, api_id)`, name, r.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_status_idx ON %s (status)`, name, r.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_tags_idx ON %s USING GIN (tags)`, name, r.table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			api_id     TEXT NOT NULL,
+			revision   BIGINT NOT NULL,
+			operation  TEXT NOT NULL,
+			definition JSONB NOT NULL,
+			changed_by TEXT NOT NULL DEFAULT '',
+			changed_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (api_id, revision)
+		)`, r.history),
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION '%% is append-only', TG_TABLE_NAME;
+		END
+		$$ LANGUAGE plpgsql`, r.history),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS %s_append_only ON %s`, historyName, r.history),
+		fmt.Sprintf(`CREATE TRIGGER %s_append_only BEFORE UPDATE OR DELETE ON %s
+			FOR EACH ROW EXECUTE FUNCTION %s_append_only()`, historyName, r.history, r.history),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS %s_no_truncate ON %s`, historyName, r.history),
+		fmt.Sprintf(`CREATE TRIGGER %s_no_truncate BEFORE TRUNCATE ON %s
+			FOR EACH STATEMENT EXECUTE FUNCTION %s_append_only()`, historyName, r.history, r.history),
+	}
+
+	return r.db.RunInTransaction(ctx, func(tx *postgres.Transaction) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(ctx, statement); err != nil {
+				return fmt.Errorf("failed to create api definition schema: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Create stores a new definition as its first revision, or the revision
+// following its history when a deleted definition is created again. def's
+// Revision, timestamps and authors are set on success.
+func (r *Repository) Create(ctx context.Context, def *apidef.APIDefinition, actor string) error {
+	if err := def.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+
+	stored := *def
+	stored.CreatedAt = r.timestamp()
+	stored.UpdatedAt = stored.CreatedAt
+	stored.CreatedBy = actor
+	stored.UpdatedBy = actor
+
+	err := r.db.RunInTransaction(ctx, func(tx *postgres.Transaction) error {
+		last, err := r.lastRevision(ctx, tx, def.APIID)
+		if err != nil {
+			return err
+		}
+		stored.Revision = last + 1
+
+		if err := r.insert(ctx, tx, &stored); err != nil {
+			return err
+		}
+		return r.appendHistory(ctx, tx, &stored, OperationCreate, actor)
+	})
+	if err != nil {
+		return err
+	}
+
+	*def = stored
+	return nil
+}
+
+// Get returns the current definition of an API
+func (r *Repository) Get(ctx context.Context, apiID string) (*apidef.APIDefinition, error) {
+	query := fmt.Sprintf(`SELECT definition FROM %s WHERE api_id = $1`, r.table)
+
+	var data []byte
+	err := r.db.QueryRow(ctx, query, apiID).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, apiID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api definition: %w", err)
+	}
+	return decode(data)
+}
+
+// Update replaces a definition. def.Revision must be the stored revision,
+// so changes made since def was read are never overwritten; ErrConflict is
+// returned otherwise. def's Revision, UpdatedAt and UpdatedBy are set on
+// success.
+func (r *Repository) Update(ctx context.Context, def *apidef.APIDefinition, actor string) error {
+	if err := def.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+
+	stored := *def
+	stored.UpdatedAt = r.timestamp()
+	stored.UpdatedBy = actor
+
+	err := r.db.RunInTransaction(ctx, func(tx *postgres.Transaction) error {
+		current, err := r.lock(ctx, tx, def.APIID)
+		if err != nil {
+			return err
+		}
+		if current.Revision != def.Revision {
+			return conflict(def.APIID, current.Revision, def.Revision)
+		}
+
+		stored.Revision = current.Revision + 1
+		stored.CreatedAt = current.CreatedAt
+		stored.CreatedBy = current.CreatedBy
+		if err := r.update(ctx, tx, &stored); err != nil {
+			return err
+		}
+		return r.appendHistory(ctx, tx, &stored, OperationUpdate, actor)
+	})
+	if err != nil {
+		return err
+	}
+
+	*def = stored
+	return nil
+}
+
+// Delete removes a definition at the given revision. Its history is kept,
+// so it can be restored with Rollback.
+func (r *Repository) Delete(ctx context.Context, apiID string, revision int64, actor string) error {
+	return r.db.RunInTransaction(ctx, func(tx *postgres.Transaction) error {
+		current, err := r.lock(ctx, tx, apiID)
+		if err != nil {
+			return err
+		}
+		if current.Revision != revision {
+			return conflict(apiID, current.Revision, revision)
+		}
+
+		query := fmt.Sprintf(`DELETE FROM %s WHERE api_id = $1`, r.table)
+		if _, err := tx.Exec(ctx, query, apiID); err != nil {
+			return fmt.Errorf("failed to delete api definition: %w", err)
+		}
+
+		// The deletion is a revision of its own recording the last state
+		current.Revision++
+		current.UpdatedAt = r.timestamp()
+		current.UpdatedBy = actor
+		return r.appendHistory(ctx, tx, current, OperationDelete, actor)
+	})
+}
+
+// ListOptions filters and pages List
+type ListOptions struct {
+	OrgID  string
+	Status apidef.APIStatus
+	// Tags selects definitions carrying every tag listed
+	Tags []string
+	// Limit is the page size, DefaultPageSize when zero
+	Limit int
+	// Cursor continues a listing after the NextCursor of its previous page
+	Cursor string
+}
+
+// ListResult is a page of definitions ordered by APIID
+type ListResult struct {
+	Definitions []*apidef.APIDefinition
+	// NextCursor is set when more definitions follow
+	NextCursor string
+}
+
+// List returns the definitions matching options, one page at a time
+func (r *Repository) List(ctx context.Context, options ListOptions) (*ListResult, error) {
+	limit, err := pageSize(options.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if options.OrgID != "" {
+		where("org_id = $%d", options.OrgID)
+	}
+	if options.Status != "" {
+		where("status = $%d", string(options.Status))
+	}
+	if len(options.Tags) > 0 {
+		where("tags @> $%d::text[]", options.Tags)
+	}
+	if options.Cursor != "" {
+		where("api_id > $%d", options.Cursor)
+	}
+
+	query := fmt.Sprintf(`SELECT definition FROM %s`, r.table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY api_id LIMIT $%d", len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api definitions: %w", err)
+	}
+	defer rows.Close()
+
+	result := &ListResult{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan api definition: %w", err)
+		}
+		def, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		result.Definitions = append(result.Definitions, def)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api definitions: %w", err)
+	}
+
+	if len(result.Definitions) > limit {
+		result.Definitions = result.Definitions[:limit]
+		result.NextCursor = result.Definitions[limit-1].APIID
+	}
+	return result, nil
+}
+
+// Internal methods
+
+// lock reads the current definition of an API and locks its row until the
+// transaction ends
+func (r *Repository) lock(ctx context.Context, tx *postgres.Transaction, apiID string) (*apidef.APIDefinition, error) {
+	query := fmt.Sprintf(`SELECT definition FROM %s WHERE api_id = $1 FOR UPDATE`, r.table)
+
+	var data []byte
+	err := tx.QueryRow(ctx, query, apiID).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, apiID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read api definition: %w", err)
+	}
+	return decode(data)
+}
+
+// lastRevision returns the latest revision in the history of an API, 0 when
+// it has none
+func (r *Repository) lastRevision(ctx context.Context, tx *postgres.Transaction, apiID string) (int64, error) {
+	query := fmt.Sprintf(`SELECT COALESCE(MAX(revision), 0) FROM %s WHERE api_id = $1`, r.history)
+
+	var revision int64
+	if err := tx.QueryRow(ctx, query, apiID).Scan(&revision); err != nil {
+		return 0, fmt.Errorf("failed to read api definition history: %w", err)
+	}
+	return revision, nil
+}
+
+func (r *Repository) insert(ctx context.Context, tx *postgres.Transaction, def *apidef.APIDefinition) error {
+	data, err := encode(def)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s
+		(api_id, org_id, name, status, tags, revision, definition, created_at, updated_at, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, r.table)
+
+	_, err = tx.Exec(ctx, query, def.APIID, def.OrgID, def.Name, string(def.Status), tags(def),
+		def.Revision, data, def.CreatedAt, def.UpdatedAt, def.CreatedBy, def.UpdatedBy)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, def.APIID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert api definition: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) update(ctx context.Context, tx *postgres.Transaction, def *apidef.APIDefinition) error {
+	data, err := encode(def)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET
+		org_id = $2, name = $3, status = $4, tags = $5, revision = $6, definition = $7,
+		updated_at = $8, updated_by = $9
+		WHERE api_id = $1`, r.table)
+
+	_, err = tx.Exec(ctx, query, def.APIID, def.OrgID, def.Name, string(def.Status), tags(def),
+		def.Revision, data, def.UpdatedAt, def.UpdatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to update api definition: %w", err)
+	}
+	return nil
+}
+
+// timestamp returns the current time at the precision Postgres stores
+func (r *Repository) timestamp() time.Time {
+	return r.now().UTC().Truncate(time.Microsecond)
+}
+
+func encode(def *apidef.APIDefinition) ([]byte, error) {
+	data, err := json.Marshal(def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode api definition: %w", err)
+	}
+	return data, nil
+}
+
+func decode(data []byte) (*apidef.APIDefinition, error) {
+	def := &apidef.APIDefinition{}
+	if err := json.Unmarshal(data, def); err != nil {
+		return nil, fmt.Errorf("failed to decode api definition: %w", err)
+	}
+	return def, nil
+}
+
+func conflict(apiID string, current, expected int64) error {
+	return fmt.Errorf("%w: %s is at revision %d, not %d", ErrConflict, apiID, current, expected)
+}
+
+func tags(def *apidef.APIDefinition) []string {
+	if def.Tags == nil {
+		return []string{}
+	}
+	return def.Tags
+}
+
+func pageSize(limit int) (int, error) {
+	switch {
+	case limit == 0:
+		return DefaultPageSize, nil
+	case limit < 0 || limit > MaxPageSize:
+		return 0, fmt.Errorf("page size must be between 1 and %d", MaxPageSize)
+	}
+	return limit, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Common router errors
+var (
+	ErrNilDefinition     = errors.New("api definition cannot be nil")
+	ErrNilHandlerFactory = errors.New("handler factory cannot be nil")
+)
+
+// RouteConflictError is returned when two definitions claim the same domain and listen path
+type RouteConflictError struct {
+	Domain     string
+	ListenPath string
+	Existing   string
+	Conflict   string
+}
+
+func (e *RouteConflictError) Error() string {
+	domain := e.Domain
+	if domain == "" {
+		domain = "*"
+	}
+	return fmt.Sprintf("route conflict on %s%s: api %s already registered, cannot register %s",
+		domain, e.ListenPath, e.Existing, e.Conflict)
+}
+
+// CompileError wraps a failure to build the handler for a definition
+type CompileError struct {
+	APIID string
+	Cause error
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("failed to compile api %s: %v", e.APIID, e.Cause)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Cause
+}
+
+// IsRouteConflict checks if the error is a route conflict error
+func IsRouteConflict(err error) bool {
+	var conflictErr *RouteConflictError
+	return errors.As(err, &conflictErr)
+}
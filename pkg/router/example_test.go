@@ -0,0 +1,144 @@
+package router_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/router"
+)
+
+// echoFactory builds a handler that reports which API served the request
+func echoFactory(def *apidef.APIDefinition) (http.Handler, error) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", def.APIID, r.URL.Path)
+	}), nil
+}
+
+// ExampleRouter demonstrates longest-prefix matching across definitions
+func ExampleRouter() {
+	r, err := router.New(echoFactory)
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+
+	defs := []*apidef.APIDefinition{
+		{APIID: "users", Status: apidef.StatusActive, ListenPath: "/api/users"},
+		{APIID: "api", Status: apidef.StatusActive, ListenPath: "/api", StripListenPath: true},
+		{APIID: "drafts", Status: apidef.StatusDraft, ListenPath: "/api/drafts"},
+	}
+	if err := r.Load(defs); err != nil {
+		log.Fatalf("Failed to load definitions: %v", err)
+	}
+
+	for _, path := range []string{"/api/users/42", "/api/orders", "/api/drafts/1", "/other"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		fmt.Printf("%s -> %d %s\n", path, rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+
+	// Output:
+	// /api/users/42 -> 200 users /api/users/42
+	// /api/orders -> 200 api /orders
+	// /api/drafts/1 -> 200 api /drafts/1
+	// /other -> 404 404 page not found
+}
+
+// ExampleRouter_domains demonstrates domain-bound definitions
+func ExampleRouter_domains() {
+	r, err := router.New(echoFactory)
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+
+	defs := []*apidef.APIDefinition{
+		{APIID: "tenant-a", Status: apidef.StatusActive, Domain: "a.example.com", ListenPath: "/"},
+		{APIID: "tenants", Status: apidef.StatusActive, Domain: "*.example.com", ListenPath: "/"},
+		{APIID: "default", Status: apidef.StatusActive, ListenPath: "/"},
+	}
+	if err := r.Load(defs); err != nil {
+		log.Fatalf("Failed to load definitions: %v", err)
+	}
+
+	for _, host := range []string{"a.example.com:8080", "b.example.com", "example.org"} {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.Host = host
+		route, _ := r.Match(req)
+		fmt.Printf("%s -> %s\n", host, route.Definition.APIID)
+	}
+
+	// Output:
+	// a.example.com:8080 -> tenant-a
+	// b.example.com -> tenants
+	// example.org -> default
+}
+
+// ExampleRouter_conflict demonstrates conflict detection on load
+func ExampleRouter_conflict() {
+	r, err := router.New(echoFactory)
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+
+	err = r.Load([]*apidef.APIDefinition{
+		{APIID: "first", Status: apidef.StatusActive, ListenPath: "/orders/"},
+		{APIID: "second", Status: apidef.StatusActive, ListenPath: "orders"},
+	})
+	fmt.Println(router.IsRouteConflict(err), err)
+
+	// Output:
+	// true route conflict on */orders: api first already registered, cannot register second
+}
+
+// closingHandler reports when the router releases it
+type closingHandler struct {
+	http.Handler
+	apiID    string
+	revision int64
+}
+
+func (h *closingHandler) Close() {
+	fmt.Printf("closed %s@%d\n", h.apiID, h.revision)
+}
+
+// ExampleRouter_Load demonstrates reloads keeping the handlers of unchanged
+// definitions and closing the ones replaced or dropped
+func ExampleRouter_Load() {
+	r, err := router.New(func(def *apidef.APIDefinition) (http.Handler, error) {
+		fmt.Printf("built %s@%d\n", def.APIID, def.Revision)
+		return &closingHandler{Handler: http.NotFoundHandler(), apiID: def.APIID, revision: def.Revision}, nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+
+	load := func(defs ...*apidef.APIDefinition) {
+		if err := r.Load(defs); err != nil {
+			log.Fatalf("Failed to load definitions: %v", err)
+		}
+	}
+	definition := func(apiID string, revision int64) *apidef.APIDefinition {
+		return &apidef.APIDefinition{APIID: apiID, Status: apidef.StatusActive, ListenPath: "/" + apiID, Revision: revision}
+	}
+
+	load(definition("orders", 1), definition("billing", 1))
+	fmt.Println("-- reload")
+	load(definition("orders", 1), definition("billing", 1))
+	fmt.Println("-- update orders")
+	load(definition("orders", 2), definition("billing", 1))
+	fmt.Println("-- delete billing")
+	load(definition("orders", 2))
+
+	// Output:
+	// built orders@1
+	// built billing@1
+	// -- reload
+	// -- update orders
+	// built orders@2
+	// closed orders@1
+	// -- delete billing
+	// closed billing@1
+}
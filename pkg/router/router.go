@@ -0,0 +1,263 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// HandlerFactory builds the handler that serves traffic for a single API definition
+type HandlerFactory func(def *apidef.APIDefinition) (http.Handler, error)
+
+// Route is a compiled API definition bound to a domain and listen path
+type Route struct {
+	Definition *apidef.APIDefinition
+	Domain     string
+	ListenPath string
+	Handler    http.Handler
+}
+
+// Closer is implemented by handlers holding resources, such as a proxy
+// running health checks, that must be released once their definition is
+// replaced or removed
+type Closer interface {
+	Close()
+}
+
+// table is an immutable, compiled routing table
+type table struct {
+	index  *domainIndex
+	routes []*Route
+}
+
+// Router dispatches requests to the API definition whose domain and listen
+// path best match the request. The routing table is swapped atomically on
+// Load, so it is safe to reload definitions while serving traffic.
+type Router struct {
+	factory  HandlerFactory
+	notFound http.Handler
+	table    atomic.Pointer[table]
+	// loadMu orders loads, each building on the previous table
+	loadMu sync.Mutex
+}
+
+// Option allows customization of the router
+type Option func(*Router)
+
+// WithNotFoundHandler sets the handler used when no definition matches
+func WithNotFoundHandler(handler http.Handler) Option {
+	return func(r *Router) {
+		r.notFound = handler
+	}
+}
+
+// New creates a new router that uses factory to build per-definition handlers
+func New(factory HandlerFactory, options ...Option) (*Router, error) {
+	if factory == nil {
+		return nil, ErrNilHandlerFactory
+	}
+
+	r := &Router{
+		factory:  factory,
+		notFound: http.NotFoundHandler(),
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	r.table.Store(&table{index: newDomainIndex()})
+	return r, nil
+}
+
+// Load compiles the given definitions into a new routing table and swaps it
+// in. Inactive and expired definitions are skipped. Handlers of definitions
+// unchanged since the previous load are kept along with their state, such
+// as circuit breakers and rate limits; handlers that are replaced or
+// dropped are closed when they implement Closer. On error the previous
+// table stays in place.
+func (r *Router) Load(defs []*apidef.APIDefinition) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	compiled, retired, err := r.compile(defs, r.table.Load())
+	if err != nil {
+		return err
+	}
+
+	r.table.Store(compiled)
+	for _, route := range retired {
+		closeHandler(route.Handler)
+	}
+	return nil
+}
+
+// Routes returns the currently loaded routes sorted by domain and listen path
+func (r *Router) Routes() []*Route {
+	routes := r.table.Load().routes
+	result := make([]*Route, len(routes))
+	copy(result, routes)
+	return result
+}
+
+// Match returns the route that would serve the request
+func (r *Router) Match(req *http.Request) (*Route, bool) {
+	host := apidef.NormalizeHost(req.Host)
+	for _, route := range r.table.Load().index.lookup(host, req.URL.Path) {
+		// Expiry is time-dependent, so it is checked per request as well
+		if route.Definition.IsExpired() {
+			continue
+		}
+		return route, true
+	}
+	return nil, false
+}
+
+// ServeHTTP implements http.Handler
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	route, ok := r.Match(req)
+	if !ok {
+		r.notFound.ServeHTTP(w, req)
+		return
+	}
+
+	ctx := WithRoute(req.Context(), route)
+	if route.Definition.StripListenPath {
+		req = stripListenPath(req.WithContext(ctx), route.ListenPath)
+	} else {
+		req = req.WithContext(ctx)
+	}
+
+	route.Handler.ServeHTTP(w, req)
+}
+
+// Internal methods
+
+// compile builds a routing table, reusing the handlers of previous routes
+// whose definition is unchanged. It returns the previous routes whose
+// handlers are no longer used. On error the handlers it built are closed.
+func (r *Router) compile(defs []*apidef.APIDefinition, previous *table) (compiled *table, retired []*Route, err error) {
+	compiled = &table{index: newDomainIndex()}
+
+	reusable := make(map[string]*Route, len(previous.routes))
+	for _, route := range previous.routes {
+		reusable[route.Definition.APIID] = route
+	}
+	var built []http.Handler
+	defer func() {
+		if err != nil {
+			for _, handler := range built {
+				closeHandler(handler)
+			}
+		}
+	}()
+
+	for _, def := range defs {
+		if def == nil {
+			return nil, nil, ErrNilDefinition
+		}
+		if !def.IsActive() || def.IsExpired() {
+			continue
+		}
+
+		var handler http.Handler
+		if route, ok := reusable[def.APIID]; ok && unchanged(route.Definition, def) {
+			handler = route.Handler
+			delete(reusable, def.APIID)
+		} else {
+			if handler, err = r.factory(def); err != nil {
+				return nil, nil, &CompileError{APIID: def.APIID, Cause: err}
+			}
+			built = append(built, handler)
+		}
+
+		route := &Route{
+			Definition: def,
+			Domain:     apidef.NormalizeHost(def.Domain),
+			ListenPath: def.GetListenPath(),
+			Handler:    handler,
+		}
+
+		if existing := compiled.index.trieFor(route.Domain).insert(route.ListenPath, route); existing != nil {
+			return nil, nil, &RouteConflictError{
+				Domain:     route.Domain,
+				ListenPath: route.ListenPath,
+				Existing:   existing.Definition.APIID,
+				Conflict:   def.APIID,
+			}
+		}
+		compiled.routes = append(compiled.routes, route)
+	}
+
+	sort.Slice(compiled.routes, func(i, j int) bool {
+		if compiled.routes[i].Domain != compiled.routes[j].Domain {
+			return compiled.routes[i].Domain < compiled.routes[j].Domain
+		}
+		return compiled.routes[i].ListenPath < compiled.routes[j].ListenPath
+	})
+
+	for _, route := range previous.routes {
+		if reusable[route.Definition.APIID] == route {
+			retired = append(retired, route)
+		}
+	}
+	return compiled, retired, nil
+}
+
+// unchanged reports whether def is the definition a route was built from,
+// or the same stored revision of it
+func unchanged(built, def *apidef.APIDefinition) bool {
+	if built == def {
+		return true
+	}
+	return def.Revision != 0 && built.Revision == def.Revision && built.UpdatedAt.Equal(def.UpdatedAt)
+}
+
+func closeHandler(handler http.Handler) {
+	if closer, ok := handler.(Closer); ok {
+		closer.Close()
+	}
+}
+
+// stripListenPath returns a shallow copy of the request with the listen path
+// removed from the URL path
+func stripListenPath(req *http.Request, listenPath string) *http.Request {
+	if listenPath == "/" {
+		return req
+	}
+
+	stripped := req.Clone(req.Context())
+	stripped.URL.Path = trimListenPath(req.URL.Path, listenPath)
+	if req.URL.RawPath != "" {
+		stripped.URL.RawPath = trimListenPath(req.URL.RawPath, listenPath)
+	}
+	return stripped
+}
+
+func trimListenPath(path, listenPath string) string {
+	trimmed := strings.TrimPrefix(path, listenPath)
+	if !strings.HasPrefix(trimmed, "/") {
+		trimmed = "/" + trimmed
+	}
+	return trimmed
+}
+
+// Context helpers
+
+type contextKey struct{}
+
+// WithRoute returns a copy of ctx carrying the matched route
+func WithRoute(ctx context.Context, route *Route) context.Context {
+	return context.WithValue(ctx, contextKey{}, route)
+}
+
+// RouteFromContext returns the route matched for the current request
+func RouteFromContext(ctx context.Context) (*Route, bool) {
+	route, ok := ctx.Value(contextKey{}).(*Route)
+	return route, ok
+}
@@ -0,0 +1,140 @@
+package router
+
+import (
+	"sort"
+	"strings"
+)
+
+// node is a single path segment in the routing trie
+type node struct {
+	children map[string]*node
+	route    *Route
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// insert stores the route under the given listen path and returns the route
+// previously registered there, if any
+func (n *node) insert(listenPath string, route *Route) *Route {
+	current := n
+	for _, segment := range splitPath(listenPath) {
+		child, ok := current.children[segment]
+		if !ok {
+			child = newNode()
+			current.children[segment] = child
+		}
+		current = child
+	}
+
+	if current.route != nil {
+		return current.route
+	}
+	current.route = route
+	return nil
+}
+
+// lookup returns every route whose listen path is a prefix of the request
+// path, ordered from the longest to the shortest listen path
+func (n *node) lookup(requestPath string) []*Route {
+	var matches []*Route
+	if n.route != nil {
+		matches = append(matches, n.route)
+	}
+
+	current := n
+	for _, segment := range splitPath(requestPath) {
+		child, ok := current.children[segment]
+		if !ok {
+			break
+		}
+		current = child
+		if current.route != nil {
+			matches = append(matches, current.route)
+		}
+	}
+
+	// Reverse so the most specific match comes first
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// domainIndex groups path tries by the host they are bound to
+type domainIndex struct {
+	exact     map[string]*node
+	wildcards []wildcardDomain
+	fallback  *node
+}
+
+// wildcardDomain is a trie bound to a "*.example.com" style domain
+type wildcardDomain struct {
+	suffix string // ".example.com"
+	root   *node
+}
+
+func newDomainIndex() *domainIndex {
+	return &domainIndex{
+		exact:    make(map[string]*node),
+		fallback: newNode(),
+	}
+}
+
+// trieFor returns the trie for a normalized domain, creating it if needed
+func (d *domainIndex) trieFor(domain string) *node {
+	if domain == "" {
+		return d.fallback
+	}
+
+	if strings.HasPrefix(domain, "*.") {
+		suffix := domain[1:]
+		for _, wc := range d.wildcards {
+			if wc.suffix == suffix {
+				return wc.root
+			}
+		}
+		root := newNode()
+		d.wildcards = append(d.wildcards, wildcardDomain{suffix: suffix, root: root})
+		// Keep the most specific wildcard first
+		sort.SliceStable(d.wildcards, func(i, j int) bool {
+			return len(d.wildcards[i].suffix) > len(d.wildcards[j].suffix)
+		})
+		return root
+	}
+
+	root, ok := d.exact[domain]
+	if !ok {
+		root = newNode()
+		d.exact[domain] = root
+	}
+	return root
+}
+
+// lookup returns candidate routes for a host and path. Routes bound to the
+// exact host come first, then wildcard domains, then domain-less routes.
+func (d *domainIndex) lookup(host, requestPath string) []*Route {
+	var candidates []*Route
+
+	if root, ok := d.exact[host]; ok {
+		candidates = append(candidates, root.lookup(requestPath)...)
+	}
+
+	for _, wc := range d.wildcards {
+		if strings.HasSuffix(host, wc.suffix) && len(host) > len(wc.suffix) {
+			candidates = append(candidates, wc.root.lookup(requestPath)...)
+		}
+	}
+
+	return append(candidates, d.fallback.lookup(requestPath)...)
+}
+
+// splitPath splits a path into its non-empty segments
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
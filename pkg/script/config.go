@@ -0,0 +1,68 @@
+package script
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default per invocation limits
+const (
+	DefaultTimeout         = 50 * time.Millisecond
+	DefaultMaxBodySize     = 1 << 20
+	DefaultMaxStringSize   = 4 << 20
+	DefaultMaxMemory       = 32 << 20
+	DefaultRegistryMaxSize = 64 * 1024
+	DefaultCallStackSize   = 200
+)
+
+// Config is the Config of script middleware specs. Limits apply to each
+// invocation of a script.
+type Config struct {
+	// Timeout bounds the time a script may run for a request, and again for
+	// its response. Scripts cannot block, so this is their CPU time.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxBodySize is the largest request or response body given to a
+	// script; larger requests are rejected and larger responses are passed
+	// through without running on_response
+	MaxBodySize int `mapstructure:"max_body_size"`
+	// MaxStringSize is the largest string a script builds, or hands back
+	// to the gateway
+	MaxStringSize int `mapstructure:"max_string_size"`
+	// MaxMemory bounds what a script allocates: the strings, tables, table
+	// entries and functions it builds are counted as they are made, garbage
+	// included, so large strings are best built with table.concat
+	MaxMemory int `mapstructure:"max_memory"`
+	// RegistryMaxSize caps the slots of the Lua value stack
+	RegistryMaxSize int `mapstructure:"registry_max_size"`
+	// CallStackSize caps the depth of Lua calls
+	CallStackSize int `mapstructure:"call_stack_size"`
+}
+
+// SetDefaults implements middleware.Defaulter
+func (c *Config) SetDefaults() {
+	c.Timeout = DefaultTimeout
+	c.MaxBodySize = DefaultMaxBodySize
+	c.MaxStringSize = DefaultMaxStringSize
+	c.MaxMemory = DefaultMaxMemory
+	c.RegistryMaxSize = DefaultRegistryMaxSize
+	c.CallStackSize = DefaultCallStackSize
+}
+
+// Validate implements middleware.Validator
+func (c *Config) Validate() error {
+	switch {
+	case c.Timeout <= 0:
+		return fmt.Errorf("timeout must be positive")
+	case c.MaxBodySize <= 0:
+		return fmt.Errorf("max_body_size must be positive")
+	case c.MaxStringSize <= 0:
+		return fmt.Errorf("max_string_size must be positive")
+	case c.MaxMemory <= 0:
+		return fmt.Errorf("max_memory must be positive")
+	case c.RegistryMaxSize < minRegistrySize:
+		return fmt.Errorf("registry_max_size must be at least %d", minRegistrySize)
+	case c.CallStackSize <= 0:
+		return fmt.Errorf("call_stack_size must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package script_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+	"github.com/vzahanych/gochoreo/pkg/router"
+	"github.com/vzahanych/gochoreo/pkg/script"
+)
+
+const ordersScript = `
+function on_request(req)
+  if req.headers["X-Api-Key"] == nil then
+    return {
+      status = 401,
+      headers = {["Content-Type"] = "application/json"},
+      body = json.encode({error = "missing api key"}),
+    }
+  end
+  req.headers["X-Tenant"] = string.upper(req.query.tenant or "none")
+  req.query.tenant = nil
+end
+
+function on_response(resp, req)
+  local body = json.decode(resp.body)
+  body.tenant = req.headers["X-Tenant"]
+  resp.body = json.encode(body)
+  resp.headers["X-Script"] = "orders"
+end
+`
+
+func build(runner *script.Runner, def *apidef.APIDefinition) http.Handler {
+	registry := middleware.NewRegistry()
+	if err := runner.Register(registry); err != nil {
+		log.Fatalf("Failed to register script runner: %v", err)
+	}
+
+	chain, err := registry.Build(def)
+	if err != nil {
+		log.Fatalf("Failed to build middleware chain: %v", err)
+	}
+
+	return chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"path":%q,"query":%q}`, r.URL.Path, r.URL.RawQuery)
+	}))
+}
+
+func definition(source string, config map[string]interface{}) *apidef.APIDefinition {
+	return &apidef.APIDefinition{
+		APIID:     "orders",
+		Version:   "v1",
+		UpdatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Middleware: apidef.MiddlewareConfig{
+			Pre: []apidef.MiddlewareSpec{{
+				Name:       "orders",
+				Type:       middleware.TypeScript,
+				Enabled:    true,
+				Script:     source,
+				ScriptType: "lua",
+				Config:     config,
+			}},
+		},
+	}
+}
+
+func send(handler http.Handler, target string, header http.Header) {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	body, _ := io.ReadAll(w.Body)
+	fmt.Println(w.Code, w.Header().Get("X-Script"), strings.TrimSpace(string(body)))
+}
+
+// ExampleRunner shows a script editing requests and responses and
+// short-circuiting unauthenticated requests
+func ExampleRunner() {
+	runner := script.NewRunner(script.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	handler := build(runner, definition(ordersScript, nil))
+
+	send(handler, "/orders?tenant=acme&page=2", http.Header{"X-Api-Key": {"secret"}})
+	send(handler, "/orders", nil)
+
+	// Output:
+	// 200 orders {"path":"/orders","query":"page=2","tenant":"ACME"}
+	// 401  {"error":"missing api key"}
+}
+
+// ExampleRunner_limits shows scripts stopped by their time, string size and
+// memory limits, and the compiled script cache
+func ExampleRunner_limits() {
+	runner := script.NewRunner(script.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+
+	loop := build(runner, definition(`function on_request(req) while true do end end`, map[string]interface{}{
+		"timeout": "10ms",
+	}))
+	send(loop, "/orders", nil)
+
+	bomb := build(runner, definition(`function on_request(req) req.body = string.rep("x", 1e9) end`, nil))
+	send(bomb, "/orders", nil)
+
+	doubling := build(runner, definition(`function on_request(req) local s = "x" while true do s = s .. s end end`, nil))
+	send(doubling, "/orders", nil)
+
+	growth := build(runner, definition(`function on_request(req) local t = {} while true do t[#t + 1] = {} end end`, map[string]interface{}{
+		"max_memory": 1 << 20,
+	}))
+	send(growth, "/orders", nil)
+
+	// Rebuilding the same definition version reuses its compiled scripts;
+	// a newer revision replaces them, whatever its version
+	def := definition(ordersScript, nil)
+	build(runner, def)
+	build(runner, def)
+	fmt.Println(runner.Len(), "cached scripts")
+	def.Version, def.UpdatedAt = "v2", def.UpdatedAt.Add(time.Hour)
+	latest := build(runner, def)
+	fmt.Println(runner.Len(), "cached script")
+
+	// Closing the handler, as the router does once the definition is
+	// removed, evicts its script
+	latest.(router.Closer).Close()
+	fmt.Println(runner.Len(), "cached scripts")
+
+	// Output:
+	// 500  {"error":"script failed","error_code":"SCRIPT_FAILED"}
+	// 500  {"error":"script failed","error_code":"SCRIPT_FAILED"}
+	// 500  {"error":"script failed","error_code":"SCRIPT_FAILED"}
+	// 500  {"error":"script failed","error_code":"SCRIPT_FAILED"}
+	// 5 cached scripts
+	// 1 cached script
+	// 0 cached scripts
+}
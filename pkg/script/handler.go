@@ -0,0 +1,445 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+)
+
+// Common invocation errors
+var (
+	ErrTimeout      = errors.New("script exceeded its time limit")
+	ErrBodyTooLarge = middleware.ErrBodyTooLarge
+)
+
+// handler runs a compiled script around the next handler. The script's
+// top level runs first, then its global on_request(req) function before
+// next and its on_response(resp, req) function after next, when defined.
+//
+// req has method, path, query, headers and body fields the script may
+// change, and read-only host, remote_addr and principal fields. The body is
+// read when first accessed. on_request short-circuits the request by
+// returning a response table with status, headers and body fields. resp has
+// status, headers and body fields the script may change. Query and header
+// values are strings, or lists of strings when repeated.
+type handler struct {
+	apiID  string
+	name   string
+	runner *Runner
+	script *compiled
+	config *Config
+	logger *logger.Logger
+}
+
+func (h *handler) middleware(next http.Handler) http.Handler {
+	h.runner.acquire(h.script)
+	return &scriptHandler{handler: h, next: next}
+}
+
+// scriptHandler runs a handler's script around next. Closing it releases
+// the compiled script.
+type scriptHandler struct {
+	*handler
+	next http.Handler
+	once sync.Once
+}
+
+// Close implements router.Closer
+func (s *scriptHandler) Close() {
+	s.once.Do(func() {
+		s.runner.release(s.script)
+	})
+}
+
+func (s *scriptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, next := s.handler, s.next
+	L, mem := newState(h.config, h.print)
+	defer L.Close()
+
+	req := h.newRequest(L, r)
+	reply, err := h.onRequest(L, mem, req)
+	if err != nil {
+		h.fail(w, "on_request", err)
+		return
+	}
+	if reply != nil {
+		reply.write(w)
+		return
+	}
+
+	onResponse, ok := L.GetGlobal("on_response").(*lua.LFunction)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	buffer := middleware.NewResponseBuffer(w, int64(h.config.MaxBodySize), func() {
+		h.logger.Warn("Response exceeds the script size limit, streaming it without on_response",
+			zap.String("api_id", h.apiID),
+			zap.String("script", h.name),
+		)
+	})
+	next.ServeHTTP(buffer, r)
+	h.finish(w, buffer, L, mem, onResponse, req)
+}
+
+// onRequest runs the script's top level and on_request, then applies the
+// changes made to req. A non-nil reply short-circuits the request.
+func (h *handler) onRequest(L *lua.LState, mem *memory, req *request) (*reply, error) {
+	ctx, cancel := context.WithTimeout(req.r.Context(), h.config.Timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	mem.reset()
+
+	L.Push(L.NewFunctionFromProto(h.script.proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		return nil, h.scriptError(ctx, err)
+	}
+
+	onRequest, ok := L.GetGlobal("on_request").(*lua.LFunction)
+	if !ok {
+		return nil, nil
+	}
+
+	L.Push(onRequest)
+	L.Push(req.table)
+	if err := L.PCall(1, 1, nil); err != nil {
+		if req.err != nil {
+			return nil, req.err
+		}
+		return nil, h.scriptError(ctx, err)
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+
+	switch result := result.(type) {
+	case *lua.LNilType:
+		return nil, req.apply()
+	case *lua.LTable:
+		return newReply(result, h.config.MaxStringSize)
+	default:
+		return nil, fmt.Errorf("on_request must return nil or a response table, got %s", result.Type())
+	}
+}
+
+// onResponse runs on_response over a buffered response. header is modified
+// in place; the returned status and body replace the original.
+func (h *handler) onResponse(L *lua.LState, mem *memory, function *lua.LFunction, req *request, status int, header http.Header, body []byte) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(req.r.Context(), h.config.Timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	mem.reset()
+
+	// The request body was handed to next, it can no longer be read
+	req.read = true
+
+	resp := L.CreateTable(0, 3)
+	resp.RawSetString("status", lua.LNumber(status))
+	resp.RawSetString("headers", valuesTable(L, header))
+	resp.RawSetString("body", lua.LString(body))
+
+	L.Push(function)
+	L.Push(resp)
+	L.Push(req.table)
+	if err := L.PCall(2, 0, nil); err != nil {
+		return 0, nil, h.scriptError(ctx, err)
+	}
+
+	status, err := statusValue(resp.RawGetString("status"))
+	if err != nil {
+		return 0, nil, err
+	}
+	headers, err := tableValues(resp.RawGetString("headers"), h.config.MaxStringSize)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid response headers: %w", err)
+	}
+	if err := setHeaders(header, headers); err != nil {
+		return 0, nil, err
+	}
+	transformed, err := stringValue(resp.RawGetString("body"), h.config.MaxStringSize)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid response body: %w", err)
+	}
+
+	if len(transformed) != len(body) || header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(len(transformed)))
+	}
+	return status, []byte(transformed), nil
+}
+
+// scriptError reports an interpreter error, telling time limit
+// interruptions apart
+func (h *handler) scriptError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w of %s", ErrTimeout, h.config.Timeout)
+	}
+	return err
+}
+
+func (h *handler) print(message string) {
+	h.logger.Debug("Script output",
+		zap.String("api_id", h.apiID),
+		zap.String("script", h.name),
+		zap.String("output", message),
+	)
+}
+
+// fail logs a script failure and answers without exposing its details
+func (h *handler) fail(w http.ResponseWriter, stage string, err error) {
+	h.logger.Error("Script failed",
+		zap.String("api_id", h.apiID),
+		zap.String("script", h.name),
+		zap.String("stage", stage),
+		zap.Error(err),
+	)
+
+	status, message := http.StatusInternalServerError, "script failed"
+	if errors.Is(err, ErrBodyTooLarge) {
+		status, message = http.StatusRequestEntityTooLarge, err.Error()
+	}
+
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	header.Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":      message,
+		"error_code": "SCRIPT_FAILED",
+	})
+}
+
+// request is the req table given to a script
+type request struct {
+	table  *lua.LTable
+	r      *http.Request
+	config *Config
+	// body is the original body, once read
+	body []byte
+	read bool
+	err  error
+}
+
+func (h *handler) newRequest(L *lua.LState, r *http.Request) *request {
+	req := &request{r: r, config: h.config}
+
+	req.table = L.CreateTable(0, 9)
+	req.table.RawSetString("method", lua.LString(r.Method))
+	req.table.RawSetString("path", lua.LString(r.URL.Path))
+	req.table.RawSetString("query", valuesTable(L, r.URL.Query()))
+	req.table.RawSetString("headers", valuesTable(L, r.Header))
+	req.table.RawSetString("host", lua.LString(r.Host))
+	req.table.RawSetString("remote_addr", lua.LString(r.RemoteAddr))
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		req.table.RawSetString("principal", toLua(L, principal))
+	}
+
+	meta := L.NewTable()
+	L.SetField(meta, "__index", L.NewFunction(req.index))
+	L.SetMetatable(req.table, meta)
+	return req
+}
+
+// index reads the body the first time req.body is accessed
+func (req *request) index(L *lua.LState) int {
+	if L.Get(2) != lua.LString("body") || req.read {
+		L.Push(lua.LNil)
+		return 1
+	}
+
+	req.read = true
+	if req.r.Body != nil && req.r.Body != http.NoBody {
+		body, err := middleware.ReadBody(req.r.Body, int64(req.config.MaxBodySize))
+		req.r.Body.Close()
+		if err != nil {
+			req.err = err
+			L.RaiseError("%v", err)
+		}
+		req.body = body
+	}
+
+	value := lua.LString(req.body)
+	req.table.RawSetString("body", value)
+	L.Push(value)
+	return 1
+}
+
+// apply copies the changes made to the req table to the request
+func (req *request) apply() error {
+	r, limit := req.r, req.config.MaxStringSize
+
+	method, err := stringValue(req.table.RawGetString("method"), limit)
+	if err != nil {
+		return fmt.Errorf("invalid request method: %w", err)
+	}
+	if method == "" {
+		return fmt.Errorf("request method cannot be empty")
+	}
+	if method != r.Method {
+		r.Method = strings.ToUpper(method)
+	}
+
+	path, err := stringValue(req.table.RawGetString("path"), limit)
+	if err != nil {
+		return fmt.Errorf("invalid request path: %w", err)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("request path %q must start with /", path)
+	}
+	if path != r.URL.Path {
+		r.URL.Path = path
+		r.URL.RawPath = ""
+	}
+
+	query, err := tableValues(req.table.RawGetString("query"), limit)
+	if err != nil {
+		return fmt.Errorf("invalid request query: %w", err)
+	}
+	if encoded := url.Values(query).Encode(); encoded != r.URL.Query().Encode() {
+		r.URL.RawQuery = encoded
+	}
+
+	headers, err := tableValues(req.table.RawGetString("headers"), limit)
+	if err != nil {
+		return fmt.Errorf("invalid request headers: %w", err)
+	}
+	if err := setHeaders(r.Header, headers); err != nil {
+		return err
+	}
+
+	value := req.table.RawGetString("body")
+	if value == lua.LNil && !req.read {
+		return nil
+	}
+	body := ""
+	if value != lua.LNil {
+		if body, err = stringValue(value, limit); err != nil {
+			return fmt.Errorf("invalid request body: %w", err)
+		}
+	}
+	if !req.read && r.Body != nil {
+		r.Body.Close()
+	}
+	if req.read && body == string(req.body) {
+		data := req.body
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		return nil
+	}
+
+	data := []byte(body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.Header.Del("Content-Length")
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// reply is a response returned by on_request
+type reply struct {
+	status int
+	header map[string][]string
+	body   string
+}
+
+func newReply(table *lua.LTable, limit int) (*reply, error) {
+	status, err := statusValue(table.RawGetString("status"))
+	if err != nil {
+		return nil, err
+	}
+	header, err := tableValues(table.RawGetString("headers"), limit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response headers: %w", err)
+	}
+	body := ""
+	if value := table.RawGetString("body"); value != lua.LNil {
+		if body, err = stringValue(value, limit); err != nil {
+			return nil, fmt.Errorf("invalid response body: %w", err)
+		}
+	}
+	return &reply{status: status, header: header, body: body}, nil
+}
+
+func (rep *reply) write(w http.ResponseWriter) {
+	header := w.Header()
+	for name, values := range rep.header {
+		header[http.CanonicalHeaderKey(name)] = values
+	}
+	header.Set("Content-Length", strconv.Itoa(len(rep.body)))
+	w.WriteHeader(rep.status)
+	io.WriteString(w, rep.body)
+}
+
+// statusValue reads a response status, 200 when unset
+func statusValue(value lua.LValue) (int, error) {
+	if value == lua.LNil {
+		return http.StatusOK, nil
+	}
+	number, ok := value.(lua.LNumber)
+	if !ok || number < 200 || number > 599 || number != lua.LNumber(int(number)) {
+		return 0, fmt.Errorf("invalid response status %s", value)
+	}
+	return int(number), nil
+}
+
+// setHeaders replaces the contents of header
+func setHeaders(header http.Header, values map[string][]string) error {
+	updated := make(http.Header, len(values))
+	for name, items := range values {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		for _, item := range items {
+			if strings.ContainsAny(item, "\r\n\x00") {
+				return fmt.Errorf("invalid value of header %s", name)
+			}
+		}
+		key := http.CanonicalHeaderKey(name)
+		updated[key] = append(updated[key], items...)
+	}
+
+	for key := range header {
+		if _, ok := updated[key]; !ok {
+			delete(header, key)
+		}
+	}
+	for key, items := range updated {
+		header[key] = items
+	}
+	return nil
+}
+
+// finish runs on_response over a fully buffered response and writes it
+func (h *handler) finish(w http.ResponseWriter, buffer *middleware.ResponseBuffer, L *lua.LState, mem *memory, function *lua.LFunction, req *request) {
+	status, body, ok := buffer.Buffered()
+	if !ok {
+		return
+	}
+
+	status, body, err := h.onResponse(L, mem, function, req, status, w.Header(), body)
+	if err != nil {
+		h.fail(w, "on_response", err)
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
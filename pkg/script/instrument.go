@@ -0,0 +1,227 @@
+package script
+
+import (
+	"strconv"
+
+	"github.com/yuin/gopher-lua/ast"
+)
+
+// Hooks called by instrumented scripts. Their names are not identifiers, so
+// scripts can neither refer to them nor replace them.
+const (
+	hookSandbox = "(sandbox)"
+	hookConcat  = "(concat)"
+	hookTable   = "(table)"
+	hookClosure = "(closure)"
+	hookSet     = "(set)"
+)
+
+// instrument rewrites a parsed chunk so that what it builds is charged to
+// the memory budget of its invocation: concatenations, table constructors
+// and closures become hook calls, and assignments to table fields go
+// through the set hook. The chunk first fetches the hooks into locals,
+// which every function of the script sees as upvalues.
+func instrument(chunk []ast.Stmt) []ast.Stmt {
+	prologue := &ast.LocalAssignStmt{
+		Names: []string{hookConcat, hookTable, hookClosure, hookSet},
+		Exprs: []ast.Expr{&ast.FuncCallExpr{Func: &ast.IdentExpr{Value: hookSandbox}}},
+	}
+	return append([]ast.Stmt{prologue}, stmts(chunk)...)
+}
+
+func stmts(list []ast.Stmt) []ast.Stmt {
+	instrumented := make([]ast.Stmt, 0, len(list))
+	for _, s := range list {
+		instrumented = append(instrumented, stmt(s)...)
+	}
+	return instrumented
+}
+
+func stmt(s ast.Stmt) []ast.Stmt {
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		return assign(s)
+	case *ast.LocalAssignStmt:
+		if len(s.Names) == 1 && len(s.Exprs) == 1 {
+			// local function f is compiled with f already declared so that
+			// it can recurse; wrapping it would break that
+			if function, ok := s.Exprs[0].(*ast.FunctionExpr); ok {
+				function.Stmts = stmts(function.Stmts)
+				return []ast.Stmt{callStmt(hook(s, hookClosure)), s}
+			}
+		}
+		exprs(s.Exprs)
+	case *ast.FuncDefStmt:
+		s.Func.Stmts = stmts(s.Func.Stmts)
+		return []ast.Stmt{callStmt(hook(s, hookClosure)), s}
+	case *ast.FuncCallStmt:
+		call(s.Expr.(*ast.FuncCallExpr))
+	case *ast.DoBlockStmt:
+		s.Stmts = stmts(s.Stmts)
+	case *ast.WhileStmt:
+		s.Condition = expr(s.Condition)
+		s.Stmts = stmts(s.Stmts)
+	case *ast.RepeatStmt:
+		s.Stmts = stmts(s.Stmts)
+		s.Condition = expr(s.Condition)
+	case *ast.IfStmt:
+		s.Condition = expr(s.Condition)
+		s.Then = stmts(s.Then)
+		s.Else = stmts(s.Else)
+	case *ast.NumberForStmt:
+		s.Init = expr(s.Init)
+		s.Limit = expr(s.Limit)
+		if s.Step != nil {
+			s.Step = expr(s.Step)
+		}
+		s.Stmts = stmts(s.Stmts)
+	case *ast.GenericForStmt:
+		exprs(s.Exprs)
+		s.Stmts = stmts(s.Stmts)
+	case *ast.ReturnStmt:
+		exprs(s.Exprs)
+	}
+	return []ast.Stmt{s}
+}
+
+// assign routes assignments to table fields through the set hook. With
+// several targets every table, key and value is evaluated into temporary
+// locals first, as Lua evaluates them all before assigning.
+func assign(s *ast.AssignStmt) []ast.Stmt {
+	exprs(s.Rhs)
+	fields := 0
+	for _, target := range s.Lhs {
+		if field, ok := target.(*ast.AttrGetExpr); ok {
+			field.Object = expr(field.Object)
+			field.Key = expr(field.Key)
+			fields++
+		}
+	}
+	if fields == 0 {
+		return []ast.Stmt{s}
+	}
+	if len(s.Lhs) == 1 && len(s.Rhs) == 1 {
+		field := s.Lhs[0].(*ast.AttrGetExpr)
+		return []ast.Stmt{callStmt(hook(s, hookSet, field.Object, field.Key, s.Rhs[0]))}
+	}
+
+	temp := func(i int) string { return "(assign " + strconv.Itoa(i) + ")" }
+	evaluate := &ast.LocalAssignStmt{}
+	for _, target := range s.Lhs {
+		if field, ok := target.(*ast.AttrGetExpr); ok {
+			evaluate.Names = append(evaluate.Names, temp(len(evaluate.Names)), temp(len(evaluate.Names)+1))
+			evaluate.Exprs = append(evaluate.Exprs, field.Object, field.Key)
+		}
+	}
+	values := len(evaluate.Names)
+	for i := range s.Lhs {
+		evaluate.Names = append(evaluate.Names, temp(values+i))
+	}
+	evaluate.Exprs = append(evaluate.Exprs, s.Rhs...)
+	evaluate.SetLine(s.Line())
+
+	block := &ast.DoBlockStmt{Stmts: []ast.Stmt{evaluate}}
+	next := 0
+	for i, target := range s.Lhs {
+		value := &ast.IdentExpr{Value: temp(values + i)}
+		if _, ok := target.(*ast.AttrGetExpr); ok {
+			object, key := &ast.IdentExpr{Value: temp(next)}, &ast.IdentExpr{Value: temp(next + 1)}
+			next += 2
+			block.Stmts = append(block.Stmts, callStmt(hook(s, hookSet, object, key, value)))
+			continue
+		}
+		block.Stmts = append(block.Stmts, &ast.AssignStmt{Lhs: []ast.Expr{target}, Rhs: []ast.Expr{value}})
+	}
+	return []ast.Stmt{block}
+}
+
+func exprs(list []ast.Expr) {
+	for i := range list {
+		list[i] = expr(list[i])
+	}
+}
+
+func expr(e ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.StringConcatOpExpr:
+		return hook(e, hookConcat, operands(e, nil)...)
+	case *ast.TableExpr:
+		for _, field := range e.Fields {
+			if field.Key != nil {
+				field.Key = expr(field.Key)
+			}
+			field.Value = expr(field.Value)
+		}
+		return hook(e, hookTable, e)
+	case *ast.FunctionExpr:
+		e.Stmts = stmts(e.Stmts)
+		return hook(e, hookClosure, e)
+	case *ast.FuncCallExpr:
+		call(e)
+	case *ast.AttrGetExpr:
+		e.Object = expr(e.Object)
+		e.Key = expr(e.Key)
+	case *ast.LogicalOpExpr:
+		e.Lhs = expr(e.Lhs)
+		e.Rhs = expr(e.Rhs)
+	case *ast.RelationalOpExpr:
+		e.Lhs = expr(e.Lhs)
+		e.Rhs = expr(e.Rhs)
+	case *ast.ArithmeticOpExpr:
+		e.Lhs = expr(e.Lhs)
+		e.Rhs = expr(e.Rhs)
+	case *ast.UnaryMinusOpExpr:
+		e.Expr = expr(e.Expr)
+	case *ast.UnaryNotOpExpr:
+		e.Expr = expr(e.Expr)
+	case *ast.UnaryLenOpExpr:
+		e.Expr = expr(e.Expr)
+	}
+	return e
+}
+
+func call(e *ast.FuncCallExpr) {
+	if e.Func != nil {
+		e.Func = expr(e.Func)
+	}
+	if e.Receiver != nil {
+		e.Receiver = expr(e.Receiver)
+	}
+	exprs(e.Args)
+}
+
+// operands flattens a chain of concatenations, a .. b .. c, into its
+// operands in evaluation order
+func operands(e ast.Expr, list []ast.Expr) []ast.Expr {
+	if concat, ok := e.(*ast.StringConcatOpExpr); ok {
+		list = operands(concat.Lhs, list)
+		return operands(concat.Rhs, list)
+	}
+	return append(list, expr(e))
+}
+
+// hook calls a hook with single valued arguments, as operands and
+// assigned values are
+func hook(at ast.PositionHolder, name string, args ...ast.Expr) *ast.FuncCallExpr {
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case *ast.FuncCallExpr:
+			arg.AdjustRet = true
+		case *ast.Comma3Expr:
+			arg.AdjustRet = true
+		}
+	}
+	function := &ast.IdentExpr{Value: name}
+	function.SetLine(at.Line())
+	e := &ast.FuncCallExpr{Func: function, Args: args, AdjustRet: true}
+	e.SetLine(at.Line())
+	e.SetLastLine(at.LastLine())
+	return e
+}
+
+func callStmt(e *ast.FuncCallExpr) *ast.FuncCallStmt {
+	s := &ast.FuncCallStmt{Expr: e}
+	s.SetLine(e.Line())
+	s.SetLastLine(e.LastLine())
+	return s
+}
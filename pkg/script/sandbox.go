@@ -0,0 +1,628 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/pm"
+)
+
+// minRegistrySize is the initial size of the Lua value stack
+const minRegistrySize = 1024
+
+// maxDepth bounds the nesting of tables converted to and from Go values
+const maxDepth = 64
+
+// unsafeBaseFuncs are removed from the base library: they load code, reach
+// the file system or change other functions' environments
+var unsafeBaseFuncs = []string{
+	"collectgarbage", "dofile", "getfenv", "load", "loadfile", "loadstring",
+	"module", "newproxy", "print", "_printregs", "require", "setfenv",
+}
+
+// Approximate sizes charged for the values scripts build, besides the bytes
+// of their strings. Entries keyed by numbers mostly land in the array part
+// of tables; other keys cost several map entries.
+const (
+	tableCost   = 128
+	slotCost    = 96
+	fieldCost   = 320
+	closureCost = 128
+)
+
+// memory is the allocation budget of an invocation. The interpreter has no
+// allocation hooks, so scripts are instrumented when compiled to charge the
+// strings, tables, table entries and closures they build, and the library
+// functions building strings or tables charge their results. Allocations
+// are counted as they are made, garbage included; the working memory of a
+// single library call, bounded by the string size limit, is not.
+type memory struct {
+	used  int
+	limit int
+}
+
+func (m *memory) charge(L *lua.LState, size int) {
+	m.used += size
+	if m.used > m.limit {
+		L.RaiseError("memory limit of %d bytes exceeded", m.limit)
+	}
+}
+
+// reset starts the budget of a new invocation
+func (m *memory) reset() {
+	m.used = 0
+}
+
+// newState creates a Lua state with the base, table, string and math
+// libraries, a json table and the limits of config. It returns the memory
+// budget scripts compiled by instrument are charged to.
+func newState(config *Config, print func(message string)) (*lua.LState, *memory) {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:     true,
+		CallStackSize:    config.CallStackSize,
+		RegistrySize:     minRegistrySize,
+		RegistryMaxSize:  config.RegistryMaxSize,
+		RegistryGrowStep: 32,
+	})
+	mem := &memory{limit: config.MaxMemory}
+
+	for name, open := range map[string]lua.LGFunction{
+		lua.BaseLibName:   lua.OpenBase,
+		lua.TabLibName:    lua.OpenTable,
+		lua.StringLibName: lua.OpenString,
+		lua.MathLibName:   lua.OpenMath,
+	} {
+		L.Push(L.NewFunction(open))
+		L.Push(lua.LString(name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeBaseFuncs {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	limit := config.MaxStringSize
+	checkSize := func(L *lua.LState, size int) {
+		if size > limit {
+			L.RaiseError("string size limit of %d bytes exceeded", limit)
+		}
+	}
+	// charged wraps a library function, charging the strings it returns
+	charged := func(fn lua.LValue) *lua.LFunction {
+		return L.NewFunction(func(L *lua.LState) int {
+			top := L.GetTop()
+			L.CallByParam(lua.P{Fn: fn, NRet: lua.MultRet}, args(L)...)
+			for i := top + 1; i <= L.GetTop(); i++ {
+				if s, ok := L.Get(i).(lua.LString); ok {
+					mem.charge(L, len(s))
+				}
+			}
+			return L.GetTop() - top
+		})
+	}
+
+	L.SetGlobal(hookSandbox, L.NewFunction(func(L *lua.LState) int {
+		// Only the prologue of the chunk may fetch the hooks
+		L.SetGlobal(hookSandbox, lua.LNil)
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			L.Push(concat(L, mem, checkSize))
+			return 1
+		}))
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			table := L.CheckTable(1)
+			mem.charge(L, tableCost+entriesCost(table))
+			L.Push(table)
+			return 1
+		}))
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			mem.charge(L, closureCost)
+			return L.GetTop()
+		}))
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			object, key, value := L.Get(1), L.Get(2), L.Get(3)
+			if table, ok := object.(*lua.LTable); ok && value != lua.LNil && table.RawGet(key) == lua.LNil {
+				mem.charge(L, entryCost(key))
+			}
+			L.SetTable(object, key, value)
+			return 0
+		}))
+		return 4
+	}))
+
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int {
+		parts := make([]string, L.GetTop())
+		size := 0
+		for i := range parts {
+			parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+			size += len(parts[i]) + 1
+			checkSize(L, size)
+		}
+		print(strings.Join(parts, "\t"))
+		return 0
+	}))
+	rawset := L.GetGlobal("rawset")
+	L.SetGlobal("rawset", L.NewFunction(func(L *lua.LState) int {
+		table := L.CheckTable(1)
+		if L.Get(3) != lua.LNil && table.RawGet(L.Get(2)) == lua.LNil {
+			mem.charge(L, entryCost(L.Get(2)))
+		}
+		L.CallByParam(lua.P{Fn: rawset, NRet: 1}, args(L)...)
+		return 1
+	}))
+
+	stringLib := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	for _, name := range []string{"char", "lower", "reverse", "upper"} {
+		L.SetField(stringLib, name, charged(L.GetField(stringLib, name)))
+	}
+	L.SetField(stringLib, "rep", L.NewFunction(func(L *lua.LState) int {
+		s := L.CheckString(1)
+		n := L.CheckInt(2)
+		if n <= 0 {
+			L.Push(lua.LString(""))
+			return 1
+		}
+		if len(s) > 0 && n > limit/len(s) {
+			checkSize(L, limit+1)
+		}
+		mem.charge(L, len(s)*n)
+		L.Push(lua.LString(strings.Repeat(s, n)))
+		return 1
+	}))
+	format := charged(L.GetField(stringLib, "format"))
+	L.SetField(stringLib, "format", L.NewFunction(func(L *lua.LState) int {
+		size, err := formatSize(L.CheckString(1), args(L)[1:])
+		if err != nil {
+			L.RaiseError("%v", err)
+		}
+		checkSize(L, size)
+		L.CallByParam(lua.P{Fn: format, NRet: 1}, args(L)...)
+		return 1
+	}))
+	gsub := charged(L.GetField(stringLib, "gsub"))
+	L.SetField(stringLib, "gsub", L.NewFunction(func(L *lua.LState) int {
+		s := L.CheckString(1)
+		switch repl := L.Get(3).(type) {
+		case lua.LString:
+			matches, err := pm.Find(L.CheckString(2), []byte(s), 0, L.OptInt(4, -1))
+			if err != nil {
+				L.RaiseError("%v", err)
+			}
+			checkSize(L, gsubSize(s, string(repl), matches))
+		case *lua.LTable, *lua.LFunction:
+			// Replacements are only known once made: bound them as they are
+			size := len(s)
+			L.Replace(3, L.NewFunction(func(L *lua.LState) int {
+				var value lua.LValue
+				if table, ok := repl.(*lua.LTable); ok {
+					value = L.GetTable(table, L.Get(1))
+				} else {
+					L.CallByParam(lua.P{Fn: repl, NRet: 1}, args(L)...)
+					value = L.Get(-1)
+				}
+				if lua.LVCanConvToString(value) {
+					size += len(lua.LVAsString(value))
+					checkSize(L, size)
+				}
+				L.Push(value)
+				return 1
+			}))
+		}
+		L.CallByParam(lua.P{Fn: gsub, NRet: 2}, args(L)...)
+		return 2
+	}))
+
+	tableLib := L.GetGlobal(lua.TabLibName).(*lua.LTable)
+	concat := L.GetField(tableLib, "concat")
+	L.SetField(tableLib, "concat", L.NewFunction(func(L *lua.LState) int {
+		table := L.CheckTable(1)
+		sep := len(L.OptString(2, ""))
+		size := 0
+		for i := 1; i <= table.Len(); i++ {
+			size += len(lua.LVAsString(table.RawGetInt(i))) + sep
+			checkSize(L, size-sep)
+		}
+		mem.charge(L, size)
+
+		L.CallByParam(lua.P{Fn: concat, NRet: 1}, args(L)...)
+		return 1
+	}))
+	insert := L.GetField(tableLib, "insert")
+	L.SetField(tableLib, "insert", L.NewFunction(func(L *lua.LState) int {
+		mem.charge(L, slotCost)
+		L.CallByParam(lua.P{Fn: insert, NRet: 0}, args(L)...)
+		return 0
+	}))
+
+	jsonLib := L.NewTable()
+	L.SetField(jsonLib, "encode", L.NewFunction(func(L *lua.LState) int {
+		value, err := fromLua(L.CheckAny(1), 0)
+		if err != nil {
+			L.RaiseError("json.encode: %v", err)
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			L.RaiseError("json.encode: %v", err)
+		}
+		checkSize(L, len(data))
+		mem.charge(L, len(data))
+		L.Push(lua.LString(data))
+		return 1
+	}))
+	L.SetField(jsonLib, "decode", L.NewFunction(func(L *lua.LState) int {
+		var value interface{}
+		if err := json.Unmarshal([]byte(L.CheckString(1)), &value); err != nil {
+			L.RaiseError("json.decode: %v", err)
+		}
+		mem.charge(L, decodedSize(value))
+		L.Push(toLua(L, value))
+		return 1
+	}))
+	L.SetGlobal("json", jsonLib)
+
+	return L, mem
+}
+
+// entryCost is the memory charged for a new table entry
+func entryCost(key lua.LValue) int {
+	if _, ok := key.(lua.LNumber); ok {
+		return slotCost
+	}
+	return fieldCost
+}
+
+// entriesCost is the memory charged for the entries of a new table
+func entriesCost(table *lua.LTable) int {
+	cost := 0
+	table.ForEach(func(key, _ lua.LValue) { cost += entryCost(key) })
+	return cost
+}
+
+// args returns the arguments of the running Go function
+func args(L *lua.LState) []lua.LValue {
+	values := make([]lua.LValue, L.GetTop())
+	for i := range values {
+		values[i] = L.Get(i + 1)
+	}
+	return values
+}
+
+// concat implements the .. operator of instrumented scripts over the
+// arguments of the running Go function, folding them right to left as the
+// interpreter does. Runs of strings and numbers are joined at once; other
+// operands need a __concat metamethod.
+func concat(L *lua.LState, mem *memory, checkSize func(*lua.LState, int)) lua.LValue {
+	i := L.GetTop()
+	rhs := L.Get(i)
+	for i--; i >= 1; {
+		lhs := L.Get(i)
+		if !lua.LVCanConvToString(lhs) || !lua.LVCanConvToString(rhs) {
+			op := L.GetMetaField(lhs, "__concat")
+			if op == lua.LNil {
+				op = L.GetMetaField(rhs, "__concat")
+			}
+			if op.Type() != lua.LTFunction {
+				L.RaiseError("cannot perform concat operation between %v and %v", lhs.Type(), rhs.Type())
+			}
+			L.CallByParam(lua.P{Fn: op, NRet: 1}, lhs, rhs)
+			rhs = L.Get(-1)
+			L.Pop(1)
+			i--
+			continue
+		}
+
+		last, size := i, len(lua.LVAsString(rhs))
+		for ; i >= 1 && lua.LVCanConvToString(L.Get(i)); i-- {
+			size += len(lua.LVAsString(L.Get(i)))
+		}
+		checkSize(L, size)
+		mem.charge(L, size)
+
+		var b strings.Builder
+		b.Grow(size)
+		for j := i + 1; j <= last; j++ {
+			b.WriteString(lua.LVAsString(L.Get(j)))
+		}
+		b.WriteString(lua.LVAsString(rhs))
+		rhs = lua.LString(b.String())
+	}
+	return rhs
+}
+
+// formatSize bounds the length of string.format's result. The format is
+// handed to fmt, so widths and precisions are limited to two digits as in
+// Lua, and argument indexes, * widths and verbs dumping tables are refused.
+func formatSize(format string, args []lua.LValue) (int, error) {
+	size := len(format)
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i++; i < len(format) && format[i] == '%' {
+			continue
+		}
+		start := i
+		for i < len(format) && !isLetter(format[i]) {
+			i++
+		}
+		spec := format[start:i]
+		if strings.ContainsAny(spec, "[*") || i == len(format) {
+			return 0, fmt.Errorf("invalid format %q", "%"+format[start:i])
+		}
+		width := 0
+		for _, digits := range strings.FieldsFunc(strings.TrimLeft(spec, "-+ #0"), isNotDigit) {
+			if len(digits) > 2 {
+				return 0, fmt.Errorf("invalid format %q: width or precision too long", "%"+format[start:i+1])
+			}
+			n, _ := strconv.Atoi(digits)
+			width += n
+		}
+
+		verb := format[i]
+		var arg lua.LValue = lua.LNil
+		if len(args) > 0 {
+			arg, args = args[0], args[1:]
+		}
+		switch arg := arg.(type) {
+		case lua.LString:
+			if verb == 'q' || verb == 'x' || verb == 'X' {
+				// Escaped or hex encoded bytes take up to 4 bytes each
+				size += width + 4*len(arg)
+			} else {
+				size += width + len(arg)
+			}
+		case lua.LNumber, lua.LBool, *lua.LNilType:
+			size += width + 64
+		default:
+			if (verb != 's' && verb != 'v') || strings.Contains(spec, "#") {
+				return 0, fmt.Errorf("invalid format %q for a %s", "%"+format[start:i+1], arg.Type())
+			}
+			size += width + 64
+		}
+	}
+	return size, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNotDigit(r rune) bool {
+	return r < '0' || r > '9'
+}
+
+// gsubSize bounds the length of string.gsub's result with a string
+// replacement: each match is replaced by the literal part of repl and the
+// captures it references, none longer than the match
+func gsubSize(s, repl string, matches []*pm.MatchData) int {
+	literal, refs := 0, 0
+	for i := 0; i < len(repl); i++ {
+		if repl[i] == '%' && i+1 < len(repl) && repl[i+1] >= '0' && repl[i+1] <= '9' {
+			refs++
+			i++
+			continue
+		}
+		literal++
+	}
+
+	size := len(s)
+	for _, match := range matches {
+		// Position captures are numbers
+		size += literal + refs*max(match.Capture(1)-match.Capture(0), 20)
+	}
+	return size
+}
+
+// decodedSize is the memory charged for a decoded JSON value
+func decodedSize(value interface{}) int {
+	switch v := value.(type) {
+	case string:
+		return len(v)
+	case []interface{}:
+		size := tableCost
+		for _, item := range v {
+			size += slotCost + decodedSize(item)
+		}
+		return size
+	case map[string]interface{}:
+		size := tableCost
+		for key, item := range v {
+			size += fieldCost + len(key) + decodedSize(item)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// toLua converts a JSON-like Go value
+func toLua(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case json.Number:
+		n, _ := v.Float64()
+		return lua.LNumber(n)
+	case []string:
+		table := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			table.Append(lua.LString(item))
+		}
+		return table
+	case []interface{}:
+		table := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			table.Append(toLua(L, item))
+		}
+		return table
+	case map[string]string:
+		table := L.CreateTable(0, len(v))
+		for key, item := range v {
+			table.RawSetString(key, lua.LString(item))
+		}
+		return table
+	case map[string]interface{}:
+		table := L.CreateTable(0, len(v))
+		for key, item := range v {
+			table.RawSetString(key, toLua(L, item))
+		}
+		return table
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return lua.LString(fmt.Sprint(v))
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return lua.LString(data)
+		}
+		return toLua(L, generic)
+	}
+}
+
+// fromLua converts a Lua value to a JSON-like Go value. Tables whose keys
+// are exactly 1..n become slices; empty tables become objects.
+func fromLua(value lua.LValue, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("tables nested deeper than %d levels", maxDepth)
+	}
+
+	switch v := value.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && n == tableSize(v) {
+			items := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				item, err := fromLua(v.RawGetInt(i), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		}
+
+		object := make(map[string]interface{})
+		var err error
+		v.ForEach(func(key, item lua.LValue) {
+			if err != nil {
+				return
+			}
+			var converted interface{}
+			if converted, err = fromLua(item, depth+1); err == nil {
+				object[key.String()] = converted
+			}
+		})
+		return object, err
+	default:
+		return nil, fmt.Errorf("cannot convert %s", value.Type())
+	}
+}
+
+func tableSize(table *lua.LTable) int {
+	n := 0
+	table.ForEach(func(lua.LValue, lua.LValue) { n++ })
+	return n
+}
+
+// stringValue returns a string or number handed back by a script
+func stringValue(value lua.LValue, limit int) (string, error) {
+	switch v := value.(type) {
+	case lua.LString:
+		if len(v) > limit {
+			return "", fmt.Errorf("string size limit of %d bytes exceeded", limit)
+		}
+		return string(v), nil
+	case lua.LNumber:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("expected a string, got %s", value.Type())
+	}
+}
+
+// stringsValue returns a string, or a list of strings, handed back by a
+// script
+func stringsValue(value lua.LValue, limit int) ([]string, error) {
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		s, err := stringValue(value, limit)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+
+	values := make([]string, 0, table.Len())
+	for i := 1; i <= table.Len(); i++ {
+		s, err := stringValue(table.RawGetInt(i), limit)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+	}
+	return values, nil
+}
+
+// valuesTable exposes a multi-valued map: single values as strings and
+// repeated ones as lists
+func valuesTable(L *lua.LState, values map[string][]string) *lua.LTable {
+	table := L.CreateTable(0, len(values))
+	for name, items := range values {
+		switch len(items) {
+		case 0:
+		case 1:
+			table.RawSetString(name, lua.LString(items[0]))
+		default:
+			table.RawSetString(name, toLua(L, items))
+		}
+	}
+	return table
+}
+
+// tableValues reads back a table built by valuesTable
+func tableValues(value lua.LValue, limit int) (map[string][]string, error) {
+	if value == lua.LNil {
+		return map[string][]string{}, nil
+	}
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("expected a table, got %s", value.Type())
+	}
+
+	raw := make(map[string]lua.LValue)
+	var keys []string
+	table.ForEach(func(key, item lua.LValue) {
+		raw[key.String()] = item
+		keys = append(keys, key.String())
+	})
+	sort.Strings(keys)
+
+	values := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		items, err := stringsValue(raw[key], limit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strconv.Quote(key), err)
+		}
+		values[key] = items
+	}
+	return values, nil
+}
@@ -0,0 +1,215 @@
+package script
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+)
+
+// LanguageLua is the only apidef.MiddlewareSpec.ScriptType supported, and
+// the default when none is set
+const LanguageLua = "lua"
+
+// Common script errors
+var (
+	ErrUnsupportedLanguage = errors.New("unsupported script language")
+	ErrEmptyScript         = errors.New("script is empty")
+)
+
+// Runner builds middlewares from script specs. Each request runs in a
+// fresh sandboxed interpreter; compiled scripts are cached per API
+// definition version and shared between requests. A compiled script is
+// evicted once a newer revision of its definition is built, or once every
+// handler using it is closed, as the router closes the handlers of
+// replaced and removed definitions.
+type Runner struct {
+	mu      sync.Mutex
+	scripts map[cacheKey]*compiled
+	logger  *logger.Logger
+}
+
+// cacheKey identifies a compiled script of an API definition version
+type cacheKey struct {
+	apiID   string
+	version string
+	hash    string
+}
+
+type compiled struct {
+	key   cacheKey
+	proto *lua.FunctionProto
+	// updatedAt is the UpdatedAt of the latest definition using the script
+	updatedAt time.Time
+	// refs counts the open handlers running the script
+	refs int
+}
+
+// Option allows customization of the runner
+type Option func(*Runner)
+
+// WithLogger sets the logger used to report script failures and output
+func WithLogger(log *logger.Logger) Option {
+	return func(r *Runner) {
+		r.logger = log
+	}
+}
+
+// NewRunner creates a runner with an empty script cache
+func NewRunner(options ...Option) *Runner {
+	r := &Runner{scripts: make(map[cacheKey]*compiled)}
+	for _, option := range options {
+		option(r)
+	}
+	if r.logger == nil {
+		r.logger = logger.GetGlobalLogger()
+	}
+	r.logger = r.logger.WithComponent("script")
+	return r
+}
+
+// Register makes the runner the factory of script specs in registry
+func (r *Runner) Register(registry *middleware.Registry) error {
+	return registry.RegisterType(middleware.TypeScript, r.Factory)
+}
+
+// Factory implements middleware.Factory. spec.Script holds Lua source, or
+// the path of a .lua file. The spec's Config is decoded into a Config.
+func (r *Runner) Factory(def *apidef.APIDefinition, spec *apidef.MiddlewareSpec) (middleware.Middleware, error) {
+	if language := strings.ToLower(spec.ScriptType); language != "" && language != LanguageLua {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedLanguage, spec.ScriptType)
+	}
+
+	config := &Config{}
+	if err := middleware.Decode(spec.Config, config); err != nil {
+		return nil, err
+	}
+
+	name, source, err := loadSource(spec)
+	if err != nil {
+		return nil, err
+	}
+	script, err := r.compile(def, name, source)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &handler{
+		apiID:  def.APIID,
+		name:   name,
+		runner: r,
+		script: script,
+		config: config,
+		logger: r.logger,
+	}
+	return h.middleware, nil
+}
+
+// Len returns the number of cached compiled scripts
+func (r *Runner) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.scripts)
+}
+
+// Evict drops the compiled scripts of an API, such as after it is deleted
+func (r *Runner) Evict(apiID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.scripts {
+		if key.apiID == apiID {
+			delete(r.scripts, key)
+		}
+	}
+}
+
+// Internal methods
+
+// compile returns the cached compiled script or compiles it. Scripts left
+// behind by an older revision of the definition, of any version, are
+// dropped.
+func (r *Runner) compile(def *apidef.APIDefinition, name, source string) (*compiled, error) {
+	sum := sha256.Sum256([]byte(source))
+	key := cacheKey{apiID: def.APIID, version: def.Version, hash: hex.EncodeToString(sum[:])}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	script, ok := r.scripts[key]
+	if !ok {
+		chunk, err := parse.Parse(strings.NewReader(source), name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse script: %w", err)
+		}
+		proto, err := lua.Compile(instrument(chunk), name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile script: %w", err)
+		}
+		script = &compiled{key: key, proto: proto}
+		r.scripts[key] = script
+	}
+	if def.UpdatedAt.After(script.updatedAt) {
+		script.updatedAt = def.UpdatedAt
+	}
+
+	for other, cached := range r.scripts {
+		if other.apiID == key.apiID && cached.updatedAt.Before(def.UpdatedAt) {
+			delete(r.scripts, other)
+		}
+	}
+	return script, nil
+}
+
+// acquire counts a handler running a script
+func (r *Runner) acquire(script *compiled) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	script.refs++
+}
+
+// release ends a handler's use of a script, evicting the script when no
+// open handler runs it
+func (r *Runner) release(script *compiled) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	script.refs--
+	if script.refs == 0 && r.scripts[script.key] == script {
+		delete(r.scripts, script.key)
+	}
+}
+
+// loadSource returns the chunk name and source of a spec. A single line
+// ending in .lua is read as a file.
+func loadSource(spec *apidef.MiddlewareSpec) (string, string, error) {
+	script := strings.TrimSpace(spec.Script)
+	if script == "" {
+		return "", "", ErrEmptyScript
+	}
+
+	if strings.HasSuffix(script, ".lua") && !strings.ContainsAny(script, "\n\r") {
+		data, err := os.ReadFile(script)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read script: %w", err)
+		}
+		return script, string(data), nil
+	}
+
+	name := spec.Name
+	if name == "" {
+		name = "script"
+	}
+	return name, spec.Script, nil
+}
@@ -0,0 +1,230 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+)
+
+// HeaderForwardedFor is read for the client address behind trusted proxies
+const HeaderForwardedFor = "X-Forwarded-For"
+
+// Decision is the outcome of evaluating every policy against a request
+type Decision struct {
+	Allowed  bool
+	ClientIP netip.Addr
+	// PolicyID and Reason identify the policy that denied the request
+	PolicyID string
+	Reason   string
+}
+
+// Engine evaluates an API definition's enabled SecurityPolicies in
+// priority order, highest Priority first. The first policy that denies a
+// request decides; a terminal whitelist match allows it immediately.
+type Engine struct {
+	apiID    string
+	policies []compiledPolicy
+	trusted  []netip.Prefix
+	geo      *GeoDatabase
+	opened   []*GeoDatabase
+	logger   *logger.Logger
+}
+
+type compiledPolicy struct {
+	id string
+	policy
+}
+
+// Option allows customization of the engine
+type Option func(*Engine)
+
+// WithTrustedProxies sets the proxies whose X-Forwarded-For entries are
+// believed. Without trusted proxies the connection address is the client.
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(e *Engine) {
+		e.trusted = append(e.trusted, prefixes...)
+	}
+}
+
+// WithGeoDatabase sets the database shared by geo restriction policies that
+// do not name their own
+func WithGeoDatabase(db *GeoDatabase) Option {
+	return func(e *Engine) {
+		e.geo = db
+	}
+}
+
+// WithLogger sets the logger used to record deny decisions
+func WithLogger(log *logger.Logger) Option {
+	return func(e *Engine) {
+		e.logger = log
+	}
+}
+
+// New compiles the enabled security policies of an API definition
+func New(def *apidef.APIDefinition, options ...Option) (*Engine, error) {
+	if def == nil {
+		return nil, fmt.Errorf("api definition cannot be nil")
+	}
+
+	e := &Engine{apiID: def.APIID}
+	for _, option := range options {
+		option(e)
+	}
+	if e.logger == nil {
+		e.logger = logger.GetGlobalLogger()
+	}
+	e.logger = e.logger.WithComponent("security")
+
+	specs := make([]*apidef.SecurityPolicy, 0, len(def.SecurityPolicies))
+	for i := range def.SecurityPolicies {
+		if def.SecurityPolicies[i].Enabled {
+			specs = append(specs, &def.SecurityPolicies[i])
+		}
+	}
+	sort.SliceStable(specs, func(i, j int) bool {
+		return specs[i].Priority > specs[j].Priority
+	})
+
+	for _, spec := range specs {
+		p, err := e.compile(spec)
+		if err != nil {
+			e.Close()
+			return nil, fmt.Errorf("security policy %s: %w", policyID(spec), err)
+		}
+		e.policies = append(e.policies, compiledPolicy{id: policyID(spec), policy: p})
+	}
+
+	return e, nil
+}
+
+// Evaluate runs the policies against a request
+func (e *Engine) Evaluate(r *http.Request) *Decision {
+	client := e.ClientIP(r)
+	decision := &Decision{Allowed: true, ClientIP: client}
+	if len(e.policies) == 0 {
+		return decision
+	}
+
+	if !client.IsValid() {
+		decision.Allowed = false
+		decision.Reason = fmt.Sprintf("client address %q cannot be parsed", r.RemoteAddr)
+		return decision
+	}
+
+	for _, p := range e.policies {
+		switch verdict, reason := p.evaluate(client); verdict {
+		case verdictAllow:
+			return decision
+		case verdictDeny:
+			decision.Allowed = false
+			decision.PolicyID = p.id
+			decision.Reason = reason
+			return decision
+		}
+	}
+	return decision
+}
+
+// Middleware rejects requests denied by a policy with 403 Forbidden and
+// logs the reason, which is not disclosed to the client
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	if len(e.policies) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision := e.Evaluate(r)
+		if decision.Allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		e.logger.Warn("Request denied by security policy",
+			zap.String("api_id", e.apiID),
+			zap.String("policy_id", decision.PolicyID),
+			zap.String("client_ip", decision.ClientIP.String()),
+			zap.String("reason", decision.Reason),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":      "access denied",
+			"error_code": "ACCESS_DENIED",
+		})
+	})
+}
+
+// ClientIP returns the address of the client. When the connection comes
+// from a trusted proxy, X-Forwarded-For is walked from the right and the
+// first untrusted address is the client.
+func (e *Engine) ClientIP(r *http.Request) netip.Addr {
+	remote := parseAddr(r.RemoteAddr)
+	if !remote.IsValid() || !containsAddr(e.trusted, remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values(HeaderForwardedFor) {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr := parseAddr(strings.TrimSpace(hops[i]))
+		if !addr.IsValid() {
+			// A malformed entry cannot be attributed; stop at the last good hop
+			break
+		}
+		client = addr
+		if !containsAddr(e.trusted, addr) {
+			break
+		}
+	}
+	return client
+}
+
+// Close releases geo databases opened for the engine's policies
+func (e *Engine) Close() error {
+	var errs []error
+	for _, db := range e.opened {
+		errs = append(errs, db.Close())
+	}
+	e.opened = nil
+	return errors.Join(errs...)
+}
+
+// Internal methods
+
+func policyID(spec *apidef.SecurityPolicy) string {
+	if spec.ID != "" {
+		return spec.ID
+	}
+	if spec.Name != "" {
+		return spec.Name
+	}
+	return spec.Type
+}
+
+// parseAddr parses an address with or without a port
+func parseAddr(value string) netip.Addr {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap().WithZone("")
+}
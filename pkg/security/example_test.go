@@ -0,0 +1,104 @@
+package security_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/security"
+)
+
+// ExampleEngine demonstrates priority ordered IP policies behind a trusted
+// load balancer
+func ExampleEngine() {
+	engine, err := security.New(&apidef.APIDefinition{
+		APIID: "orders",
+		SecurityPolicies: []apidef.SecurityPolicy{
+			{
+				ID:       "partners",
+				Type:     security.PolicyIPWhitelist,
+				Enabled:  true,
+				Priority: 10,
+				Config:   map[string]interface{}{"cidrs": []string{"203.0.113.0/24", "198.51.100.7"}},
+			},
+			{
+				ID:       "abusers",
+				Type:     security.PolicyIPBlacklist,
+				Enabled:  true,
+				Priority: 20,
+				Config:   map[string]interface{}{"cidrs": []string{"203.0.113.66"}},
+			},
+			{
+				ID:     "legacy",
+				Type:   security.PolicyIPBlacklist,
+				Config: map[string]interface{}{"cidrs": []string{"0.0.0.0/0"}},
+			},
+		},
+	},
+		security.WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8")),
+		security.WithLogger(&logger.Logger{Logger: zap.NewNop()}),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create security engine: %v", err)
+	}
+
+	for _, tc := range []struct{ remote, forwardedFor string }{
+		{"10.0.0.5:4711", "203.0.113.10"},
+		{"10.0.0.5:4711", "203.0.113.66"},
+		{"10.0.0.5:4711", "203.0.113.10, 192.0.2.1"},
+		{"192.0.2.1:4711", "203.0.113.10"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set(security.HeaderForwardedFor, tc.forwardedFor)
+
+		decision := engine.Evaluate(req)
+		fmt.Println(strings.TrimSpace(fmt.Sprintln(decision.ClientIP, decision.Allowed, decision.PolicyID, decision.Reason)))
+	}
+
+	// Output:
+	// 203.0.113.10 true
+	// 203.0.113.66 false abusers client ip 203.0.113.66 is blacklisted
+	// 192.0.2.1 false partners client ip 192.0.2.1 is not whitelisted
+	// 192.0.2.1 false partners client ip 192.0.2.1 is not whitelisted
+}
+
+// ExampleOpenGeoDatabase shows a geo restriction sharing one database across APIs
+func ExampleOpenGeoDatabase() {
+	db, err := security.OpenGeoDatabase("/var/lib/GeoIP/GeoLite2-Country.mmdb")
+	if err != nil {
+		log.Fatalf("Failed to open geo database: %v", err)
+	}
+	defer db.Close()
+
+	engine, err := security.New(&apidef.APIDefinition{
+		APIID: "payments",
+		SecurityPolicies: []apidef.SecurityPolicy{
+			{
+				ID:       "office",
+				Type:     security.PolicyIPWhitelist,
+				Enabled:  true,
+				Priority: 100,
+				Config:   map[string]interface{}{"cidrs": []string{"198.51.100.0/24"}, "terminal": true},
+			},
+			{
+				ID:      "eu-only",
+				Type:    security.PolicyGeoRestriction,
+				Enabled: true,
+				Config:  map[string]interface{}{"allow_countries": []string{"DE", "FR", "NL"}},
+			},
+		},
+	}, security.WithGeoDatabase(db))
+	if err != nil {
+		log.Fatalf("Failed to create security engine: %v", err)
+	}
+
+	http.Handle("/payments/", engine.Middleware(http.NotFoundHandler()))
+}
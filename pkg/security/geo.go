@@ -0,0 +1,53 @@
+package security
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoDatabase resolves client addresses to countries from a local
+// MaxMind-format (GeoIP2/GeoLite2 Country or City) database file
+type GeoDatabase struct {
+	reader *maxminddb.Reader
+	path   string
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// OpenGeoDatabase opens a MaxMind-format database file
+func OpenGeoDatabase(path string) (*GeoDatabase, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geo database %s: %w", path, err)
+	}
+	return &GeoDatabase{reader: reader, path: path}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country an address is
+// located in, falling back to the country it is registered in. It returns
+// an empty string when the database does not know the address.
+func (d *GeoDatabase) Country(addr netip.Addr) (string, error) {
+	var record countryRecord
+	if err := d.reader.Lookup(net.IP(addr.AsSlice()), &record); err != nil {
+		return "", fmt.Errorf("failed to look up %s in %s: %w", addr, d.path, err)
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	return record.RegisteredCountry.ISOCode, nil
+}
+
+// Close releases the database file
+func (d *GeoDatabase) Close() error {
+	return d.reader.Close()
+}
@@ -0,0 +1,211 @@
+package security
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+)
+
+// Policy types accepted in apidef.SecurityPolicy.Type
+const (
+	PolicyIPWhitelist    = "ip_whitelist"
+	PolicyIPBlacklist    = "ip_blacklist"
+	PolicyGeoRestriction = "geo_restriction"
+)
+
+// verdict is the outcome of a single policy
+type verdict int
+
+const (
+	verdictContinue verdict = iota
+	verdictAllow
+	verdictDeny
+)
+
+// policy is a compiled apidef.SecurityPolicy
+type policy interface {
+	evaluate(client netip.Addr) (verdict, string)
+}
+
+// IPListConfig is the Config of ip_whitelist and ip_blacklist policies
+type IPListConfig struct {
+	// CIDRs lists networks and single addresses
+	CIDRs []string `mapstructure:"cidrs"`
+	// Terminal turns a whitelist into a bypass list: listed addresses are
+	// allowed without evaluating lower priority policies and other
+	// addresses fall through to them instead of being denied
+	Terminal bool `mapstructure:"terminal"`
+}
+
+// GeoConfig is the Config of geo_restriction policies. Countries are ISO
+// 3166-1 alpha-2 codes; when AllowCountries is set every other country is
+// denied.
+type GeoConfig struct {
+	// Database is the path of a MaxMind-format country database, not
+	// needed when the engine was given one
+	Database       string   `mapstructure:"database"`
+	AllowCountries []string `mapstructure:"allow_countries"`
+	DenyCountries  []string `mapstructure:"deny_countries"`
+	// AllowUnknown lets addresses missing from the database through
+	AllowUnknown bool `mapstructure:"allow_unknown"`
+}
+
+type ipListPolicy struct {
+	allow    bool
+	prefixes []netip.Prefix
+	terminal bool
+}
+
+func (p *ipListPolicy) evaluate(client netip.Addr) (verdict, string) {
+	matched := containsAddr(p.prefixes, client)
+	switch {
+	case p.allow && p.terminal:
+		if matched {
+			return verdictAllow, ""
+		}
+	case p.allow && !matched:
+		return verdictDeny, fmt.Sprintf("client ip %s is not whitelisted", client)
+	case !p.allow && matched:
+		return verdictDeny, fmt.Sprintf("client ip %s is blacklisted", client)
+	}
+	return verdictContinue, ""
+}
+
+type geoPolicy struct {
+	db           *GeoDatabase
+	allow        []string
+	deny         []string
+	allowUnknown bool
+}
+
+func (p *geoPolicy) evaluate(client netip.Addr) (verdict, string) {
+	country, err := p.db.Country(client)
+	if err != nil || country == "" {
+		if p.allowUnknown {
+			return verdictContinue, ""
+		}
+		return verdictDeny, fmt.Sprintf("country of client ip %s is unknown", client)
+	}
+
+	if slices.Contains(p.deny, country) {
+		return verdictDeny, fmt.Sprintf("country %s of client ip %s is denied", country, client)
+	}
+	if len(p.allow) > 0 && !slices.Contains(p.allow, country) {
+		return verdictDeny, fmt.Sprintf("country %s of client ip %s is not allowed", country, client)
+	}
+	return verdictContinue, ""
+}
+
+// compile builds the evaluator of a policy. Geo databases opened on the
+// policy's behalf are recorded in opened so the engine can close them.
+func (e *Engine) compile(spec *apidef.SecurityPolicy) (policy, error) {
+	switch strings.ToLower(spec.Type) {
+	case PolicyIPWhitelist, PolicyIPBlacklist:
+		var config IPListConfig
+		if err := decodeConfig(spec.Config, &config); err != nil {
+			return nil, err
+		}
+		prefixes, err := ParsePrefixes(config.CIDRs)
+		if err != nil {
+			return nil, err
+		}
+		return &ipListPolicy{
+			allow:    strings.EqualFold(spec.Type, PolicyIPWhitelist),
+			prefixes: prefixes,
+			terminal: config.Terminal,
+		}, nil
+
+	case PolicyGeoRestriction:
+		var config GeoConfig
+		if err := decodeConfig(spec.Config, &config); err != nil {
+			return nil, err
+		}
+		if len(config.AllowCountries) == 0 && len(config.DenyCountries) == 0 {
+			return nil, fmt.Errorf("geo restriction requires allow_countries or deny_countries")
+		}
+
+		db := e.geo
+		if config.Database != "" {
+			opened, err := OpenGeoDatabase(config.Database)
+			if err != nil {
+				return nil, err
+			}
+			e.opened = append(e.opened, opened)
+			db = opened
+		}
+		if db == nil {
+			return nil, fmt.Errorf("geo restriction requires a database")
+		}
+
+		return &geoPolicy{
+			db:           db,
+			allow:        upper(config.AllowCountries),
+			deny:         upper(config.DenyCountries),
+			allowUnknown: config.AllowUnknown,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported security policy type: %s", spec.Type)
+	}
+}
+
+// ParsePrefixes parses CIDR networks and single addresses
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr %q: %w", value, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip address %q: %w", value, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeConfig(input map[string]interface{}, output interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           output,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(input); err != nil {
+		return fmt.Errorf("invalid policy config: %w", err)
+	}
+	return nil
+}
+
+func upper(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, strings.ToUpper(strings.TrimSpace(value)))
+	}
+	return result
+}
@@ -0,0 +1,250 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/middleware"
+)
+
+// DefaultMaxBodySize is the largest body read for body transforms and conditions
+const DefaultMaxBodySize = 4 << 20
+
+// Common transform errors
+var (
+	ErrBodyTooLarge = middleware.ErrBodyTooLarge
+)
+
+// Engine applies an API definition's RequestTransforms and
+// ResponseTransforms, each in order
+type Engine struct {
+	apiID        string
+	request      []*rule
+	response     []*rule
+	requestBody  bool
+	responseBody bool
+	maxBodySize  int64
+	logger       *logger.Logger
+}
+
+// Option allows customization of the engine
+type Option func(*Engine)
+
+// WithMaxBodySize sets the largest body read for body transforms
+func WithMaxBodySize(size int64) Option {
+	return func(e *Engine) {
+		e.maxBodySize = size
+	}
+}
+
+// WithLogger sets the logger used to report skipped response transforms
+func WithLogger(log *logger.Logger) Option {
+	return func(e *Engine) {
+		e.logger = log
+	}
+}
+
+// New compiles the transforms of an API definition. Response transforms
+// support the header and body types only.
+func New(def *apidef.APIDefinition, options ...Option) (*Engine, error) {
+	if def == nil {
+		return nil, fmt.Errorf("api definition cannot be nil")
+	}
+
+	e := &Engine{
+		apiID:       def.APIID,
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, option := range options {
+		option(e)
+	}
+	if e.logger == nil {
+		e.logger = logger.GetGlobalLogger()
+	}
+	e.logger = e.logger.WithComponent("transform")
+
+	for i, t := range def.RequestTransforms {
+		r, err := compile(t, false)
+		if err != nil {
+			return nil, fmt.Errorf("request transform %d: %w", i, err)
+		}
+		e.request = append(e.request, r)
+		e.requestBody = e.requestBody || r.needsBody()
+	}
+	for i, t := range def.ResponseTransforms {
+		r, err := compile(t, true)
+		if err != nil {
+			return nil, fmt.Errorf("response transform %d: %w", i, err)
+		}
+		e.response = append(e.response, r)
+		e.responseBody = e.responseBody || r.needsBody()
+	}
+
+	return e, nil
+}
+
+// TransformRequest applies the request transforms to r in place
+func (e *Engine) TransformRequest(r *http.Request) error {
+	if len(e.request) == 0 {
+		return nil
+	}
+
+	m := &message{request: r, header: r.Header, context: newContext(r, r.Header)}
+	if e.requestBody && r.Body != nil && r.Body != http.NoBody {
+		body, err := middleware.ReadBody(r.Body, e.maxBodySize)
+		r.Body.Close()
+		if err != nil {
+			return err
+		}
+		m.setRaw(body)
+	}
+
+	for i, rule := range e.request {
+		if err := rule.apply(m); err != nil {
+			return fmt.Errorf("request transform %d: %w", i, err)
+		}
+	}
+
+	if e.requestBody {
+		body, err := m.encode()
+		if err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Del("Content-Length")
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	return nil
+}
+
+// TransformResponse applies the response transforms to an upstream
+// response of r. header is modified in place; the returned body replaces
+// the original.
+func (e *Engine) TransformResponse(r *http.Request, status int, header http.Header, body []byte) ([]byte, error) {
+	if len(e.response) == 0 {
+		return body, nil
+	}
+
+	m := &message{request: r, header: header, context: newContext(r, header)}
+	m.context.Status = status
+	if e.responseBody && isIdentity(header) {
+		m.setRaw(body)
+	} else {
+		m.body = body
+	}
+
+	for i, rule := range e.response {
+		if err := rule.apply(m); err != nil {
+			return nil, fmt.Errorf("response transform %d: %w", i, err)
+		}
+	}
+
+	transformed, err := m.encode()
+	if err != nil {
+		return nil, err
+	}
+	if len(transformed) != len(body) || header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(len(transformed)))
+	}
+	return transformed, nil
+}
+
+// Middleware transforms requests before next and buffers next's response
+// to transform it. Responses larger than the body size limit, or flushed
+// while being written, are streamed untransformed.
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	if len(e.request) == 0 && len(e.response) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := e.TransformRequest(r); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrBodyTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeError(w, status, err)
+			return
+		}
+
+		if len(e.response) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buffer := middleware.NewResponseBuffer(w, e.maxBodySize, func() {
+			e.logger.Warn("Response exceeds the transform size limit, streaming it untransformed",
+				zap.String("api_id", e.apiID),
+			)
+		})
+		next.ServeHTTP(buffer, r)
+		e.finish(w, r, buffer)
+	})
+}
+
+// Internal methods
+
+func newContext(r *http.Request, header http.Header) *Context {
+	c := &Context{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Query:      r.URL.Query(),
+		Header:     header,
+	}
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		c.Principal = principal
+		c.Claims = principal.Claims
+	}
+	return c
+}
+
+// isIdentity reports whether a body is not content-encoded
+func isIdentity(header http.Header) bool {
+	encoding := header.Get("Content-Encoding")
+	return encoding == "" || encoding == "identity"
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":      err.Error(),
+		"error_code": "TRANSFORM_FAILED",
+	})
+}
+
+// finish transforms and writes a fully buffered response
+func (e *Engine) finish(w http.ResponseWriter, r *http.Request, buffer *middleware.ResponseBuffer) {
+	status, body, ok := buffer.Buffered()
+	if !ok {
+		return
+	}
+
+	body, err := e.TransformResponse(r, status, w.Header(), body)
+	if err != nil {
+		e.logger.Error("Response transform failed",
+			zap.String("api_id", e.apiID),
+			zap.Error(err),
+		)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,76 @@
+package transform_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+	"github.com/vzahanych/gochoreo/pkg/logger"
+	"github.com/vzahanych/gochoreo/pkg/transform"
+)
+
+// ExampleEngine demonstrates request and response transforms with
+// templates, JSON body edits and conditions
+func ExampleEngine() {
+	engine, err := transform.New(&apidef.APIDefinition{
+		APIID: "orders",
+		RequestTransforms: []apidef.Transform{
+			// Forward the caller's tenant from the token claims
+			{Type: "header", Action: "set", Target: "X-Tenant", Template: `{{.Claims.tenant}}`},
+			{Type: "header", Action: "remove", Target: "X-Debug"},
+			{Type: "url", Action: "replace", Target: "path", Value: "/v2/$1",
+				Config: map[string]interface{}{"pattern": `^/v1/(.*)$`}},
+			{Type: "url", Action: "set", Target: "query:source", Value: "gateway"},
+			{Type: "body", Action: "set", Target: "order.placed_by", Template: `{{.Principal.ID}}`},
+			{Type: "body", Action: "remove", Target: "order.internal_note"},
+			// Express orders are upgraded to priority shipping
+			{Type: "body", Action: "set", Target: "order.shipping.priority", Value: "true",
+				Condition: &apidef.TransformCondition{Field: "body:order.express", Operator: "equals", Value: "true"}},
+		},
+		ResponseTransforms: []apidef.Transform{
+			{Type: "header", Action: "remove", Target: "Server"},
+			{Type: "body", Action: "add", Target: "links", Template: `{"rel":"self","href":"{{.Path}}"}`},
+			{Type: "body", Action: "replace", Target: "status", Template: `{{upper .Value}}`},
+		},
+	}, transform.WithLogger(&logger.Logger{Logger: zap.NewNop()}))
+	if err != nil {
+		log.Fatalf("Failed to create transform engine: %v", err)
+	}
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Println(r.Method, r.URL.String())
+		fmt.Println("tenant:", r.Header.Get("X-Tenant"), "debug:", r.Header.Get("X-Debug") != "")
+		fmt.Println("body:", string(body))
+
+		w.Header().Set("Server", "orders/1.4")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"o-1","status":"accepted"}`)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/orders?page=1",
+		strings.NewReader(`{"order":{"sku":"A-1","express":true,"internal_note":"vip"}}`))
+	req.Header.Set("X-Debug", "1")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{
+		ID:     "alice",
+		Method: apidef.AuthJWT,
+		Claims: map[string]interface{}{"tenant": "acme"},
+	}))
+
+	rec := httptest.NewRecorder()
+	engine.Middleware(upstream).ServeHTTP(rec, req)
+	fmt.Println("response:", rec.Code, rec.Body.String(), "server:", rec.Header().Get("Server") != "")
+
+	// Output:
+	// POST /v2/orders?page=1&source=gateway
+	// tenant: acme debug: false
+	// body: {"order":{"express":true,"placed_by":"alice","shipping":{"priority":true},"sku":"A-1"}}
+	// response: 200 {"id":"o-1","links":[{"href":"/v2/orders","rel":"self"}],"status":"ACCEPTED"} server: false
+}
@@ -0,0 +1,143 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WholeBody is the body Target that addresses the raw body instead of a
+// JSON field
+const WholeBody = "$"
+
+// splitPath splits a dotted JSON path such as $.items[0].name or
+// items.0.name into its segments
+func splitPath(path string) ([]string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.ReplaceAll(strings.ReplaceAll(path, "[", "."), "]", "")
+	if path == "" {
+		return nil, fmt.Errorf("empty json path")
+	}
+
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid json path %q", path)
+		}
+	}
+	return segments, nil
+}
+
+// lookup returns the value at path
+func lookup(doc interface{}, path []string) (interface{}, bool) {
+	current := doc
+	for _, segment := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// assign sets the value at path, creating missing objects on the way, and
+// returns the updated document. An array index equal to the array length
+// appends.
+func assign(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	segment := path[0]
+	switch node := doc.(type) {
+	case nil:
+		child, err := assign(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{segment: child}, nil
+	case map[string]interface{}:
+		child, err := assign(node[segment], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[segment] = child
+		return node, nil
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i > len(node) {
+			return nil, fmt.Errorf("invalid array index %q", segment)
+		}
+		if i == len(node) {
+			node = append(node, nil)
+		}
+		child, err := assign(node[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("cannot set field %q of a %T", segment, doc)
+	}
+}
+
+// remove deletes the value at path and returns the updated document
+func remove(doc interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return doc
+	}
+
+	segment := path[0]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(node, segment)
+		} else if child, ok := node[segment]; ok {
+			node[segment] = remove(child, path[1:])
+		}
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(node) {
+			return doc
+		}
+		if len(path) == 1 {
+			return append(node[:i], node[i+1:]...)
+		}
+		node[i] = remove(node[i], path[1:])
+	}
+	return doc
+}
+
+// stringify renders a JSON value for conditions, templates and replacements
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
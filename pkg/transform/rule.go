@@ -0,0 +1,570 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/vzahanych/gochoreo/pkg/apidef"
+	"github.com/vzahanych/gochoreo/pkg/auth"
+)
+
+// Transform types
+const (
+	TypeHeader = "header"
+	TypeBody   = "body"
+	TypeURL    = "url"
+	TypeMethod = "method"
+)
+
+// Transform actions
+const (
+	ActionSet     = "set"
+	ActionAdd     = "add"
+	ActionRemove  = "remove"
+	ActionReplace = "replace"
+)
+
+// Condition operators
+const (
+	OperatorEquals   = "equals"
+	OperatorContains = "contains"
+	OperatorRegex    = "regex"
+	OperatorExists   = "exists"
+)
+
+// Condition fields are header:<name>, query:<name> or body:<json path>
+const (
+	fieldHeader = "header"
+	fieldQuery  = "query"
+	fieldBody   = "body"
+)
+
+// URL targets are path, query (the whole query string) or query:<name>
+const (
+	TargetPath  = "path"
+	TargetQuery = "query"
+)
+
+// Keys read from Transform.Config
+const (
+	// ConfigPattern is a regular expression; replace substitutes its matches
+	// in the current value, expanding $1 style references
+	ConfigPattern = "pattern"
+	// ConfigType set to "string" stops body values being decoded as JSON
+	ConfigType = "type"
+)
+
+// Context is the data available to Transform.Template. Header and Body
+// belong to the message being transformed: the request for request
+// transforms, the upstream response for response transforms.
+type Context struct {
+	Method     string
+	Path       string
+	Host       string
+	RemoteAddr string
+	Query      url.Values
+	Header     http.Header
+	Body       interface{}
+	Status     int
+	Principal  *auth.Principal
+	Claims     map[string]interface{}
+	// Value is the target's current value
+	Value string
+}
+
+var templateFuncs = template.FuncMap{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"replace": strings.ReplaceAll,
+	"join":    strings.Join,
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// rule is a compiled apidef.Transform
+type rule struct {
+	kind      string
+	action    string
+	target    string
+	path      []string
+	value     string
+	template  *template.Template
+	pattern   *regexp.Regexp
+	raw       bool
+	condition *condition
+}
+
+type condition struct {
+	field    string
+	name     string
+	path     []string
+	operator string
+	value    string
+	regex    *regexp.Regexp
+}
+
+// message is the request or response being transformed
+type message struct {
+	request *http.Request
+	header  http.Header
+	body    []byte
+	doc     interface{}
+	isJSON  bool
+	changed bool
+	context *Context
+}
+
+func compile(t apidef.Transform, response bool) (*rule, error) {
+	r := &rule{
+		kind:   strings.ToLower(t.Type),
+		action: strings.ToLower(t.Action),
+		target: t.Target,
+		value:  t.Value,
+	}
+
+	switch r.kind {
+	case TypeHeader:
+		r.target = http.CanonicalHeaderKey(r.target)
+	case TypeBody:
+		if r.target != WholeBody {
+			path, err := splitPath(r.target)
+			if err != nil {
+				return nil, err
+			}
+			r.path = path
+		} else if r.action == ActionAdd {
+			return nil, fmt.Errorf("action %q is not supported on the whole body", r.action)
+		}
+	case TypeURL, TypeMethod:
+		if response {
+			return nil, fmt.Errorf("%s transforms only apply to requests", r.kind)
+		}
+		if err := r.validateRequestTarget(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported transform type %q", t.Type)
+	}
+
+	switch r.action {
+	case ActionSet, ActionAdd, ActionRemove, ActionReplace:
+	default:
+		return nil, fmt.Errorf("unsupported transform action %q", t.Action)
+	}
+
+	if t.Template != "" {
+		tmpl, err := template.New(t.Target).Funcs(templateFuncs).Option("missingkey=zero").Parse(t.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		r.template = tmpl
+	}
+
+	if pattern, ok := t.Config[ConfigPattern].(string); ok && pattern != "" {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		r.pattern = regex
+	}
+	r.raw = t.Config[ConfigType] == "string"
+
+	if t.Condition != nil {
+		c, err := compileCondition(t.Condition)
+		if err != nil {
+			return nil, err
+		}
+		r.condition = c
+	}
+	return r, nil
+}
+
+func (r *rule) validateRequestTarget() error {
+	if r.kind == TypeMethod {
+		if r.action != ActionSet && r.action != ActionReplace {
+			return fmt.Errorf("action %q is not supported on the method", r.action)
+		}
+		return nil
+	}
+
+	switch {
+	case r.target == TargetPath:
+		if r.action == ActionAdd || r.action == ActionRemove {
+			return fmt.Errorf("action %q is not supported on the path", r.action)
+		}
+	case r.target == TargetQuery:
+		if r.action == ActionAdd {
+			return fmt.Errorf("action %q is not supported on the whole query", r.action)
+		}
+	case strings.HasPrefix(r.target, TargetQuery+":") && len(r.target) > len(TargetQuery)+1:
+	default:
+		return fmt.Errorf("unsupported url target %q", r.target)
+	}
+	return nil
+}
+
+func compileCondition(tc *apidef.TransformCondition) (*condition, error) {
+	field, name, _ := strings.Cut(tc.Field, ":")
+	c := &condition{
+		field:    strings.ToLower(field),
+		name:     name,
+		operator: strings.ToLower(tc.Operator),
+		value:    tc.Value,
+		regex:    tc.Regex,
+	}
+
+	switch c.field {
+	case fieldHeader, fieldQuery:
+		if c.name == "" {
+			return nil, fmt.Errorf("condition field %q must name a %s", tc.Field, c.field)
+		}
+	case fieldBody:
+		path, err := splitPath(c.name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition field %q: %w", tc.Field, err)
+		}
+		c.path = path
+	default:
+		return nil, fmt.Errorf("unsupported condition field %q", tc.Field)
+	}
+
+	switch c.operator {
+	case OperatorEquals, OperatorContains, OperatorExists:
+	case OperatorRegex:
+		if c.regex == nil {
+			regex, err := regexp.Compile(c.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex in condition: %w", err)
+			}
+			c.regex = regex
+		}
+	default:
+		return nil, fmt.Errorf("unsupported condition operator %q", tc.Operator)
+	}
+	return c, nil
+}
+
+// matches evaluates the condition against a message
+func (c *condition) matches(m *message) bool {
+	var value string
+	var ok bool
+
+	switch c.field {
+	case fieldHeader:
+		var values []string
+		values, ok = m.header[http.CanonicalHeaderKey(c.name)]
+		value = strings.Join(values, ",")
+	case fieldQuery:
+		var values []string
+		values, ok = m.request.URL.Query()[c.name]
+		value = strings.Join(values, ",")
+	case fieldBody:
+		if !m.isJSON {
+			return false
+		}
+		var found interface{}
+		found, ok = lookup(m.doc, c.path)
+		value = stringify(found)
+	}
+
+	switch c.operator {
+	case OperatorExists:
+		return ok
+	case OperatorEquals:
+		return ok && value == c.value
+	case OperatorContains:
+		return ok && strings.Contains(value, c.value)
+	case OperatorRegex:
+		return ok && c.regex.MatchString(value)
+	}
+	return false
+}
+
+// needsBody reports whether applying the rule reads the body
+func (r *rule) needsBody() bool {
+	return r.kind == TypeBody ||
+		(r.condition != nil && r.condition.field == fieldBody) ||
+		(r.template != nil && strings.Contains(r.template.Root.String(), ".Body"))
+}
+
+// apply runs the rule against a message
+func (r *rule) apply(m *message) error {
+	if r.condition != nil && !r.condition.matches(m) {
+		return nil
+	}
+
+	switch r.kind {
+	case TypeHeader:
+		return r.applyHeader(m)
+	case TypeBody:
+		return r.applyBody(m)
+	case TypeURL:
+		return r.applyURL(m)
+	case TypeMethod:
+		return r.applyMethod(m)
+	}
+	return nil
+}
+
+func (r *rule) applyHeader(m *message) error {
+	values, exists := m.header[r.target]
+
+	switch r.action {
+	case ActionRemove:
+		m.header.Del(r.target)
+	case ActionSet, ActionAdd:
+		value, err := r.render(m, strings.Join(values, ","))
+		if err != nil {
+			return err
+		}
+		if r.action == ActionSet {
+			m.header.Set(r.target, value)
+		} else {
+			m.header.Add(r.target, value)
+		}
+	case ActionReplace:
+		if !exists {
+			return nil
+		}
+		replaced := make([]string, 0, len(values))
+		for _, current := range values {
+			value, err := r.replace(m, current)
+			if err != nil {
+				return err
+			}
+			replaced = append(replaced, value)
+		}
+		m.header[r.target] = replaced
+	}
+	return nil
+}
+
+func (r *rule) applyBody(m *message) error {
+	if r.path == nil {
+		if _, err := m.encode(); err != nil {
+			return err
+		}
+		switch r.action {
+		case ActionRemove:
+			m.setRaw(nil)
+		case ActionSet:
+			value, err := r.render(m, string(m.body))
+			if err != nil {
+				return err
+			}
+			m.setRaw([]byte(value))
+		case ActionReplace:
+			value, err := r.replace(m, string(m.body))
+			if err != nil {
+				return err
+			}
+			m.setRaw([]byte(value))
+		}
+		return nil
+	}
+
+	// Field edits only apply to JSON bodies
+	if !m.isJSON {
+		return nil
+	}
+
+	current, exists := lookup(m.doc, r.path)
+	var err error
+	switch r.action {
+	case ActionRemove:
+		m.doc = remove(m.doc, r.path)
+	case ActionSet:
+		var value interface{}
+		if value, err = r.renderJSON(m, stringify(current)); err == nil {
+			m.doc, err = assign(m.doc, r.path, value)
+		}
+	case ActionAdd:
+		var value interface{}
+		if value, err = r.renderJSON(m, ""); err != nil {
+			break
+		}
+		switch list := current.(type) {
+		case nil:
+			m.doc, err = assign(m.doc, r.path, []interface{}{value})
+		case []interface{}:
+			m.doc, err = assign(m.doc, r.path, append(list, value))
+		default:
+			err = fmt.Errorf("cannot add to %s: not an array", r.target)
+		}
+	case ActionReplace:
+		if !exists {
+			return nil
+		}
+		var value interface{}
+		if r.pattern != nil {
+			var replaced string
+			if replaced, err = r.replace(m, stringify(current)); err == nil {
+				value = r.decode(replaced)
+			}
+		} else {
+			value, err = r.renderJSON(m, stringify(current))
+		}
+		if err == nil {
+			m.doc, err = assign(m.doc, r.path, value)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("body transform on %s failed: %w", r.target, err)
+	}
+
+	m.changed = true
+	m.context.Body = m.doc
+	return nil
+}
+
+func (r *rule) applyURL(m *message) error {
+	u := m.request.URL
+
+	switch {
+	case r.target == TargetPath:
+		value, err := r.replace(m, u.Path)
+		if err != nil {
+			return err
+		}
+		u.Path, u.RawPath = value, ""
+	case r.target == TargetQuery:
+		if r.action == ActionRemove {
+			u.RawQuery = ""
+			break
+		}
+		value, err := r.replace(m, u.RawQuery)
+		if err != nil {
+			return err
+		}
+		u.RawQuery = value
+	default:
+		name := r.target[len(TargetQuery)+1:]
+		query := u.Query()
+		values, exists := query[name]
+
+		switch r.action {
+		case ActionRemove:
+			query.Del(name)
+		case ActionSet, ActionAdd:
+			value, err := r.render(m, strings.Join(values, ","))
+			if err != nil {
+				return err
+			}
+			if r.action == ActionSet {
+				query.Set(name, value)
+			} else {
+				query.Add(name, value)
+			}
+		case ActionReplace:
+			if !exists {
+				return nil
+			}
+			for i, current := range values {
+				value, err := r.replace(m, current)
+				if err != nil {
+					return err
+				}
+				values[i] = value
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	m.context.Path = u.Path
+	m.context.Query = u.Query()
+	return nil
+}
+
+func (r *rule) applyMethod(m *message) error {
+	value, err := r.replace(m, m.request.Method)
+	if err != nil {
+		return err
+	}
+	m.request.Method = strings.ToUpper(value)
+	m.context.Method = m.request.Method
+	return nil
+}
+
+// render returns the rule's value, executing its template if any
+func (r *rule) render(m *message, current string) (string, error) {
+	if r.template == nil {
+		return r.value, nil
+	}
+
+	m.context.Value = current
+	var out bytes.Buffer
+	if err := r.template.Execute(&out, m.context); err != nil {
+		return "", fmt.Errorf("template for %s failed: %w", r.target, err)
+	}
+	return out.String(), nil
+}
+
+// replace computes a replacement: pattern matches are substituted when a
+// pattern is configured, otherwise the whole value is replaced
+func (r *rule) replace(m *message, current string) (string, error) {
+	value, err := r.render(m, current)
+	if err != nil || r.pattern == nil {
+		return value, err
+	}
+	return r.pattern.ReplaceAllString(current, value), nil
+}
+
+func (r *rule) renderJSON(m *message, current string) (interface{}, error) {
+	value, err := r.render(m, current)
+	if err != nil {
+		return nil, err
+	}
+	return r.decode(value), nil
+}
+
+// decode interprets a rendered value as JSON when it is valid JSON, so
+// numbers, booleans and objects keep their type
+func (r *rule) decode(value string) interface{} {
+	if !r.raw && json.Valid([]byte(value)) {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+			return decoded
+		}
+	}
+	return value
+}
+
+// setRaw replaces the whole body
+func (m *message) setRaw(body []byte) {
+	m.body = body
+	m.doc, m.isJSON = nil, false
+	if len(body) > 0 && json.Unmarshal(body, &m.doc) == nil {
+		m.isJSON = true
+	}
+	m.context.Body = m.doc
+	m.changed = false
+}
+
+// encode returns the body after transforms
+func (m *message) encode() ([]byte, error) {
+	if !m.changed {
+		return m.body, nil
+	}
+	m.changed = false
+	data, err := json.Marshal(m.doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transformed body: %w", err)
+	}
+	m.body = data
+	return data, nil
+}